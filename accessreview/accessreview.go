@@ -0,0 +1,414 @@
+// Package accessreview runs access certification campaigns: reviewers
+// approve or revoke each role and access group held by the users in scope,
+// and whatever is left unreviewed when a campaign ends is revoked.
+package accessreview
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+	"unified-go-backend/authz"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/userquery"
+	"unified-go-backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrAlreadyDecided is returned when deciding an item that is no longer
+// pending or belongs to a completed campaign.
+var ErrAlreadyDecided = errors.New("access review item already decided")
+
+// ErrNoReviewer is returned when starting a campaign in which a user could
+// only review their own access: neither the campaign's reviewers nor the
+// other holders of access_reviews:decide can take the review.
+var ErrNoReviewer = errors.New("no reviewer available other than the reviewed user")
+
+// insertBatchSize bounds the number of items inserted at once.
+const insertBatchSize = 1000
+
+func campaigns() *mongo.Collection {
+	return database.MongoClient.Database("mdmdb").Collection("access_reviews")
+}
+
+func items() *mongo.Collection {
+	return database.MongoClient.Database("mdmdb").Collection("access_review_items")
+}
+
+// EnsureIndexes creates the indexes used to look up a campaign's items.
+func EnsureIndexes(ctx context.Context) error {
+	_, err := items().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "campaign_id", Value: 1}, {Key: "reviewer", Value: 1}}},
+		{Keys: bson.D{{Key: "campaign_id", Value: 1}, {Key: "decision", Value: 1}}},
+	})
+	return err
+}
+
+// Start stores a new campaign together with one pending item per role and
+// access group held by the users in scope. Items are spread over the
+// reviewers by user, and nobody reviews their own access: a user who is the
+// only reviewer is reviewed by another holder of access_reviews:decide,
+// who is added to the reviewers. A campaign that cannot be started is
+// removed again. It returns the number of items created.
+func Start(ctx context.Context, campaign *models.AccessReview) (int, error) {
+	created, err := start(ctx, campaign)
+	if err != nil {
+		if _, cleanupErr := items().DeleteMany(ctx, bson.M{"campaign_id": campaign.ID}); cleanupErr != nil {
+			utils.Logger.Errorf("Error removing the items of access review %s: %v", campaign.Name, cleanupErr)
+		}
+		if _, cleanupErr := campaigns().DeleteOne(ctx, bson.M{"_id": campaign.ID}); cleanupErr != nil {
+			utils.Logger.Errorf("Error removing access review %s: %v", campaign.Name, cleanupErr)
+		}
+		return 0, err
+	}
+	return created, nil
+}
+
+func start(ctx context.Context, campaign *models.AccessReview) (int, error) {
+	campaign.ID = primitive.NewObjectID()
+	campaign.Status = models.AccessReviewActive
+	if _, err := campaigns().InsertOne(ctx, campaign); err != nil {
+		return 0, err
+	}
+
+	everything := len(campaign.Roles) == 0 && len(campaign.AccessGroups) == 0
+	groups, err := globalAccessGroups(ctx, campaign.AccessGroups, everything)
+	if err != nil {
+		return 0, err
+	}
+	groupIDs := make([]primitive.ObjectID, 0, len(groups))
+	for id := range groups {
+		groupIDs = append(groupIDs, id)
+	}
+
+	filter := bson.M{}
+	if len(campaign.UserIDs) > 0 {
+		filter["_id"] = bson.M{"$in": campaign.UserIDs}
+	}
+	if !everything {
+		filter["$or"] = []bson.M{
+			{"roles": bson.M{"$in": nonNil(campaign.Roles)}},
+			{"access_groups": bson.M{"$in": groupIDs}},
+		}
+	}
+
+	cursor, err := database.MongoClient.Database("mdmdb").Collection("users").Find(ctx, userquery.Live(filter), options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	inScope := func(name string) bool {
+		if everything {
+			return true
+		}
+		for _, candidate := range campaign.Roles {
+			if candidate == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	var batch []interface{}
+	created := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if _, err := items().InsertMany(ctx, batch); err != nil {
+			return err
+		}
+		created += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	next, nextFallback := 0, 0
+	var fallback []string
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return created, err
+		}
+
+		reviewer := assignReviewer(campaign.Reviewers, user.Email, &next)
+		if reviewer == "" {
+			if fallback == nil {
+				if fallback, err = deciders(ctx); err != nil {
+					return created, err
+				}
+			}
+			if reviewer = assignReviewer(fallback, user.Email, &nextFallback); reviewer == "" {
+				return created, ErrNoReviewer
+			}
+			if err := addReviewer(ctx, campaign, reviewer); err != nil {
+				return created, err
+			}
+		}
+		add := func(kind, name string, groupID primitive.ObjectID) {
+			batch = append(batch, models.AccessReviewItem{
+				ID:            primitive.NewObjectID(),
+				CampaignID:    campaign.ID,
+				UserID:        user.ID,
+				Email:         user.Email,
+				Kind:          kind,
+				Name:          name,
+				AccessGroupID: groupID,
+				Reviewer:      reviewer,
+				Decision:      models.AccessReviewPending,
+			})
+		}
+		for _, role := range user.Roles {
+			if inScope(role) {
+				add(models.AccessReviewKindRole, role, primitive.NilObjectID)
+			}
+		}
+		for _, id := range user.AccessGroups {
+			if name, exists := groups[id]; exists {
+				add(models.AccessReviewKindAccessGroup, name, id)
+			}
+		}
+
+		if len(batch) >= insertBatchSize {
+			if err := flush(); err != nil {
+				return created, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return created, err
+	}
+	return created, flush()
+}
+
+// assignReviewer picks the next reviewer in turn, skipping the reviewed
+// user. It returns "" when nobody else can take the review.
+func assignReviewer(reviewers []string, email string, next *int) string {
+	for range reviewers {
+		reviewer := reviewers[*next%len(reviewers)]
+		*next++
+		if reviewer != email {
+			return reviewer
+		}
+	}
+	return ""
+}
+
+// deciders returns the emails of the users allowed to decide review items,
+// in order. It never returns nil, so that callers can load it once.
+func deciders(ctx context.Context) ([]string, error) {
+	users, err := authz.UsersWithPermission(ctx, "access_reviews:decide")
+	if err != nil {
+		return nil, err
+	}
+	emails := make([]string, 0, len(users))
+	for _, user := range users {
+		emails = append(emails, user.Email)
+	}
+	sort.Strings(emails)
+	return emails, nil
+}
+
+// addReviewer adds a fallback reviewer to the campaign, unless they
+// already are one.
+func addReviewer(ctx context.Context, campaign *models.AccessReview, reviewer string) error {
+	for _, existing := range campaign.Reviewers {
+		if existing == reviewer {
+			return nil
+		}
+	}
+	campaign.Reviewers = append(campaign.Reviewers, reviewer)
+	_, err := campaigns().UpdateOne(ctx, bson.M{"_id": campaign.ID}, bson.M{"$addToSet": bson.M{"reviewers": reviewer}})
+	return err
+}
+
+// globalAccessGroups returns the names of the named global access groups,
+// or of all of them, keyed by ID.
+func globalAccessGroups(ctx context.Context, names []string, all bool) (map[primitive.ObjectID]string, error) {
+	filter := bson.M{"org_id": bson.M{"$exists": false}, "name": bson.M{"$in": nonNil(names)}}
+	if all {
+		delete(filter, "name")
+	}
+	cursor, err := database.MongoClient.Database("mdmdb").Collection("access_groups").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	groups := make(map[primitive.ObjectID]string)
+	for cursor.Next(ctx) {
+		var group models.AccessGroup
+		if err := cursor.Decode(&group); err != nil {
+			return nil, err
+		}
+		groups[group.ID] = group.Name
+	}
+	return groups, cursor.Err()
+}
+
+func nonNil(names []string) []string {
+	if names == nil {
+		return []string{}
+	}
+	return names
+}
+
+// Decide records a reviewer's decision on a pending item. Revoking removes
+// the role or access group from the user right away.
+func Decide(ctx context.Context, item models.AccessReviewItem, decision, reviewer, note string) (models.AccessReviewItem, error) {
+	err := campaigns().FindOne(ctx, bson.M{"_id": item.CampaignID, "status": models.AccessReviewActive}).Err()
+	if err == mongo.ErrNoDocuments {
+		return item, ErrAlreadyDecided
+	}
+	if err != nil {
+		return item, err
+	}
+
+	update := bson.M{"$set": bson.M{
+		"decision":   decision,
+		"decided_by": reviewer,
+		"decided_at": time.Now(),
+		"note":       note,
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = items().FindOneAndUpdate(ctx, bson.M{"_id": item.ID, "decision": models.AccessReviewPending}, update, opts).Decode(&item)
+	if err == mongo.ErrNoDocuments {
+		return item, ErrAlreadyDecided
+	}
+	if err != nil {
+		return item, err
+	}
+
+	if decision == models.AccessReviewRevoked {
+		return item, revoke(ctx, item)
+	}
+	return item, nil
+}
+
+// revoke removes the reviewed role or access group from the user.
+func revoke(ctx context.Context, item models.AccessReviewItem) error {
+	pull := bson.M{"roles": item.Name}
+	if item.Kind == models.AccessReviewKindAccessGroup {
+		pull = bson.M{"access_groups": item.AccessGroupID}
+	}
+	users := database.MongoClient.Database("mdmdb").Collection("users")
+	if _, err := users.UpdateOne(ctx, bson.M{"_id": item.UserID}, bson.M{"$pull": pull}); err != nil {
+		return err
+	}
+	authz.InvalidateUsers(ctx, item.UserID)
+	return nil
+}
+
+// Complete ends a campaign, revoking every item still pending. Each item is
+// claimed before its access is revoked, so that an item a reviewer decides
+// meanwhile keeps their decision.
+func Complete(ctx context.Context, campaign models.AccessReview) error {
+	now := time.Now()
+	cursor, err := items().Find(ctx, bson.M{"campaign_id": campaign.ID, "decision": models.AccessReviewPending})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	update := bson.M{"$set": bson.M{
+		"decision":   models.AccessReviewRevoked,
+		"decided_by": "system",
+		"decided_at": now,
+		"note":       "not reviewed before the campaign ended",
+	}}
+	for cursor.Next(ctx) {
+		var item models.AccessReviewItem
+		if err := cursor.Decode(&item); err != nil {
+			return err
+		}
+		err := items().FindOneAndUpdate(ctx, bson.M{"_id": item.ID, "decision": models.AccessReviewPending}, update).Decode(&item)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := revoke(ctx, item); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	_, err = campaigns().UpdateOne(ctx, bson.M{"_id": campaign.ID}, bson.M{"$set": bson.M{
+		"status":       models.AccessReviewCompleted,
+		"completed_at": now,
+	}})
+	return err
+}
+
+// CompleteExpired completes every active campaign whose end has passed.
+func CompleteExpired(ctx context.Context, now time.Time) error {
+	cursor, err := campaigns().Find(ctx, bson.M{"status": models.AccessReviewActive, "ends_at": bson.M{"$lte": now}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var campaign models.AccessReview
+		if err := cursor.Decode(&campaign); err != nil {
+			return err
+		}
+		if err := Complete(ctx, campaign); err != nil {
+			return err
+		}
+		utils.Logger.Infof("Access review %s completed", campaign.Name)
+	}
+	return cursor.Err()
+}
+
+// Summarize counts the campaign's items by decision.
+func Summarize(ctx context.Context, campaign models.AccessReview) (models.AccessReviewSummary, error) {
+	summary := models.AccessReviewSummary{AccessReview: campaign}
+	cursor, err := items().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"campaign_id": campaign.ID}}},
+		{{Key: "$group", Value: bson.M{"_id": "$decision", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return summary, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var count struct {
+			Decision string `bson:"_id"`
+			Count    int    `bson:"count"`
+		}
+		if err := cursor.Decode(&count); err != nil {
+			return summary, err
+		}
+		switch count.Decision {
+		case models.AccessReviewPending:
+			summary.Pending = count.Count
+		case models.AccessReviewApproved:
+			summary.Approved = count.Count
+		case models.AccessReviewRevoked:
+			summary.Revoked = count.Count
+		}
+	}
+	return summary, cursor.Err()
+}
+
+// Items returns the campaign's items sorted by user and name. An empty
+// reviewer returns the items of every reviewer.
+func Items(ctx context.Context, campaignID primitive.ObjectID, reviewer string) (*mongo.Cursor, error) {
+	filter := bson.M{"campaign_id": campaignID}
+	if reviewer != "" {
+		filter["reviewer"] = reviewer
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "email", Value: 1}, {Key: "kind", Value: 1}, {Key: "name", Value: 1}})
+	return items().Find(ctx, filter, opts)
+}
@@ -0,0 +1,26 @@
+package accessreview
+
+import "testing"
+
+func TestAssignReviewer(t *testing.T) {
+	reviewers := []string{"ann@example.com", "bob@example.com"}
+	next := 0
+	var got []string
+	for _, email := range []string{"carl@example.com", "ann@example.com", "ann@example.com", "bob@example.com"} {
+		got = append(got, assignReviewer(reviewers, email, &next))
+	}
+	want := []string{"ann@example.com", "bob@example.com", "bob@example.com", "ann@example.com"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("assignReviewer() picked %v, want %v", got, want)
+		}
+	}
+
+	// Nobody reviews their own access, even as the only reviewer
+	if reviewer := assignReviewer([]string{"ann@example.com"}, "ann@example.com", &next); reviewer != "" {
+		t.Errorf("assignReviewer() = %q for the only reviewer, want none", reviewer)
+	}
+	if reviewer := assignReviewer(nil, "ann@example.com", &next); reviewer != "" {
+		t.Errorf("assignReviewer() = %q without reviewers, want none", reviewer)
+	}
+}
@@ -0,0 +1,330 @@
+package authz
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/utils"
+
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Resolved grants are cached in two levels: an in-process LRU in front of
+// Redis, which the replicas share. Redis entries live in one hash per user
+// under the current generation; changing a role or access group bumps the
+// generation, which drops every entry at once, while changing a user drops
+// only that user's hash. Each change is published so the replicas clear
+// their LRU too. A replica that misses a message serves stale grants for at
+// most the cache TTL. Changes are published even by processes that do not
+// cache, such as the command line tools, as long as they are connected to
+// Redis.
+const (
+	cacheGenerationKey = "authz:grants:generation"
+	cacheChannel       = "authz:grants:invalidate"
+)
+
+// invalidation is the message published on cacheChannel. An empty User
+// invalidates every user.
+type invalidation struct {
+	Generation int64  `json:"generation"`
+	User       string `json:"user,omitempty"`
+}
+
+// cachedGrants is a cache entry, stored as JSON in Redis.
+type cachedGrants struct {
+	key        string
+	Grants     *Grants   `json:"grants"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Generation int64     `json:"generation"`
+}
+
+type grantsCache struct {
+	mu         sync.Mutex
+	size       int
+	ttl        time.Duration
+	generation int64
+	// epoch counts invalidations, so that grants resolved before one are
+	// not stored after it
+	epoch   uint64
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+var cache = &grantsCache{order: list.New(), entries: make(map[string]*list.Element)}
+
+// ConfigureCache sets how many users' grants are kept in process and how
+// long grants are served before being resolved again. A size of zero
+// disables caching.
+func ConfigureCache(size int, ttl time.Duration) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.size = size
+	cache.ttl = ttl
+	cache.clear()
+}
+
+// CachedGrants returns the grants of the user inside org like ResolveUser,
+// from the cache when possible. Use it on hot paths; ResolveUser always
+// reads the current state.
+func CachedGrants(ctx context.Context, user models.User, org primitive.ObjectID) (*Grants, error) {
+	if !cache.enabled() {
+		return ResolveUser(ctx, user, org)
+	}
+
+	key := user.ID.Hex() + ":" + org.Hex()
+	if grants, ok := cache.get(key, time.Now()); ok {
+		return grants, nil
+	}
+
+	// Remember the epoch before reading: grants resolved from data changed
+	// meanwhile must not be cached
+	epoch, generation := cache.current()
+	generation, err := cache.syncGeneration(ctx, generation)
+	if err != nil {
+		utils.Logger.Errorf("CachedGrants: Error reading cache generation: %v", err)
+		return ResolveUser(ctx, user, org)
+	}
+	if entry, ok := loadEntry(ctx, generation, user.ID, org); ok {
+		entry.key = key
+		cache.put(entry, epoch)
+		return entry.Grants, nil
+	}
+
+	grants, err := ResolveUser(ctx, user, org)
+	if err != nil {
+		return nil, err
+	}
+	entry := &cachedGrants{key: key, Grants: grants, ExpiresAt: cache.expiry(user, time.Now()), Generation: generation}
+	if cache.put(entry, epoch) {
+		storeEntry(ctx, user.ID, org, entry)
+	}
+	return grants, nil
+}
+
+// InvalidateUsers drops the cached grants of the users, after their roles,
+// role grants, access groups or memberships changed.
+func InvalidateUsers(ctx context.Context, ids ...primitive.ObjectID) {
+	if database.RedisClient == nil || len(ids) == 0 {
+		return
+	}
+	_, known := cache.current()
+	generation, err := cache.syncGeneration(ctx, known)
+	if err != nil {
+		utils.Logger.Errorf("InvalidateUsers: Error reading cache generation: %v", err)
+		generation = known
+	}
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, entriesKey(generation, id))
+	}
+	if err := database.RedisClient.Del(ctx, keys...).Err(); err != nil {
+		utils.Logger.Errorf("InvalidateUsers: Error deleting cached grants: %v", err)
+	}
+	for _, id := range ids {
+		cache.invalidate(invalidation{Generation: generation, User: id.Hex()})
+		publish(ctx, invalidation{Generation: generation, User: id.Hex()})
+	}
+}
+
+// InvalidateAll drops every cached grant, after a role, access group, team
+// or organization changed.
+func InvalidateAll(ctx context.Context) {
+	if database.RedisClient == nil {
+		return
+	}
+	generation, err := database.RedisClient.Incr(ctx, cacheGenerationKey).Result()
+	if err != nil {
+		utils.Logger.Errorf("InvalidateAll: Error bumping cache generation: %v", err)
+		return
+	}
+	cache.invalidate(invalidation{Generation: generation})
+	publish(ctx, invalidation{Generation: generation})
+}
+
+// WatchInvalidations clears the in-process cache as other replicas publish
+// invalidations, until ctx is done.
+func WatchInvalidations(ctx context.Context) error {
+	if !cache.enabled() {
+		return nil
+	}
+	subscription := database.RedisClient.Subscribe(ctx, cacheChannel)
+	defer subscription.Close()
+
+	messages := subscription.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			var event invalidation
+			if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+				utils.Logger.Errorf("WatchInvalidations: Invalid message %q: %v", message.Payload, err)
+				continue
+			}
+			cache.invalidate(event)
+		}
+	}
+}
+
+func publish(ctx context.Context, event invalidation) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		utils.Logger.Errorf("publish: Error encoding invalidation: %v", err)
+		return
+	}
+	if err := database.RedisClient.Publish(ctx, cacheChannel, payload).Err(); err != nil {
+		utils.Logger.Errorf("publish: Error publishing invalidation: %v", err)
+	}
+}
+
+func entriesKey(generation int64, user primitive.ObjectID) string {
+	return fmt.Sprintf("authz:grants:%d:%s", generation, user.Hex())
+}
+
+func loadEntry(ctx context.Context, generation int64, user, org primitive.ObjectID) (*cachedGrants, bool) {
+	payload, err := database.RedisClient.HGet(ctx, entriesKey(generation, user), org.Hex()).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			utils.Logger.Errorf("loadEntry: Error reading cached grants: %v", err)
+		}
+		return nil, false
+	}
+	var entry cachedGrants
+	if err := json.Unmarshal(payload, &entry); err != nil {
+		utils.Logger.Errorf("loadEntry: Invalid cached grants: %v", err)
+		return nil, false
+	}
+	if !entry.ExpiresAt.After(time.Now()) || entry.Generation != generation {
+		return nil, false
+	}
+	return &entry, true
+}
+
+func storeEntry(ctx context.Context, user, org primitive.ObjectID, entry *cachedGrants) {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		utils.Logger.Errorf("storeEntry: Error encoding grants: %v", err)
+		return
+	}
+	key := entriesKey(entry.Generation, user)
+	pipe := database.RedisClient.TxPipeline()
+	pipe.HSet(ctx, key, org.Hex(), payload)
+	pipe.Expire(ctx, key, time.Until(entry.ExpiresAt))
+	if _, err := pipe.Exec(ctx); err != nil {
+		utils.Logger.Errorf("storeEntry: Error caching grants: %v", err)
+	}
+}
+
+func (c *grantsCache) enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size > 0
+}
+
+func (c *grantsCache) current() (uint64, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.epoch, c.generation
+}
+
+// expiry is when grants resolved now stop being served: after the TTL, or
+// as soon as one of the user's temporary role grants expires.
+func (c *grantsCache) expiry(user models.User, now time.Time) time.Time {
+	c.mu.Lock()
+	expiresAt := now.Add(c.ttl)
+	c.mu.Unlock()
+	for _, grant := range user.RoleGrants {
+		if grant.ExpiresAt.After(now) && grant.ExpiresAt.Before(expiresAt) {
+			expiresAt = grant.ExpiresAt
+		}
+	}
+	return expiresAt
+}
+
+// syncGeneration reads the shared generation and clears the process cache
+// when it moved on, which happens when an invalidation message was missed.
+func (c *grantsCache) syncGeneration(ctx context.Context, known int64) (int64, error) {
+	generation, err := database.RedisClient.Get(ctx, cacheGenerationKey).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if generation != known {
+		c.invalidate(invalidation{Generation: generation})
+	}
+	return generation, nil
+}
+
+func (c *grantsCache) get(key string, now time.Time) (*Grants, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+	entry := element.Value.(*cachedGrants)
+	if !entry.ExpiresAt.After(now) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.Grants, true
+}
+
+// put stores the entry unless the cache was invalidated since epoch,
+// evicting the least recently used entries beyond the size. It reports
+// whether the entry was stored.
+func (c *grantsCache) put(entry *cachedGrants, epoch uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.epoch != epoch || entry.Generation != c.generation {
+		return false
+	}
+	if element, exists := c.entries[entry.key]; exists {
+		c.order.Remove(element)
+	}
+	c.entries[entry.key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedGrants).key)
+	}
+	return true
+}
+
+func (c *grantsCache) invalidate(event invalidation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	if event.User == "" {
+		c.generation = event.Generation
+		c.clear()
+		return
+	}
+	prefix := event.User + ":"
+	for key, element := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.order.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// clear drops every entry; the caller holds the lock.
+func (c *grantsCache) clear() {
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
@@ -0,0 +1,138 @@
+package authz
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// catalog holds every permission declared by the routes, keyed by name.
+var (
+	catalogMu sync.RWMutex
+	catalog   = make(map[string]*catalogEntry)
+)
+
+type catalogEntry struct {
+	description string
+	required    bool
+}
+
+// Register declares a permission together with a human readable description.
+func Register(name, description string) {
+	name = Canonical(name)
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	entry, exists := catalog[name]
+	if !exists {
+		entry = &catalogEntry{}
+		catalog[name] = entry
+	}
+	entry.description = description
+}
+
+// Require records that a route requires the given permissions. It is called
+// by the authorization middleware while routes are being set up.
+func Require(names ...string) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	for _, name := range CanonicalList(names) {
+		entry, exists := catalog[name]
+		if !exists {
+			entry = &catalogEntry{}
+			catalog[name] = entry
+		}
+		entry.required = true
+	}
+}
+
+// Catalog returns the declared permissions sorted by name.
+func Catalog() []models.Permission {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	permissions := make([]models.Permission, 0, len(catalog))
+	for name, entry := range catalog {
+		permissions = append(permissions, models.Permission{Name: name, Description: entry.description})
+	}
+	sort.Slice(permissions, func(i, j int) bool {
+		return permissions[i].Name < permissions[j].Name
+	})
+	return permissions
+}
+
+// RequiredPermissions returns the names of the permissions required by at
+// least one route, sorted by name.
+func RequiredPermissions() []string {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	var names []string
+	for name, entry := range catalog {
+		if entry.required {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UndescribedPermissions returns the required permissions that were never
+// registered with a description.
+func UndescribedPermissions() []string {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	var names []string
+	for name, entry := range catalog {
+		if entry.required && entry.description == "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SyncCatalog upserts the declared permissions into the permissions
+// collection so they can be referenced by roles and access groups.
+func SyncCatalog(ctx context.Context) error {
+	collection := database.MongoClient.Database("mdmdb").Collection("permissions")
+	for _, permission := range Catalog() {
+		filter := bson.M{"name": permission.Name}
+		set := bson.M{"name": permission.Name}
+		if permission.Description != "" {
+			set["description"] = permission.Description
+		}
+		_, err := collection.UpdateOne(ctx, filter, bson.M{"$set": set}, options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UngrantablePermissions returns the permissions required by routes that are
+// not granted by any role or access group.
+func UngrantablePermissions(ctx context.Context) ([]string, error) {
+	granted := make(PermissionSet)
+	for _, name := range []string{"roles", "access_groups"} {
+		values, err := database.MongoClient.Database("mdmdb").Collection(name).Distinct(ctx, "permissions", bson.M{})
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			if perm, ok := value.(string); ok {
+				granted[Canonical(perm)] = true
+			}
+		}
+	}
+
+	var missing []string
+	for _, name := range RequiredPermissions() {
+		if !granted.Allows(name) {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
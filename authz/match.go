@@ -0,0 +1,135 @@
+package authz
+
+import "strings"
+
+// Permission names are namespaced with colons, e.g. "users:read". A "*"
+// segment matches any single segment, and a trailing "*" matches every
+// remaining segment, so "users:*" grants "users:read" and "*" grants
+// everything.
+
+// aliases maps the legacy flat permission names to their namespaced
+// equivalents so existing roles, access groups and clients keep working.
+var aliases = map[string]string{
+	"create_user":                 "users:create",
+	"read_user":                   "users:read",
+	"update_user":                 "users:update",
+	"delete_user":                 "users:delete",
+	"list_users":                  "users:list",
+	"export_users":                "users:export",
+	"create_access_group":         "access_groups:create",
+	"read_access_group":           "access_groups:read",
+	"list_access_groups":          "access_groups:list",
+	"update_access_group":         "access_groups:update",
+	"delete_access_group":         "access_groups:delete",
+	"manage_access_group_members": "access_groups:manage_members",
+	"create_role":                 "roles:create",
+	"read_role":                   "roles:read",
+	"update_role":                 "roles:update",
+	"delete_role":                 "roles:delete",
+	"list_roles":                  "roles:list",
+	"list_permissions":            "permissions:list",
+}
+
+// Aliases returns a copy of the legacy to namespaced permission name mapping.
+func Aliases() map[string]string {
+	copied := make(map[string]string, len(aliases))
+	for legacy, name := range aliases {
+		copied[legacy] = name
+	}
+	return copied
+}
+
+// Canonical returns the namespaced form of a permission name.
+func Canonical(name string) string {
+	if canonical, exists := aliases[name]; exists {
+		return canonical
+	}
+	return name
+}
+
+// CanonicalList returns the namespaced form of every name, without duplicates.
+func CanonicalList(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	canonical := make([]string, 0, len(names))
+	for _, name := range names {
+		name = Canonical(name)
+		if !seen[name] {
+			seen[name] = true
+			canonical = append(canonical, name)
+		}
+	}
+	return canonical
+}
+
+// IsPattern reports whether a permission name contains a wildcard.
+func IsPattern(name string) bool {
+	return strings.Contains(name, "*")
+}
+
+// Matches reports whether the granted permission, which may contain
+// wildcards, covers the required permission.
+func Matches(granted, required string) bool {
+	granted = Canonical(granted)
+	required = Canonical(required)
+	if granted == required || granted == "*" {
+		return true
+	}
+
+	grantedParts := strings.Split(granted, ":")
+	requiredParts := strings.Split(required, ":")
+	for i, part := range grantedParts {
+		if part == "*" && i == len(grantedParts)-1 {
+			return len(requiredParts) > i
+		}
+		if i >= len(requiredParts) {
+			return false
+		}
+		if part != "*" && part != requiredParts[i] {
+			return false
+		}
+	}
+	return len(grantedParts) == len(requiredParts)
+}
+
+// PermissionSet is a set of granted permission names, possibly including
+// wildcard patterns.
+type PermissionSet map[string]bool
+
+// Allows reports whether any granted permission covers required. Granted
+// names are compared in their namespaced form, so sets holding legacy names
+// work too.
+func (s PermissionSet) Allows(required string) bool {
+	if s[Canonical(required)] {
+		return true
+	}
+	for granted, allowed := range s {
+		if allowed && Matches(granted, required) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAll reports whether every required permission is covered.
+func (s PermissionSet) AllowsAll(required []string) bool {
+	for _, perm := range required {
+		if !s.Allows(perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowsAny reports whether at least one required permission is covered.
+// An empty requirement is always allowed.
+func (s PermissionSet) AllowsAny(required []string) bool {
+	if len(required) == 0 {
+		return true
+	}
+	for _, perm := range required {
+		if s.Allows(perm) {
+			return true
+		}
+	}
+	return false
+}
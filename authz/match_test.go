@@ -0,0 +1,127 @@
+package authz
+
+import "testing"
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"update_user", "users:update"},
+		{"list_permissions", "permissions:list"},
+		{"users:update", "users:update"},
+		{"users:*", "users:*"},
+		{"unknown_name", "unknown_name"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := Canonical(test.name); got != test.want {
+			t.Errorf("Canonical(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCanonicalList(t *testing.T) {
+	got := CanonicalList([]string{"update_user", "users:update", "users:list", "list_users", "roles:read"})
+	want := []string{"users:update", "users:list", "roles:read"}
+	if len(got) != len(want) {
+		t.Fatalf("CanonicalList() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("CanonicalList() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		granted, required string
+		want              bool
+	}{
+		{"users:read", "users:read", true},
+		{"users:read", "users:update", false},
+		{"*", "users:read", true},
+		{"*", "users", true},
+		{"users:*", "users:read", true},
+		{"users:*", "users:read:email", true},
+		{"users:*", "users", false},
+		{"users:*", "roles:read", false},
+		{"*:read", "users:read", true},
+		{"*:read", "users:update", false},
+		{"*:read", "users:read:email", false},
+		{"users:*:email", "users:read:email", true},
+		{"users:*:email", "users:read", false},
+		{"users", "users:read", false},
+		{"users:read", "users", false},
+		// Legacy names on either side are compared namespaced
+		{"update_user", "users:update", true},
+		{"users:update", "update_user", true},
+		{"users:*", "delete_user", true},
+		{"read_user", "users:update", false},
+	}
+	for _, test := range tests {
+		if got := Matches(test.granted, test.required); got != test.want {
+			t.Errorf("Matches(%q, %q) = %v, want %v", test.granted, test.required, got, test.want)
+		}
+	}
+}
+
+func TestIsPattern(t *testing.T) {
+	for name, want := range map[string]bool{"*": true, "users:*": true, "*:read": true, "users:read": false, "update_user": false} {
+		if got := IsPattern(name); got != want {
+			t.Errorf("IsPattern(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestPermissionSetAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		set      PermissionSet
+		required string
+		want     bool
+	}{
+		{"exact", PermissionSet{"users:update": true}, "users:update", true},
+		{"legacy required", PermissionSet{"users:update": true}, "update_user", true},
+		{"legacy granted", PermissionSet{"update_user": true}, "users:update", true},
+		{"legacy both", PermissionSet{"update_user": true}, "update_user", true},
+		{"wildcard", PermissionSet{"users:*": true}, "users:delete", true},
+		{"wildcard legacy required", PermissionSet{"users:*": true}, "delete_user", true},
+		{"wildcard namespace only", PermissionSet{"users:*": true}, "users", false},
+		{"global wildcard", PermissionSet{"*": true}, "roles:read", true},
+		{"other namespace", PermissionSet{"users:*": true}, "roles:read", false},
+		{"missing", PermissionSet{"users:read": true}, "users:update", false},
+		{"false entry", PermissionSet{"users:update": false}, "users:update", false},
+		{"false wildcard", PermissionSet{"users:*": false}, "users:update", false},
+		{"empty", PermissionSet{}, "users:read", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.set.Allows(test.required); got != test.want {
+				t.Errorf("%v.Allows(%q) = %v, want %v", test.set, test.required, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPermissionSetAllowsAllAndAny(t *testing.T) {
+	set := PermissionSet{"users:read": true, "roles:*": true}
+	tests := []struct {
+		required []string
+		all, any bool
+	}{
+		{nil, true, true},
+		{[]string{"users:read"}, true, true},
+		{[]string{"users:read", "roles:create"}, true, true},
+		{[]string{"users:read", "users:update"}, false, true},
+		{[]string{"users:update", "access_groups:read"}, false, false},
+	}
+	for _, test := range tests {
+		if got := set.AllowsAll(test.required); got != test.all {
+			t.Errorf("AllowsAll(%v) = %v, want %v", test.required, got, test.all)
+		}
+		if got := set.AllowsAny(test.required); got != test.any {
+			t.Errorf("AllowsAny(%v) = %v, want %v", test.required, got, test.any)
+		}
+	}
+}
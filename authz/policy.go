@@ -0,0 +1,383 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Policies are evaluated after role permissions have granted an action:
+//
+//   - a deny policy whose conditions all hold refuses the action;
+//   - when allow policies apply to the action, at least one must hold;
+//   - an action no policy applies to is left to the role permissions.
+//
+// Policies are cached in memory and reloaded from the policies collection
+// periodically by Watch, so edits made on any replica take effect everywhere.
+var (
+	policiesMu sync.RWMutex
+	policies   []models.Policy
+)
+
+// PolicyRequest is the input to policy evaluation.
+type PolicyRequest struct {
+	Action  string
+	Subject models.User
+	// Resource is the loaded target document. When nil, only policies that
+	// do not reference resource attributes are evaluated.
+	Resource interface{}
+	IP       string
+	Time     time.Time
+}
+
+// PolicyDecision is the outcome of policy evaluation.
+type PolicyDecision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+	Policy  string `json:"policy,omitempty"`
+}
+
+// ReloadPolicies replaces the cached policies with the enabled policies
+// stored in the database.
+func ReloadPolicies(ctx context.Context) error {
+	collection := database.MongoClient.Database("mdmdb").Collection("policies")
+	cursor, err := collection.Find(ctx, bson.M{"enabled": true})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var loaded []models.Policy
+	for cursor.Next(ctx) {
+		var policy models.Policy
+		if err := cursor.Decode(&policy); err != nil {
+			return err
+		}
+		loaded = append(loaded, policy)
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	sort.Slice(loaded, func(i, j int) bool {
+		return loaded[i].Name < loaded[j].Name
+	})
+
+	policiesMu.Lock()
+	policies = loaded
+	policiesMu.Unlock()
+	return nil
+}
+
+// EvaluatePolicies decides whether the cached policies let the request
+// through.
+func EvaluatePolicies(req PolicyRequest) PolicyDecision {
+	policiesMu.RLock()
+	current := policies
+	policiesMu.RUnlock()
+
+	if req.Time.IsZero() {
+		req.Time = time.Now()
+	}
+	attributes := map[string]interface{}{
+		"subject": Attributes(req.Subject),
+		"env": map[string]interface{}{
+			"time":    req.Time,
+			"hour":    req.Time.Hour(),
+			"minute":  req.Time.Minute(),
+			"weekday": strings.ToLower(req.Time.Weekday().String()),
+			"date":    req.Time.Format("2006-01-02"),
+			"ip":      req.IP,
+		},
+	}
+	if req.Resource != nil {
+		attributes["resource"] = Attributes(req.Resource)
+	}
+
+	allowApplies := false
+	for _, policy := range current {
+		if !policyApplies(policy, req.Action) {
+			continue
+		}
+		if req.Resource == nil && ReferencesResource(policy) {
+			continue
+		}
+
+		holds := true
+		for _, condition := range policy.Conditions {
+			if !evaluateCondition(condition, attributes) {
+				holds = false
+				break
+			}
+		}
+
+		if policy.Effect == EffectDeny {
+			if holds {
+				return PolicyDecision{Allowed: false, Reason: "denied by policy " + policy.Name, Policy: policy.Name}
+			}
+			continue
+		}
+		allowApplies = true
+		if holds {
+			return PolicyDecision{Allowed: true, Reason: "allowed by policy " + policy.Name, Policy: policy.Name}
+		}
+	}
+
+	if allowApplies {
+		return PolicyDecision{Allowed: false, Reason: "no allow policy holds for " + req.Action}
+	}
+	return PolicyDecision{Allowed: true, Reason: "no policy applies to " + req.Action}
+}
+
+// ReferencesResource reports whether any condition of the policy reads a
+// resource attribute.
+func ReferencesResource(policy models.Policy) bool {
+	for _, condition := range policy.Conditions {
+		if strings.HasPrefix(condition.Attribute, "resource.") || strings.HasPrefix(condition.ValueFrom, "resource.") {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePolicy checks the parts of a policy that struct tags cannot and
+// returns validation errors keyed by field, or nil.
+func ValidatePolicy(policy models.Policy) map[string]string {
+	errors := make(map[string]string)
+	for i, condition := range policy.Conditions {
+		key := fmt.Sprintf("conditions[%d]", i)
+		if !validAttribute(condition.Attribute) {
+			errors[key+".attribute"] = "must start with subject., resource. or env."
+		}
+		if condition.ValueFrom != "" && !validAttribute(condition.ValueFrom) {
+			errors[key+".value_from"] = "must start with subject., resource. or env."
+		}
+		if condition.ValueFrom == "" && condition.Value == nil {
+			errors[key+".value"] = "required"
+		}
+	}
+	if len(errors) == 0 {
+		return nil
+	}
+	return errors
+}
+
+func validAttribute(attribute string) bool {
+	for _, prefix := range []string{"subject.", "resource.", "env."} {
+		if strings.HasPrefix(attribute, prefix) && len(attribute) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func policyApplies(policy models.Policy, action string) bool {
+	for _, pattern := range policy.Actions {
+		if Matches(pattern, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// Attributes converts a document into a map keyed by its bson field names,
+// with the _id exposed as a hex "id" and password hashes removed.
+func Attributes(document interface{}) map[string]interface{} {
+	data, err := bson.Marshal(document)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	var raw bson.M
+	if err := bson.Unmarshal(data, &raw); err != nil {
+		return map[string]interface{}{}
+	}
+
+	attributes := make(map[string]interface{}, len(raw))
+	for key, value := range raw {
+		switch key {
+		case "password":
+			continue
+		case "_id":
+			key = "id"
+		}
+		attributes[key] = normalize(value)
+	}
+	return attributes
+}
+
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.DateTime:
+		return v.Time()
+	case primitive.A:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = normalize(item)
+		}
+		return list
+	case bson.M:
+		nested := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			nested[key] = normalize(item)
+		}
+		return nested
+	}
+	return value
+}
+
+func lookup(attributes map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = attributes
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func evaluateCondition(condition models.Condition, attributes map[string]interface{}) bool {
+	actual, ok := lookup(attributes, condition.Attribute)
+	if !ok {
+		return false
+	}
+	expected := normalize(condition.Value)
+	if condition.ValueFrom != "" {
+		if expected, ok = lookup(attributes, condition.ValueFrom); !ok {
+			return false
+		}
+	}
+
+	switch condition.Operator {
+	case "eq":
+		return equal(actual, expected)
+	case "ne":
+		return !equal(actual, expected)
+	case "in":
+		return containsValue(toList(expected), actual)
+	case "not_in":
+		return !containsValue(toList(expected), actual)
+	case "contains":
+		return containsValue(toList(actual), expected)
+	case "not_contains":
+		return !containsValue(toList(actual), expected)
+	case "intersects":
+		for _, item := range toList(actual) {
+			if containsValue(toList(expected), item) {
+				return true
+			}
+		}
+		return false
+	case "gt", "gte", "lt", "lte":
+		a, okA := toFloat(actual)
+		b, okB := toFloat(expected)
+		if !okA || !okB {
+			return false
+		}
+		switch condition.Operator {
+		case "gt":
+			return a > b
+		case "gte":
+			return a >= b
+		case "lt":
+			return a < b
+		}
+		return a <= b
+	case "between":
+		bounds := toList(expected)
+		if len(bounds) != 2 {
+			return false
+		}
+		a, okA := toFloat(actual)
+		low, okLow := toFloat(bounds[0])
+		high, okHigh := toFloat(bounds[1])
+		return okA && okLow && okHigh && a >= low && a <= high
+	case "cidr":
+		ip := net.ParseIP(fmt.Sprint(actual))
+		if ip == nil {
+			return false
+		}
+		for _, block := range toList(expected) {
+			if _, network, err := net.ParseCIDR(fmt.Sprint(block)); err == nil && network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func toList(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case primitive.A:
+		return v
+	case []string:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = item
+		}
+		return list
+	case nil:
+		return nil
+	}
+	return []interface{}{value}
+}
+
+func containsValue(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if equal(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equal compares numbers by value and everything else by its string form.
+// Strings are never parsed as numbers here so that long numeric-looking
+// identifiers are not rounded into each other.
+func equal(a, b interface{}) bool {
+	_, aIsString := a.(string)
+	_, bIsString := b.(string)
+	if !aIsString && !bIsString {
+		if x, ok := toFloat(a); ok {
+			if y, ok := toFloat(b); ok {
+				return x == y
+			}
+		}
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
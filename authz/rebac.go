@@ -0,0 +1,355 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxRelationDepth bounds how many usersets a check may follow, so a
+// cyclic set of tuples cannot recurse forever.
+const maxRelationDepth = 25
+
+// ErrNoSchema is returned when relations are used before a schema is stored.
+var ErrNoSchema = errors.New("no relation schema has been defined")
+
+// inputError marks errors caused by a malformed request rather than by the
+// tuple store.
+type inputError struct{ error }
+
+// IsRelationInputError reports whether err was caused by malformed input.
+func IsRelationInputError(err error) bool {
+	var target inputError
+	return errors.As(err, &target)
+}
+
+var (
+	schemaMu sync.RWMutex
+	schema   *Schema
+)
+
+// UsersetTree is the expansion of a relation on an object into the subjects
+// that hold it.
+type UsersetTree struct {
+	Object   string        `json:"object"`
+	Relation string        `json:"relation"`
+	Subjects []string      `json:"subjects,omitempty"`
+	Children []UsersetTree `json:"children,omitempty"`
+}
+
+func tuplesCollection() *mongo.Collection {
+	return database.MongoClient.Database("mdmdb").Collection("relation_tuples")
+}
+
+// EnsureRelationIndexes creates the indexes used by the tuple store.
+func EnsureRelationIndexes(ctx context.Context) error {
+	_, err := tuplesCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "object", Value: 1}, {Key: "relation", Value: 1}, {Key: "subject", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "object_type", Value: 1}}},
+		{Keys: bson.D{{Key: "subject", Value: 1}}},
+	})
+	return err
+}
+
+// CurrentSchema returns the cached relation schema, or ErrNoSchema.
+func CurrentSchema() (*Schema, error) {
+	schemaMu.RLock()
+	defer schemaMu.RUnlock()
+	if schema == nil {
+		return nil, ErrNoSchema
+	}
+	return schema, nil
+}
+
+// ReloadSchema replaces the cached schema with the one stored in the
+// database. A missing schema leaves relations disabled.
+func ReloadSchema(ctx context.Context) error {
+	stored, err := SchemaSource(ctx)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	parsed, err := ParseSchema(stored.Source)
+	if err != nil {
+		return err
+	}
+	schemaMu.Lock()
+	schema = parsed
+	schemaMu.Unlock()
+	return nil
+}
+
+// SchemaSource returns the stored schema source.
+func SchemaSource(ctx context.Context) (models.RelationSchema, error) {
+	var stored models.RelationSchema
+	err := database.MongoClient.Database("mdmdb").Collection("relation_schema").FindOne(ctx, bson.M{}).Decode(&stored)
+	return stored, err
+}
+
+// SaveSchema validates and stores new schema source and makes it current.
+func SaveSchema(ctx context.Context, source string) error {
+	parsed, err := ParseSchema(source)
+	if err != nil {
+		return err
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("relation_schema")
+	update := bson.M{"$set": bson.M{"source": source, "updated_at": time.Now()}}
+	if _, err := collection.UpdateOne(ctx, bson.M{}, update, options.Update().SetUpsert(true)); err != nil {
+		return err
+	}
+
+	schemaMu.Lock()
+	schema = parsed
+	schemaMu.Unlock()
+	return nil
+}
+
+// WriteTuple stores a tuple after validating it against the schema. Writing
+// an existing tuple is a no-op.
+func WriteTuple(ctx context.Context, tuple models.RelationTuple) error {
+	current, err := CurrentSchema()
+	if err != nil {
+		return err
+	}
+	if err := current.ValidateTuple(tuple.Object, tuple.Relation, tuple.Subject); err != nil {
+		return err
+	}
+	objectType, _, _ := SplitObject(tuple.Object)
+
+	filter := bson.M{"object": tuple.Object, "relation": tuple.Relation, "subject": tuple.Subject}
+	update := bson.M{"$setOnInsert": bson.M{"object_type": objectType, "created_at": time.Now()}}
+	_, err = tuplesCollection().UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// DeleteTuple removes a tuple and reports whether it existed.
+func DeleteTuple(ctx context.Context, tuple models.RelationTuple) (bool, error) {
+	filter := bson.M{"object": tuple.Object, "relation": tuple.Relation, "subject": tuple.Subject}
+	result, err := tuplesCollection().DeleteOne(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// DeleteTuplesOf removes the tuples naming ref, e.g. user:64b..., as their
+// object or subject, and returns how many were removed.
+func DeleteTuplesOf(ctx context.Context, ref string) (int64, error) {
+	filter := bson.M{"$or": []bson.M{{"object": ref}, {"subject": ref}}}
+	result, err := tuplesCollection().DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// ReadTuples returns the tuples matching the non-empty fields of filter.
+func ReadTuples(ctx context.Context, object, relation, subject string) ([]models.RelationTuple, error) {
+	filter := bson.M{}
+	if object != "" {
+		filter["object"] = object
+	}
+	if relation != "" {
+		filter["relation"] = relation
+	}
+	if subject != "" {
+		filter["subject"] = subject
+	}
+
+	cursor, err := tuplesCollection().Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tuples := []models.RelationTuple{}
+	for cursor.Next(ctx) {
+		var tuple models.RelationTuple
+		if err := cursor.Decode(&tuple); err != nil {
+			return nil, err
+		}
+		tuples = append(tuples, tuple)
+	}
+	return tuples, cursor.Err()
+}
+
+// Check reports whether subject has relation on object, following usersets,
+// computed permissions and tuple-to-userset terms.
+func Check(ctx context.Context, subject, relation, object string) (bool, error) {
+	current, err := CurrentSchema()
+	if err != nil {
+		return false, err
+	}
+	if _, _, err := SplitObject(object); err != nil {
+		return false, inputError{err}
+	}
+	return check(ctx, current, subject, relation, object, 0)
+}
+
+func check(ctx context.Context, current *Schema, subject, relation, object string, depth int) (bool, error) {
+	if depth > maxRelationDepth {
+		return false, nil
+	}
+	objectType, _, err := SplitObject(object)
+	if err != nil {
+		return false, nil
+	}
+	definition, exists := current.Relation(objectType, relation)
+	if !exists {
+		return false, nil
+	}
+
+	if definition.Permission {
+		for _, term := range definition.Union {
+			if term.Tupleset == "" {
+				allowed, err := check(ctx, current, subject, term.Relation, object, depth+1)
+				if err != nil || allowed {
+					return allowed, err
+				}
+				continue
+			}
+			tuples, err := ReadTuples(ctx, object, term.Tupleset, "")
+			if err != nil {
+				return false, err
+			}
+			for _, tuple := range tuples {
+				allowed, err := check(ctx, current, subject, term.Relation, tuple.Subject, depth+1)
+				if err != nil || allowed {
+					return allowed, err
+				}
+			}
+		}
+		return false, nil
+	}
+
+	tuples, err := ReadTuples(ctx, object, relation, "")
+	if err != nil {
+		return false, err
+	}
+	for _, tuple := range tuples {
+		if tuple.Subject == subject {
+			return true, nil
+		}
+		if usersetObject, usersetRelation, ok := strings.Cut(tuple.Subject, "#"); ok {
+			allowed, err := check(ctx, current, subject, usersetRelation, usersetObject, depth+1)
+			if err != nil || allowed {
+				return allowed, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// Expand returns the userset tree of relation on object.
+func Expand(ctx context.Context, relation, object string) (UsersetTree, error) {
+	current, err := CurrentSchema()
+	if err != nil {
+		return UsersetTree{}, err
+	}
+	if _, _, err := SplitObject(object); err != nil {
+		return UsersetTree{}, inputError{err}
+	}
+	return expand(ctx, current, relation, object, 0)
+}
+
+func expand(ctx context.Context, current *Schema, relation, object string, depth int) (UsersetTree, error) {
+	tree := UsersetTree{Object: object, Relation: relation}
+	if depth > maxRelationDepth {
+		return tree, nil
+	}
+	objectType, _, err := SplitObject(object)
+	if err != nil {
+		return tree, nil
+	}
+	definition, exists := current.Relation(objectType, relation)
+	if !exists {
+		return tree, nil
+	}
+
+	if definition.Permission {
+		for _, term := range definition.Union {
+			if term.Tupleset == "" {
+				child, err := expand(ctx, current, term.Relation, object, depth+1)
+				if err != nil {
+					return tree, err
+				}
+				tree.Children = append(tree.Children, child)
+				continue
+			}
+			tuples, err := ReadTuples(ctx, object, term.Tupleset, "")
+			if err != nil {
+				return tree, err
+			}
+			for _, tuple := range tuples {
+				child, err := expand(ctx, current, term.Relation, tuple.Subject, depth+1)
+				if err != nil {
+					return tree, err
+				}
+				tree.Children = append(tree.Children, child)
+			}
+		}
+		return tree, nil
+	}
+
+	tuples, err := ReadTuples(ctx, object, relation, "")
+	if err != nil {
+		return tree, err
+	}
+	for _, tuple := range tuples {
+		tree.Subjects = append(tree.Subjects, tuple.Subject)
+		if usersetObject, usersetRelation, ok := strings.Cut(tuple.Subject, "#"); ok {
+			child, err := expand(ctx, current, usersetRelation, usersetObject, depth+1)
+			if err != nil {
+				return tree, err
+			}
+			tree.Children = append(tree.Children, child)
+		}
+	}
+	return tree, nil
+}
+
+// ListObjects returns the objects of objectType on which subject has
+// relation. Every object of the type that appears in a tuple is checked, so
+// this is meant for types with a moderate number of objects.
+func ListObjects(ctx context.Context, subject, relation, objectType string) ([]string, error) {
+	current, err := CurrentSchema()
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := current.Relation(objectType, relation); !exists {
+		return nil, inputError{errors.New("type " + objectType + " has no relation " + relation)}
+	}
+
+	values, err := tuplesCollection().Distinct(ctx, "object", bson.M{"object_type": objectType})
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []string{}
+	for _, value := range values {
+		object, ok := value.(string)
+		if !ok {
+			continue
+		}
+		allowed, err := check(ctx, current, subject, relation, object, 0)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
@@ -0,0 +1,387 @@
+package authz
+
+import (
+	"context"
+	"sort"
+	"time"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/tenant"
+	"unified-go-backend/userquery"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Rule effects.
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Rule is a single allow or deny entry together with where it came from.
+// Source is the path through which the user received it, e.g.
+// "access_group:ops > role:operator > role:user".
+type Rule struct {
+	Permission string `json:"permission"`
+	Effect     string `json:"effect"`
+	Source     string `json:"source"`
+}
+
+// Decision is the outcome of checking a single permission.
+type Decision struct {
+	Permission string `json:"permission"`
+	Allowed    bool   `json:"allowed"`
+	Reason     string `json:"reason"`
+	Rule       *Rule  `json:"rule,omitempty"`
+}
+
+// Grants holds every rule that applies to a user. Rules are kept sorted by
+// source and permission so that decisions are deterministic.
+type Grants struct {
+	Allow []Rule `json:"allow"`
+	Deny  []Rule `json:"deny"`
+}
+
+// LoadAccessGroups fetches the access groups with the given IDs owned by
+// org, or the global ones for primitive.NilObjectID.
+func LoadAccessGroups(ctx context.Context, ids []primitive.ObjectID, org primitive.ObjectID) ([]models.AccessGroup, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return findAccessGroups(ctx, tenant.With(tenant.OwnedBy(org), bson.M{"_id": bson.M{"$in": ids}}))
+}
+
+// FindAccessGroups fetches the access groups of org, or the global ones for
+// primitive.NilObjectID, with the given names.
+func FindAccessGroups(ctx context.Context, names []string, org primitive.ObjectID) ([]models.AccessGroup, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return findAccessGroups(ctx, tenant.With(tenant.OwnedBy(org), bson.M{"name": bson.M{"$in": names}}))
+}
+
+func findAccessGroups(ctx context.Context, filter interface{}) ([]models.AccessGroup, error) {
+	collection := database.MongoClient.Database("mdmdb").Collection("access_groups")
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []models.AccessGroup
+	for cursor.Next(ctx) {
+		var group models.AccessGroup
+		if err := cursor.Decode(&group); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, cursor.Err()
+}
+
+// ResolveUser collects the rules that apply to a user: those of the user's
+// own roles and unexpired role grants, of the roles granted through each of
+// the user's access groups (with inherited roles expanded) and those assigned
+// directly to the access groups. Inside an organization the roles and access
+// groups of the user's membership are added; org is primitive.NilObjectID in
+// the global context. Teams of the same scope add their roles, those of
+// their ancestors and the roles assigned to the user in the team.
+func ResolveUser(ctx context.Context, user models.User, org primitive.ObjectID) (*Grants, error) {
+	roles, err := LoadRoles(ctx, primitive.NilObjectID)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := LoadAccessGroups(ctx, user.AccessGroups, primitive.NilObjectID)
+	if err != nil {
+		return nil, err
+	}
+	grants := resolve(user, roles, groups, time.Now())
+
+	scopeRoles := roles
+	if !org.IsZero() {
+		scopeRoles, err = LoadRoles(ctx, org)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if membership, exists := tenant.Membership(user, org); exists && !org.IsZero() {
+		orgGroups, err := LoadAccessGroups(ctx, membership.AccessGroups, org)
+		if err != nil {
+			return nil, err
+		}
+		grants.addMembership(membership, scopeRoles, orgGroups)
+	}
+	if len(user.Teams) > 0 {
+		teams, err := LoadTeams(ctx, org)
+		if err != nil {
+			return nil, err
+		}
+		grants.addTeams(user, teams, scopeRoles)
+	}
+	grants.sort()
+	return grants, nil
+}
+
+func resolve(user models.User, roles map[string]models.Role, groups []models.AccessGroup, now time.Time) *Grants {
+	grants := &Grants{}
+	for _, name := range user.Roles {
+		grants.addRole(roles, name, "", make(map[string]bool))
+	}
+	for _, grant := range user.RoleGrants {
+		if grant.ExpiresAt.After(now) {
+			grants.addRole(roles, grant.Role, "grant:"+grant.ExpiresAt.UTC().Format(time.RFC3339), make(map[string]bool))
+		}
+	}
+	grants.addGroups(roles, groups, "")
+	grants.sort()
+	return grants
+}
+
+// addMembership adds the rules of the roles and access groups held through
+// an organization membership.
+func (g *Grants) addMembership(membership models.OrgMembership, roles map[string]models.Role, groups []models.AccessGroup) {
+	source := "org:" + membership.OrgID.Hex()
+	for _, name := range membership.Roles {
+		g.addRole(roles, name, source, make(map[string]bool))
+	}
+	g.addGroups(roles, groups, source+" > ")
+}
+
+func (g *Grants) addGroups(roles map[string]models.Role, groups []models.AccessGroup, prefix string) {
+	for _, group := range groups {
+		source := prefix + "access_group:" + group.Name
+		g.add(group.Permissions, EffectAllow, source)
+		g.add(group.Deny, EffectDeny, source)
+		for _, name := range group.Roles {
+			g.addRole(roles, name, source, make(map[string]bool))
+		}
+	}
+}
+
+// UsersWithPermission returns every user whose global roles, role grants and
+// access groups grant the permission without a deny rule overriding it.
+func UsersWithPermission(ctx context.Context, permission string) ([]models.User, error) {
+	roles, err := LoadRoles(ctx, primitive.NilObjectID)
+	if err != nil {
+		return nil, err
+	}
+	allGroups, err := loadAllAccessGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Narrow the users down to those holding a role or group that grants
+	// the permission, then resolve each of them to apply deny rules.
+	roleNames := []string{}
+	for name := range roles {
+		if RolePermissions(roles, []string{name}).Allows(permission) {
+			roleNames = append(roleNames, name)
+		}
+	}
+	groupsByID := make(map[primitive.ObjectID]models.AccessGroup, len(allGroups))
+	groupIDs := []primitive.ObjectID{}
+	for _, group := range allGroups {
+		groupsByID[group.ID] = group
+		set := RolePermissions(roles, group.Roles)
+		for _, perm := range group.Permissions {
+			set[Canonical(perm)] = true
+		}
+		if set.Allows(permission) {
+			groupIDs = append(groupIDs, group.ID)
+		}
+	}
+	if len(roleNames) == 0 && len(groupIDs) == 0 {
+		return nil, nil
+	}
+
+	filter := userquery.Live(bson.M{"$or": []bson.M{
+		{"roles": bson.M{"$in": roleNames}},
+		{"role_grants.role": bson.M{"$in": roleNames}},
+		{"access_groups": bson.M{"$in": groupIDs}},
+	}})
+	cursor, err := database.MongoClient.Database("mdmdb").Collection("users").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	now := time.Now()
+	var users []models.User
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		var groups []models.AccessGroup
+		for _, id := range user.AccessGroups {
+			if group, exists := groupsByID[id]; exists {
+				groups = append(groups, group)
+			}
+		}
+		if resolve(user, roles, groups, now).Check(permission).Allowed {
+			users = append(users, user)
+		}
+	}
+	return users, cursor.Err()
+}
+
+func loadAllAccessGroups(ctx context.Context) ([]models.AccessGroup, error) {
+	cursor, err := database.MongoClient.Database("mdmdb").Collection("access_groups").Find(ctx, tenant.OwnedBy(primitive.NilObjectID))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []models.AccessGroup
+	err = cursor.All(ctx, &groups)
+	return groups, err
+}
+
+// addRole adds the rules of a role and of every role it inherits from.
+func (g *Grants) addRole(roles map[string]models.Role, name, via string, ancestors map[string]bool) {
+	role, exists := roles[name]
+	if !exists || ancestors[name] {
+		return
+	}
+	source := "role:" + name
+	if via != "" {
+		source = via + " > " + source
+	}
+	g.add(role.Permissions, EffectAllow, source)
+	g.add(role.Deny, EffectDeny, source)
+
+	ancestors[name] = true
+	for _, parent := range role.Parents {
+		g.addRole(roles, parent, source, ancestors)
+	}
+	delete(ancestors, name)
+}
+
+func (g *Grants) add(permissions []string, effect, source string) {
+	for _, perm := range permissions {
+		rule := Rule{Permission: Canonical(perm), Effect: effect, Source: source}
+		if effect == EffectDeny {
+			g.Deny = append(g.Deny, rule)
+		} else {
+			g.Allow = append(g.Allow, rule)
+		}
+	}
+}
+
+func (g *Grants) sort() {
+	for _, rules := range [][]Rule{g.Allow, g.Deny} {
+		sort.SliceStable(rules, func(i, j int) bool {
+			if rules[i].Source != rules[j].Source {
+				return rules[i].Source < rules[j].Source
+			}
+			return rules[i].Permission < rules[j].Permission
+		})
+	}
+}
+
+// Check decides a single permission. A matching deny rule always wins over
+// any allow rule; among several matching rules of the same effect the first
+// in source order is reported.
+func (g *Grants) Check(required string) Decision {
+	required = Canonical(required)
+	for i := range g.Deny {
+		if Matches(g.Deny[i].Permission, required) {
+			rule := g.Deny[i]
+			return Decision{Permission: required, Allowed: false, Reason: "denied by " + rule.Permission + " from " + rule.Source, Rule: &rule}
+		}
+	}
+	for i := range g.Allow {
+		if Matches(g.Allow[i].Permission, required) {
+			rule := g.Allow[i]
+			return Decision{Permission: required, Allowed: true, Reason: "granted by " + rule.Permission + " from " + rule.Source, Rule: &rule}
+		}
+	}
+	return Decision{Permission: required, Allowed: false, Reason: "no rule grants " + required}
+}
+
+// CheckAll decides every required permission and reports whether all of
+// them are allowed.
+func (g *Grants) CheckAll(required []string) (bool, []Decision) {
+	decisions := make([]Decision, 0, len(required))
+	allowed := true
+	for _, perm := range required {
+		decision := g.Check(perm)
+		decisions = append(decisions, decision)
+		allowed = allowed && decision.Allowed
+	}
+	return allowed, decisions
+}
+
+// Withheld lists, in order, the granted permissions the rules do not allow.
+// Callers may only hand out permissions they hold themselves.
+func (g *Grants) Withheld(granted PermissionSet) []string {
+	var withheld []string
+	for perm := range granted {
+		if !g.Check(perm).Allowed {
+			withheld = append(withheld, perm)
+		}
+	}
+	sort.Strings(withheld)
+	return withheld
+}
+
+// Authorize decides an action for a user: the user's rules must grant it
+// and the access policies must allow it.
+func (g *Grants) Authorize(req PolicyRequest) Decision {
+	decision := g.Check(req.Action)
+	if !decision.Allowed {
+		return decision
+	}
+	if policy := EvaluatePolicies(req); !policy.Allowed {
+		return Decision{Permission: decision.Permission, Allowed: false, Reason: policy.Reason}
+	}
+	return decision
+}
+
+// EffectivePermission is a granted permission together with every source
+// granting it. Denied is set when a deny rule overrides the grant.
+type EffectivePermission struct {
+	Permission string   `json:"permission"`
+	Sources    []string `json:"sources"`
+	Denied     bool     `json:"denied"`
+	DeniedBy   []Rule   `json:"denied_by,omitempty"`
+}
+
+// Effective groups the allow rules by permission, sorted by name, and marks
+// those overridden by deny rules.
+func (g *Grants) Effective() []EffectivePermission {
+	byName := make(map[string]*EffectivePermission)
+	var names []string
+	for _, rule := range g.Allow {
+		effective, exists := byName[rule.Permission]
+		if !exists {
+			effective = &EffectivePermission{Permission: rule.Permission}
+			byName[rule.Permission] = effective
+			names = append(names, rule.Permission)
+		}
+		effective.Sources = append(effective.Sources, rule.Source)
+	}
+	sort.Strings(names)
+
+	permissions := make([]EffectivePermission, 0, len(names))
+	for _, name := range names {
+		effective := byName[name]
+		for _, rule := range g.Deny {
+			if Matches(rule.Permission, name) {
+				effective.Denied = true
+				effective.DeniedBy = append(effective.DeniedBy, rule)
+			}
+		}
+		permissions = append(permissions, *effective)
+	}
+	return permissions
+}
+
+// Explanation describes how a set of permissions was decided for a user.
+type Explanation struct {
+	Email     string     `json:"email"`
+	Allowed   bool       `json:"allowed"`
+	Decisions []Decision `json:"decisions"`
+	Grants    *Grants    `json:"grants"`
+}
@@ -0,0 +1,229 @@
+package authz
+
+import (
+	"context"
+	"sort"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/tenant"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RoleTree is a role with the roles it inherits from expanded recursively.
+type RoleTree struct {
+	Name                 string     `json:"name"`
+	Permissions          []string   `json:"permissions"`
+	EffectivePermissions []string   `json:"effective_permissions"`
+	Deny                 []string   `json:"deny"`
+	EffectiveDeny        []string   `json:"effective_deny"`
+	Parents              []RoleTree `json:"parents"`
+	Missing              bool       `json:"missing,omitempty"`
+}
+
+// LoadRoles fetches the roles usable in org keyed by name: the global roles,
+// overridden by the organization's own roles of the same name. Pass
+// primitive.NilObjectID for the global roles only.
+func LoadRoles(ctx context.Context, org primitive.ObjectID) (map[string]models.Role, error) {
+	filter := tenant.OwnedBy(primitive.NilObjectID)
+	if !org.IsZero() {
+		filter = bson.M{"$or": []bson.M{filter, tenant.OwnedBy(org)}}
+	}
+	cursor, err := database.MongoClient.Database("mdmdb").Collection("roles").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	roles := make(map[string]models.Role)
+	for cursor.Next(ctx) {
+		var role models.Role
+		if err := cursor.Decode(&role); err != nil {
+			return nil, err
+		}
+		if _, exists := roles[role.Name]; exists && role.OrgID.IsZero() {
+			continue
+		}
+		roles[role.Name] = role
+	}
+	return roles, cursor.Err()
+}
+
+// ExpandRoles returns the given role names together with every role they
+// transitively inherit from. Unknown roles are skipped.
+func ExpandRoles(roles map[string]models.Role, names []string) []string {
+	visited := make(map[string]bool)
+	var expanded []string
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		role, exists := roles[name]
+		if !exists {
+			return
+		}
+		expanded = append(expanded, name)
+		for _, parent := range role.Parents {
+			visit(parent)
+		}
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return expanded
+}
+
+// RolePermissions returns the transitive permission set of the given roles.
+func RolePermissions(roles map[string]models.Role, names []string) PermissionSet {
+	permissions := make(PermissionSet)
+	for _, name := range ExpandRoles(roles, names) {
+		for _, perm := range roles[name].Permissions {
+			permissions[Canonical(perm)] = true
+		}
+	}
+	return permissions
+}
+
+// GroupPermissions returns the permissions granted by access groups: the
+// transitive permissions of their roles and their own permissions.
+func GroupPermissions(roles map[string]models.Role, groups []models.AccessGroup) PermissionSet {
+	permissions := make(PermissionSet)
+	for _, group := range groups {
+		for perm := range RolePermissions(roles, group.Roles) {
+			permissions[perm] = true
+		}
+		for _, perm := range group.Permissions {
+			permissions[Canonical(perm)] = true
+		}
+	}
+	return permissions
+}
+
+// RoleDeny returns the transitive deny set of the given roles.
+func RoleDeny(roles map[string]models.Role, names []string) PermissionSet {
+	deny := make(PermissionSet)
+	for _, name := range ExpandRoles(roles, names) {
+		for _, perm := range roles[name].Deny {
+			deny[Canonical(perm)] = true
+		}
+	}
+	return deny
+}
+
+// ReplaceRole returns a copy of roles with role stored under its name in
+// place of the role with the same ID, which may have had another name. On a
+// rename the parents referring to the previous name are rewritten, as
+// renaming a role does, so that the result is the inheritance in effect
+// once role is saved.
+func ReplaceRole(roles map[string]models.Role, role models.Role) map[string]models.Role {
+	previous := ""
+	if !role.ID.IsZero() {
+		for name, existing := range roles {
+			if existing.ID == role.ID {
+				previous = name
+				break
+			}
+		}
+	}
+
+	replaced := make(map[string]models.Role, len(roles)+1)
+	for name, existing := range roles {
+		if name == previous {
+			continue
+		}
+		if previous != "" && previous != role.Name {
+			parents := make([]string, len(existing.Parents))
+			for i, parent := range existing.Parents {
+				if parent == previous {
+					parent = role.Name
+				}
+				parents[i] = parent
+			}
+			existing.Parents = parents
+		}
+		replaced[name] = existing
+	}
+	replaced[role.Name] = role
+	return replaced
+}
+
+// FindCycle reports whether giving the named role the proposed parents would
+// create an inheritance cycle. When it would, the offending path is returned.
+func FindCycle(roles map[string]models.Role, name string, parents []string) []string {
+	var path []string
+	visited := make(map[string]bool)
+	var visit func(current string) bool
+	visit = func(current string) bool {
+		path = append(path, current)
+		if current == name {
+			return true
+		}
+		if !visited[current] {
+			visited[current] = true
+			for _, parent := range roles[current].Parents {
+				if visit(parent) {
+					return true
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	for _, parent := range parents {
+		path = []string{name}
+		if visit(parent) {
+			return path
+		}
+	}
+	return nil
+}
+
+// BuildRoleTree expands the named role into its inheritance tree.
+func BuildRoleTree(roles map[string]models.Role, name string) RoleTree {
+	return buildRoleTree(roles, name, make(map[string]bool))
+}
+
+func buildRoleTree(roles map[string]models.Role, name string, ancestors map[string]bool) RoleTree {
+	role, exists := roles[name]
+	if !exists {
+		return RoleTree{Name: name, Permissions: []string{}, EffectivePermissions: []string{}, Deny: []string{}, EffectiveDeny: []string{}, Parents: []RoleTree{}, Missing: true}
+	}
+
+	tree := RoleTree{
+		Name:                 role.Name,
+		Permissions:          role.Permissions,
+		EffectivePermissions: sortedKeys(RolePermissions(roles, []string{name})),
+		Deny:                 role.Deny,
+		EffectiveDeny:        sortedKeys(RoleDeny(roles, []string{name})),
+		Parents:              []RoleTree{},
+	}
+	if tree.Permissions == nil {
+		tree.Permissions = []string{}
+	}
+	if tree.Deny == nil {
+		tree.Deny = []string{}
+	}
+
+	// Guard against cycles already present in stored data
+	ancestors[name] = true
+	for _, parent := range role.Parents {
+		if ancestors[parent] {
+			continue
+		}
+		tree.Parents = append(tree.Parents, buildRoleTree(roles, parent, ancestors))
+	}
+	delete(ancestors, name)
+	return tree
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
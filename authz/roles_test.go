@@ -0,0 +1,114 @@
+package authz
+
+import (
+	"strings"
+	"testing"
+	"unified-go-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func roleMap(roles ...models.Role) map[string]models.Role {
+	byName := make(map[string]models.Role, len(roles))
+	for _, role := range roles {
+		byName[role.Name] = role
+	}
+	return byName
+}
+
+func TestFindCycle(t *testing.T) {
+	roles := roleMap(
+		models.Role{Name: "admin", Parents: []string{"operator"}},
+		models.Role{Name: "operator", Parents: []string{"user"}},
+		models.Role{Name: "user"},
+		models.Role{Name: "auditor", Parents: []string{"user"}},
+	)
+
+	tests := []struct {
+		name    string
+		role    string
+		parents []string
+		// cycle is the expected path, joined by " -> ", empty for none
+		cycle string
+	}{
+		{name: "no parents", role: "user", parents: nil},
+		{name: "existing chain", role: "admin", parents: []string{"operator"}},
+		{name: "shared ancestor", role: "admin", parents: []string{"operator", "auditor"}},
+		{name: "new role", role: "support", parents: []string{"admin", "auditor"}},
+		{name: "missing parent", role: "support", parents: []string{"ghost"}},
+		{name: "self", role: "user", parents: []string{"user"}, cycle: "user -> user"},
+		{name: "direct", role: "user", parents: []string{"operator"}, cycle: "user -> operator -> user"},
+		{name: "transitive", role: "user", parents: []string{"admin"}, cycle: "user -> admin -> operator -> user"},
+		{name: "second parent", role: "operator", parents: []string{"auditor", "admin"}, cycle: "operator -> admin -> operator"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cycle := strings.Join(FindCycle(roles, test.role, test.parents), " -> ")
+			if cycle != test.cycle {
+				t.Errorf("FindCycle(%q, %v) = %q, want %q", test.role, test.parents, cycle, test.cycle)
+			}
+		})
+	}
+}
+
+func TestReplaceRole(t *testing.T) {
+	x := models.Role{ID: primitive.NewObjectID(), Name: "x", Parents: []string{"a"}}
+	a := models.Role{ID: primitive.NewObjectID(), Name: "a"}
+	roles := roleMap(x, a)
+
+	// Renaming a to b with parent x would turn x -> a into x -> b -> x
+	renamed := models.Role{ID: a.ID, Name: "b", Parents: []string{"x"}}
+	replaced := ReplaceRole(roles, renamed)
+	if _, exists := replaced["a"]; exists {
+		t.Error("ReplaceRole() kept the previous name")
+	}
+	if got := replaced["x"].Parents; len(got) != 1 || got[0] != "b" {
+		t.Errorf("x parents = %v, want [b]", got)
+	}
+	if cycle := FindCycle(replaced, renamed.Name, renamed.Parents); strings.Join(cycle, " -> ") != "b -> x -> b" {
+		t.Errorf("FindCycle() after rename = %v, want b -> x -> b", cycle)
+	}
+	if got := roles["x"].Parents; len(got) != 1 || got[0] != "a" {
+		t.Errorf("ReplaceRole() changed the original roles: x parents = %v", got)
+	}
+
+	// Without a rename only the role itself changes
+	updated := models.Role{ID: a.ID, Name: "a", Parents: []string{"c"}}
+	replaced = ReplaceRole(roles, updated)
+	if len(replaced) != 2 || replaced["a"].Parents[0] != "c" || replaced["x"].Parents[0] != "a" {
+		t.Errorf("ReplaceRole() without rename = %v", replaced)
+	}
+
+	// A new role has no ID and is added
+	created := models.Role{Name: "c", Parents: []string{"x"}}
+	replaced = ReplaceRole(roles, created)
+	if len(replaced) != 3 || replaced["x"].Parents[0] != "a" {
+		t.Errorf("ReplaceRole() for a new role = %v", replaced)
+	}
+}
+
+func TestGroupPermissionsWithheld(t *testing.T) {
+	roles := roleMap(
+		models.Role{Name: "user", Permissions: []string{"users:read"}},
+		models.Role{Name: "support", Permissions: []string{"users:update"}, Parents: []string{"user"}},
+	)
+	groups := []models.AccessGroup{
+		{Name: "support", Roles: []string{"support"}},
+		{Name: "billing", Permissions: []string{"read_user", "billing:refund"}},
+	}
+	granted := GroupPermissions(roles, groups)
+	if len(granted) != 3 || !granted["users:read"] || !granted["users:update"] || !granted["billing:refund"] {
+		t.Fatalf("GroupPermissions() = %v", granted)
+	}
+
+	grants := &Grants{
+		Allow: []Rule{{Permission: "users:*", Effect: EffectAllow}},
+		Deny:  []Rule{{Permission: "users:update", Effect: EffectDeny}},
+	}
+	if got := strings.Join(grants.Withheld(granted), ", "); got != "billing:refund, users:update" {
+		t.Errorf("Withheld() = %s, want billing:refund, users:update", got)
+	}
+	if withheld := grants.Withheld(RolePermissions(roles, []string{"user"})); withheld != nil {
+		t.Errorf("Withheld() = %v, want nil", withheld)
+	}
+}
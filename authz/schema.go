@@ -0,0 +1,284 @@
+package authz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The relation schema declares object types, the relations that can be
+// written as tuples on them and the permissions computed from those
+// relations:
+//
+//	type user
+//
+//	type group
+//	  relation member: user | group#member
+//
+//	type document
+//	  relation parent: folder
+//	  relation owner: user
+//	  relation viewer: user | group#member
+//	  permission edit = owner
+//	  permission view = edit | viewer | parent->view
+//
+// A relation lists the subject types it accepts; "group#member" accepts the
+// members of a group. A permission is a union of relations or permissions
+// on the same object and of "tupleset->relation" terms, which follow the
+// tupleset relation to another object and check a relation there. Lines
+// starting with "//" are comments.
+
+// Schema is a parsed relation schema.
+type Schema struct {
+	Types map[string]*TypeDefinition
+}
+
+// TypeDefinition describes one object type.
+type TypeDefinition struct {
+	Name      string
+	Relations map[string]*RelationDefinition
+}
+
+// RelationDefinition is either a direct relation, stored as tuples, or a
+// permission computed from other relations.
+type RelationDefinition struct {
+	Name         string
+	Permission   bool
+	SubjectTypes []SubjectType
+	Union        []UsersetTerm
+}
+
+// SubjectType is a subject accepted by a direct relation. A non-empty
+// Relation denotes a userset such as "group#member".
+type SubjectType struct {
+	Type     string
+	Relation string
+}
+
+// UsersetTerm is one operand of a permission. When Tupleset is set the term
+// reads "Tupleset->Relation".
+type UsersetTerm struct {
+	Tupleset string
+	Relation string
+}
+
+// ParseSchema parses and validates schema source.
+func ParseSchema(source string) (*Schema, error) {
+	schema := &Schema{Types: make(map[string]*TypeDefinition)}
+	var current *TypeDefinition
+
+	for number, line := range strings.Split(source, "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(strings.Trim(strings.TrimSpace(line), "{}"))
+		if line == "" {
+			continue
+		}
+
+		keyword, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+		switch keyword {
+		case "type":
+			if !validIdentifier(rest) {
+				return nil, fmt.Errorf("line %d: invalid type name %q", number+1, rest)
+			}
+			if _, exists := schema.Types[rest]; exists {
+				return nil, fmt.Errorf("line %d: type %s is defined twice", number+1, rest)
+			}
+			current = &TypeDefinition{Name: rest, Relations: make(map[string]*RelationDefinition)}
+			schema.Types[rest] = current
+		case "relation", "permission":
+			if current == nil {
+				return nil, fmt.Errorf("line %d: %s outside of a type", number+1, keyword)
+			}
+			separator := ":"
+			if keyword == "permission" {
+				separator = "="
+			}
+			name, expression, found := strings.Cut(rest, separator)
+			name = strings.TrimSpace(name)
+			if !found || !validIdentifier(name) {
+				return nil, fmt.Errorf("line %d: expected \"%s name %s ...\"", number+1, keyword, separator)
+			}
+			if _, exists := current.Relations[name]; exists {
+				return nil, fmt.Errorf("line %d: %s.%s is defined twice", number+1, current.Name, name)
+			}
+			definition := &RelationDefinition{Name: name, Permission: keyword == "permission"}
+			for _, part := range strings.Split(expression, "|") {
+				part = strings.TrimSpace(part)
+				if part == "" {
+					return nil, fmt.Errorf("line %d: empty term in %s.%s", number+1, current.Name, name)
+				}
+				if definition.Permission {
+					term := UsersetTerm{Relation: part}
+					if tupleset, relation, ok := strings.Cut(part, "->"); ok {
+						term = UsersetTerm{Tupleset: strings.TrimSpace(tupleset), Relation: strings.TrimSpace(relation)}
+					}
+					definition.Union = append(definition.Union, term)
+				} else {
+					subjectType, relation, _ := strings.Cut(part, "#")
+					definition.SubjectTypes = append(definition.SubjectTypes, SubjectType{Type: subjectType, Relation: relation})
+				}
+			}
+			current.Relations[name] = definition
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %q", number+1, keyword)
+		}
+	}
+
+	if err := schema.validate(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// validate checks that every reference in the schema resolves.
+func (s *Schema) validate() error {
+	for _, typeDef := range s.Types {
+		for _, relation := range typeDef.Relations {
+			for _, subject := range relation.SubjectTypes {
+				target, exists := s.Types[subject.Type]
+				if !exists {
+					return fmt.Errorf("%s.%s: unknown subject type %s", typeDef.Name, relation.Name, subject.Type)
+				}
+				if subject.Relation != "" && target.Relations[subject.Relation] == nil {
+					return fmt.Errorf("%s.%s: unknown relation %s#%s", typeDef.Name, relation.Name, subject.Type, subject.Relation)
+				}
+			}
+			for _, term := range relation.Union {
+				if term.Tupleset == "" {
+					if typeDef.Relations[term.Relation] == nil {
+						return fmt.Errorf("%s.%s: unknown relation %s", typeDef.Name, relation.Name, term.Relation)
+					}
+					continue
+				}
+				tupleset := typeDef.Relations[term.Tupleset]
+				if tupleset == nil || tupleset.Permission {
+					return fmt.Errorf("%s.%s: %s must be a relation of %s", typeDef.Name, relation.Name, term.Tupleset, typeDef.Name)
+				}
+				for _, subject := range tupleset.SubjectTypes {
+					target, exists := s.Types[subject.Type]
+					if !exists {
+						return fmt.Errorf("%s.%s: unknown subject type %s", typeDef.Name, term.Tupleset, subject.Type)
+					}
+					if target.Relations[term.Relation] == nil {
+						return fmt.Errorf("%s.%s: %s has no relation %s", typeDef.Name, relation.Name, subject.Type, term.Relation)
+					}
+				}
+			}
+		}
+		if cycle := typeDef.permissionCycle(); cycle != nil {
+			return fmt.Errorf("%s: permissions form a cycle: %s", typeDef.Name, strings.Join(cycle, " -> "))
+		}
+	}
+	return nil
+}
+
+// permissionCycle returns the permissions of the type that are computed
+// from each other on the same object, first one repeated at the end, or nil
+// when there are none. Such permissions could never be granted. Cycles
+// through tuplesets are allowed, since they move to another object.
+func (t *TypeDefinition) permissionCycle() []string {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			for i, step := range path {
+				if step == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, term := range t.Relations[name].Union {
+			if term.Tupleset == "" {
+				if cycle := visit(term.Relation); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+
+	names := make([]string, 0, len(t.Relations))
+	for name := range t.Relations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// Relation looks up a relation or permission of an object type.
+func (s *Schema) Relation(objectType, name string) (*RelationDefinition, bool) {
+	typeDef, exists := s.Types[objectType]
+	if !exists {
+		return nil, false
+	}
+	relation, exists := typeDef.Relations[name]
+	return relation, exists
+}
+
+// ValidateTuple checks that a tuple may be written under the schema.
+func (s *Schema) ValidateTuple(object, relation, subject string) error {
+	objectType, _, err := SplitObject(object)
+	if err != nil {
+		return err
+	}
+	definition, exists := s.Relation(objectType, relation)
+	if !exists {
+		return fmt.Errorf("type %s has no relation %s", objectType, relation)
+	}
+	if definition.Permission {
+		return fmt.Errorf("%s.%s is a permission and cannot be written", objectType, relation)
+	}
+
+	subjectObject, subjectRelation, _ := strings.Cut(subject, "#")
+	subjectType, _, err := SplitObject(subjectObject)
+	if err != nil {
+		return err
+	}
+	for _, allowed := range definition.SubjectTypes {
+		if allowed.Type == subjectType && allowed.Relation == subjectRelation {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s.%s does not accept subject %s", objectType, relation, subject)
+}
+
+// SplitObject splits "type:id" into its parts.
+func SplitObject(object string) (string, string, error) {
+	objectType, id, found := strings.Cut(object, ":")
+	if !found || !validIdentifier(objectType) || id == "" {
+		return "", "", fmt.Errorf("invalid object %q, expected type:id", object)
+	}
+	return objectType, id, nil
+}
+
+func validIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package authz
+
+import (
+	"strings"
+	"testing"
+)
+
+const documentSchema = `
+type user
+
+type group
+  relation member: user | group#member
+
+type folder
+  relation parent: folder
+  relation viewer: user
+  permission view = viewer | parent->view
+
+type document
+  relation parent: folder
+  relation owner: user
+  relation viewer: user | group#member
+  permission edit = owner
+  permission view = edit | viewer | parent->view
+`
+
+func TestParseSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		// err is a substring of the expected error, empty when the schema
+		// is valid
+		err string
+	}{
+		{name: "valid", source: documentSchema},
+		{name: "comments and braces", source: "type user {\n}\n// a comment\ntype doc {\n  relation owner: user // owners\n}\n"},
+		{name: "empty", source: ""},
+		{name: "unknown subject type", source: "type doc\n  relation owner: user\n", err: "doc.owner: unknown subject type user"},
+		{name: "unknown userset relation", source: "type user\ntype group\n  relation member: user\ntype doc\n  relation viewer: group#admin\n", err: "unknown relation group#admin"},
+		{name: "unknown permission term", source: "type user\ntype doc\n  relation owner: user\n  permission view = owner | editor\n", err: "doc.view: unknown relation editor"},
+		{name: "unknown tupleset subject type", source: "type doc\n  relation parent: folder\n  permission view = parent->view\n", err: "unknown subject type folder"},
+		{name: "unknown tupleset", source: "type user\ntype doc\n  relation owner: user\n  permission view = parent->view\n", err: "parent must be a relation of doc"},
+		{name: "permission as tupleset", source: "type user\ntype doc\n  relation owner: user\n  permission edit = owner\n  permission view = edit->owner\n", err: "edit must be a relation of doc"},
+		{name: "tupleset target lacks relation", source: "type user\ntype folder\n  relation owner: user\ntype doc\n  relation parent: folder\n  permission view = parent->view\n", err: "folder has no relation view"},
+		{name: "recursive tupleset", source: "type user\ntype folder\n  relation parent: folder\n  relation viewer: user\n  permission view = viewer | parent->view\n"},
+		{name: "self cycle", source: "type user\ntype doc\n  relation owner: user\n  permission view = owner | view\n", err: "doc: permissions form a cycle: view -> view"},
+		{name: "cycle", source: "type user\ntype doc\n  relation owner: user\n  permission edit = owner | view\n  permission view = edit\n", err: "doc: permissions form a cycle: edit -> view -> edit"},
+		{name: "duplicate type", source: "type user\ntype user\n", err: "line 2: type user is defined twice"},
+		{name: "duplicate relation", source: "type user\ntype doc\n  relation owner: user\n  relation owner: user\n", err: "line 4: doc.owner is defined twice"},
+		{name: "relation outside type", source: "relation owner: user\n", err: "line 1: relation outside of a type"},
+		{name: "invalid type name", source: "type my-doc\n", err: `line 1: invalid type name "my-doc"`},
+		{name: "missing separator", source: "type user\ntype doc\n  permission view owner\n", err: `expected "permission name = ..."`},
+		{name: "empty term", source: "type user\ntype doc\n  relation owner: user |\n", err: "line 3: empty term in doc.owner"},
+		{name: "unexpected keyword", source: "type user\n  define owner: user\n", err: `line 2: unexpected "define"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schema, err := ParseSchema(test.source)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("ParseSchema() error = %v", err)
+				}
+				if schema == nil {
+					t.Fatal("ParseSchema() returned no schema")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("ParseSchema() error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestParseSchemaTerms(t *testing.T) {
+	schema, err := ParseSchema(documentSchema)
+	if err != nil {
+		t.Fatalf("ParseSchema() error = %v", err)
+	}
+
+	view, ok := schema.Relation("document", "view")
+	if !ok || !view.Permission {
+		t.Fatalf("document.view = %+v, want a permission", view)
+	}
+	want := []UsersetTerm{{Relation: "edit"}, {Relation: "viewer"}, {Tupleset: "parent", Relation: "view"}}
+	if len(view.Union) != len(want) {
+		t.Fatalf("document.view union = %+v, want %+v", view.Union, want)
+	}
+	for i := range want {
+		if view.Union[i] != want[i] {
+			t.Errorf("document.view union[%d] = %+v, want %+v", i, view.Union[i], want[i])
+		}
+	}
+
+	member, ok := schema.Relation("group", "member")
+	if !ok || member.Permission {
+		t.Fatalf("group.member = %+v, want a relation", member)
+	}
+	subjects := []SubjectType{{Type: "user"}, {Type: "group", Relation: "member"}}
+	for i := range subjects {
+		if i >= len(member.SubjectTypes) || member.SubjectTypes[i] != subjects[i] {
+			t.Errorf("group.member subject types = %+v, want %+v", member.SubjectTypes, subjects)
+			break
+		}
+	}
+}
+
+func TestValidateTuple(t *testing.T) {
+	schema, err := ParseSchema(documentSchema)
+	if err != nil {
+		t.Fatalf("ParseSchema() error = %v", err)
+	}
+
+	tests := []struct {
+		object, relation, subject string
+		valid                     bool
+	}{
+		{"document:1", "owner", "user:alice", true},
+		{"document:1", "viewer", "group:eng#member", true},
+		{"document:1", "parent", "folder:root", true},
+		{"document:1", "viewer", "group:eng", false},
+		{"document:1", "owner", "group:eng#member", false},
+		{"document:1", "view", "user:alice", false},
+		{"document:1", "reader", "user:alice", false},
+		{"document", "owner", "user:alice", false},
+		{"document:1", "owner", "alice", false},
+	}
+	for _, test := range tests {
+		err := schema.ValidateTuple(test.object, test.relation, test.subject)
+		if (err == nil) != test.valid {
+			t.Errorf("ValidateTuple(%q, %q, %q) error = %v, want valid %v", test.object, test.relation, test.subject, err, test.valid)
+		}
+	}
+}
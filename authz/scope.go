@@ -0,0 +1,53 @@
+package authz
+
+import (
+	"strings"
+	"unified-go-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// globalNamespaces are the permission namespaces of platform
+// administration: their data applies to every organization, so their
+// routes refuse requests made inside one.
+var globalNamespaces = map[string]bool{
+	"access_reviews": true,
+	"policies":       true,
+	"rbac":           true,
+	"relations":      true,
+	"role_requests":  true,
+}
+
+// globalPermissions are the other permissions of platform administration.
+var globalPermissions = []string{"orgs:create"}
+
+// OrgScoped reports whether the roles and access groups of an organization
+// may grant the permission: neither a pattern reaching every namespace nor
+// one of platform administration.
+func OrgScoped(name string) bool {
+	name = Canonical(name)
+	namespace, _, _ := strings.Cut(name, ":")
+	if namespace == "*" || globalNamespaces[namespace] {
+		return false
+	}
+	for _, global := range globalPermissions {
+		if Matches(name, global) {
+			return false
+		}
+	}
+	return true
+}
+
+// OwnRoles keeps the roles owned by org, or the global ones for
+// primitive.NilObjectID. Inside an organization only its own roles can be
+// held, inherited from or granted by its teams and access groups, so that
+// it never hands out the global roles of platform administration.
+func OwnRoles(roles map[string]models.Role, org primitive.ObjectID) map[string]models.Role {
+	own := make(map[string]models.Role, len(roles))
+	for name, role := range roles {
+		if role.OrgID == org {
+			own[name] = role
+		}
+	}
+	return own
+}
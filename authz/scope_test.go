@@ -0,0 +1,45 @@
+package authz
+
+import (
+	"testing"
+	"unified-go-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOrgScoped(t *testing.T) {
+	tests := map[string]bool{
+		"*":             false,
+		"*:read":        false,
+		"policies:read": false,
+		"rbac:*":        false,
+		"orgs:create":   false,
+		"orgs:*":        false,
+		"users:*":       true,
+		"update_user":   true,
+		"orgs:update":   true,
+	}
+	for name, want := range tests {
+		if got := OrgScoped(name); got != want {
+			t.Errorf("OrgScoped(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestOwnRoles(t *testing.T) {
+	org := primitive.NewObjectID()
+	roles := roleMap(
+		models.Role{Name: "admin"},
+		models.Role{Name: "member", OrgID: org},
+		models.Role{Name: "other", OrgID: primitive.NewObjectID()},
+	)
+
+	own := OwnRoles(roles, org)
+	if _, exists := own["member"]; !exists || len(own) != 1 {
+		t.Errorf("OwnRoles(org) = %v, want only member", own)
+	}
+	global := OwnRoles(roles, primitive.NilObjectID)
+	if _, exists := global["admin"]; !exists || len(global) != 1 {
+		t.Errorf("OwnRoles(global) = %v, want only admin", global)
+	}
+}
@@ -0,0 +1,89 @@
+package authz
+
+import (
+	"context"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/tenant"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoadTeams fetches the teams owned by org, or the global ones for
+// primitive.NilObjectID, keyed by ID.
+func LoadTeams(ctx context.Context, org primitive.ObjectID) (map[primitive.ObjectID]models.Team, error) {
+	cursor, err := database.MongoClient.Database("mdmdb").Collection("teams").Find(ctx, tenant.OwnedBy(org))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	teams := make(map[primitive.ObjectID]models.Team)
+	for cursor.Next(ctx) {
+		var team models.Team
+		if err := cursor.Decode(&team); err != nil {
+			return nil, err
+		}
+		teams[team.ID] = team
+	}
+	return teams, cursor.Err()
+}
+
+// TeamPath returns the team followed by its ancestors, nearest first.
+// Unknown parents end the path and a cycle is cut where it closes.
+func TeamPath(teams map[primitive.ObjectID]models.Team, id primitive.ObjectID) []models.Team {
+	var path []models.Team
+	seen := make(map[primitive.ObjectID]bool)
+	for !id.IsZero() && !seen[id] {
+		team, exists := teams[id]
+		if !exists {
+			break
+		}
+		seen[id] = true
+		path = append(path, team)
+		id = team.ParentID
+	}
+	return path
+}
+
+// IsTeamAdmin reports whether the user administers the team, either
+// directly or as an admin of one of its ancestors.
+func IsTeamAdmin(user models.User, teams map[primitive.ObjectID]models.Team, id primitive.ObjectID) bool {
+	admin := make(map[primitive.ObjectID]bool)
+	for _, membership := range user.Teams {
+		if membership.Admin {
+			admin[membership.TeamID] = true
+		}
+	}
+	for _, team := range TeamPath(teams, id) {
+		if admin[team.ID] {
+			return true
+		}
+	}
+	return false
+}
+
+// addTeams adds the roles of the user's teams and their ancestors, and the
+// roles assigned to the user in each team.
+func (g *Grants) addTeams(user models.User, teams map[primitive.ObjectID]models.Team, roles map[string]models.Role) {
+	for _, membership := range user.Teams {
+		path := TeamPath(teams, membership.TeamID)
+		if len(path) == 0 {
+			continue
+		}
+
+		source := "team:" + path[0].Name
+		for _, name := range membership.Roles {
+			g.addRole(roles, name, source+" (assigned)", make(map[string]bool))
+		}
+		for _, team := range path {
+			via := source
+			if team.ID != path[0].ID {
+				via = source + " > team:" + team.Name
+			}
+			for _, name := range team.Roles {
+				g.addRole(roles, name, via, make(map[string]bool))
+			}
+		}
+	}
+}
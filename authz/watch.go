@@ -0,0 +1,33 @@
+package authz
+
+import (
+	"context"
+	"time"
+	"unified-go-backend/utils"
+)
+
+// Watch reloads the cached access policies and relation schema every
+// interval until ctx is done.
+func Watch(ctx context.Context, interval time.Duration) error {
+	reload(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			reload(ctx)
+		}
+	}
+}
+
+func reload(ctx context.Context) {
+	if err := ReloadPolicies(ctx); err != nil {
+		utils.Logger.Errorf("Watch: Failed to reload policies: %v", err)
+	}
+	if err := ReloadSchema(ctx); err != nil {
+		utils.Logger.Errorf("Watch: Failed to reload relation schema: %v", err)
+	}
+}
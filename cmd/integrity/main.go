@@ -0,0 +1,52 @@
+// Command integrity reports references to roles, access groups, teams and
+// organizations that do not exist. It exits with status 1 when it finds
+// any.
+//
+//	go run ./cmd/integrity [-json]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"unified-go-backend/config"
+	"unified-go-backend/database"
+	"unified-go-backend/integrity"
+	"unified-go-backend/utils"
+)
+
+func main() {
+	jsonOutput := flag.Bool("json", false, "Print the orphaned references as JSON")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+	utils.InitLogger()
+
+	database.ConnectDB(cfg)
+	defer database.DisconnectDB()
+
+	orphans, err := integrity.Check(context.Background())
+	if err != nil {
+		utils.Logger.Fatalf("Failed to check references: %v", err)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(orphans); err != nil {
+			utils.Logger.Fatalf("Failed to encode report: %v", err)
+		}
+	} else {
+		for _, orphan := range orphans {
+			fmt.Printf("%s %s %s: %v\n", orphan.Collection, orphan.ID.Hex(), orphan.Field, orphan.Value)
+		}
+		fmt.Printf("%d orphaned references\n", len(orphans))
+	}
+
+	if len(orphans) > 0 {
+		database.DisconnectDB()
+		os.Exit(1)
+	}
+}
@@ -4,11 +4,16 @@ import (
 	"context"
 	// "flag"
 	// "fmt"
+	"unified-go-backend/accessreview"
+	"unified-go-backend/authz"
 	"unified-go-backend/config"
 	"unified-go-backend/database"
 	_ "unified-go-backend/docs"
 	"unified-go-backend/middleware"
+	"unified-go-backend/migrations"
+	"unified-go-backend/privacy"
 	"unified-go-backend/routes"
+	"unified-go-backend/userquery"
 	"unified-go-backend/utils"
 	"unified-go-backend/worker"
 
@@ -51,6 +56,26 @@ func main() {
 	database.ConnectRedis(cfg)
 	defer database.DisconnectRedis()
 
+	// Cache resolved permissions, shared between replicas through Redis
+	authz.ConfigureCache(cfg.PermissionCacheSize, cfg.PermissionCacheTTL)
+
+	// Apply pending data migrations
+	if err := migrations.Run(context.Background()); err != nil {
+		utils.Logger.Fatalf("Failed to apply migrations: %v", err)
+	}
+	if err := authz.EnsureRelationIndexes(context.Background()); err != nil {
+		utils.Logger.Fatalf("Failed to create relation tuple indexes: %v", err)
+	}
+	if err := accessreview.EnsureIndexes(context.Background()); err != nil {
+		utils.Logger.Fatalf("Failed to create access review indexes: %v", err)
+	}
+	if err := userquery.EnsureIndexes(context.Background()); err != nil {
+		utils.Logger.Fatalf("Failed to create user indexes: %v", err)
+	}
+	if err := privacy.EnsureIndexes(context.Background()); err != nil {
+		utils.Logger.Fatalf("Failed to create data export indexes: %v", err)
+	}
+
 	// if *seedFlag {
 	//     seed.SeedData(cfg)
 	//     fmt.Println("Database seeded with dummy data.")
@@ -64,6 +89,47 @@ func main() {
 		return worker.ProcessEmailVerificationJobs(ctx, cfg)
 	})
 
+	// Deliver queued notification emails
+	g.Go(func() error {
+		return worker.ProcessNotificationJobs(ctx, cfg)
+	})
+
+	// Remove temporary role grants once they expire
+	g.Go(func() error {
+		return worker.ExpireRoleGrants(ctx, cfg.RoleGrantCheckInterval)
+	})
+
+	// Complete access review campaigns once they end
+	g.Go(func() error {
+		return worker.CompleteAccessReviews(ctx, cfg.AccessReviewCheckInterval)
+	})
+
+	// Permanently remove deleted users once the retention period is over
+	g.Go(func() error {
+		return worker.PurgeDeletedUsers(ctx, cfg.UserPurgeCheckInterval, cfg.UserRetentionPeriod)
+	})
+
+	// Reinstate suspended users once their suspension expires
+	g.Go(func() error {
+		return worker.LiftExpiredSuspensions(ctx, cfg.SuspensionCheckInterval)
+	})
+
+	// Build data exports, drop expired ones and erase accounts once their
+	// deletion cooling-off period is over
+	g.Go(func() error {
+		return worker.ProcessPrivacyRequests(ctx, cfg.PrivacyCheckInterval, cfg.DataExportTTL)
+	})
+
+	// Keep the access policies and relation schema in sync with the database
+	g.Go(func() error {
+		return authz.Watch(ctx, cfg.PolicyReloadInterval)
+	})
+
+	// Drop cached permissions as other replicas change roles and users
+	g.Go(func() error {
+		return authz.WatchInvalidations(ctx)
+	})
+
 	router := gin.Default()
 
 	// Create a new RateLimiter instance and apply the rate limiter middleware globally
@@ -74,6 +140,34 @@ func main() {
 	routes.AuthRoutes(router, cfg)
 	routes.UserRoutes(router, cfg)
 	routes.AccessGroupRoutes(router, cfg)
+	routes.RoleRoutes(router, cfg)
+	routes.PermissionRoutes(router, cfg)
+	routes.AuthzRoutes(router, cfg)
+	routes.PolicyRoutes(router, cfg)
+	routes.RelationRoutes(router, cfg)
+	routes.RoleRequestRoutes(router, cfg)
+	routes.AccessReviewRoutes(router, cfg)
+	routes.OrganizationRoutes(router, cfg)
+	routes.TeamRoutes(router, cfg)
+	routes.RBACRoutes(router, cfg)
+
+	// Store the route-declared permissions and make sure each one can be granted
+	if err := authz.SyncCatalog(context.Background()); err != nil {
+		utils.Logger.Fatalf("Failed to sync permission catalog: %v", err)
+	}
+	for _, name := range authz.UndescribedPermissions() {
+		utils.Logger.Warnf("Permission %s is required by a route but has no description", name)
+	}
+	ungrantable, err := authz.UngrantablePermissions(context.Background())
+	if err != nil {
+		utils.Logger.Fatalf("Failed to check permission catalog: %v", err)
+	}
+	if len(ungrantable) > 0 {
+		if cfg.StrictPermissions {
+			utils.Logger.Fatalf("Permissions required by routes are not granted by any role or access group: %v", ungrantable)
+		}
+		utils.Logger.Warnf("Permissions required by routes are not granted by any role or access group: %v", ungrantable)
+	}
 
 	// Serve Swagger documentation
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
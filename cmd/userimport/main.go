@@ -0,0 +1,129 @@
+// Command userimport imports users in bulk from a CSV or NDJSON file, like
+// the import endpoint but in the foreground. It prints the rows that
+// failed and exits with status 1 when there are any.
+//
+//	go run ./cmd/userimport -f users.csv [-format csv|ndjson] [-org slug]
+//	    [-dry-run] [-upsert] [-verified] [-roles a,b] [-access-groups a,b]
+//	    [-json]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unified-go-backend/config"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/tenant"
+	"unified-go-backend/userimport"
+	"unified-go-backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func main() {
+	input := flag.String("f", "", "CSV or NDJSON file to import")
+	format := flag.String("format", "", "File format, csv or ndjson, by default from the file extension")
+	org := flag.String("org", "", "Import into this organization, by ID or slug")
+	dryRun := flag.Bool("dry-run", false, "Validate every row without importing anything")
+	upsert := flag.Bool("upsert", false, "Update the users that already exist")
+	verified := flag.Bool("verified", false, "Mark the imported users as verified")
+	roles := flag.String("roles", "", "Comma-separated roles of the rows naming none")
+	accessGroups := flag.String("access-groups", "", "Comma-separated access groups of the rows naming none")
+	jsonOutput := flag.Bool("json", false, "Print the report as JSON")
+	flag.Parse()
+
+	if *input == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *format == "" {
+		*format = userimport.FormatOf(*input)
+	}
+
+	cfg := config.LoadConfig()
+	utils.InitLogger()
+
+	file, err := os.Open(*input)
+	if err != nil {
+		utils.Logger.Fatalf("Failed to open %s: %v", *input, err)
+	}
+	rows, err := userimport.Read(file, *format)
+	file.Close()
+	if err != nil {
+		utils.Logger.Fatalf("Failed to read %s: %v", *input, err)
+	}
+
+	database.ConnectDB(cfg)
+	defer database.DisconnectDB()
+
+	// Updates are announced to the servers so they drop cached permissions
+	database.ConnectRedis(cfg)
+	defer database.DisconnectRedis()
+
+	ctx := context.Background()
+	orgID := primitive.NilObjectID
+	if *org != "" {
+		organization, err := tenant.FindOrganization(ctx, *org)
+		if err != nil {
+			utils.Logger.Fatalf("Failed to find organization %s: %v", *org, err)
+		}
+		orgID = organization.ID
+	}
+
+	options := models.UserImportOptions{
+		Format:       *format,
+		DryRun:       *dryRun,
+		Upsert:       *upsert,
+		Verified:     *verified,
+		Roles:        splitNames(*roles),
+		AccessGroups: splitNames(*accessGroups),
+	}
+	report, err := userimport.Run(ctx, rows, orgID, options, nil, func(processed int) {
+		utils.Logger.Infof("Processed %d of %d rows", processed, len(rows))
+	})
+	if err != nil {
+		utils.Logger.Errorf("Import interrupted: %v", err)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			utils.Logger.Fatalf("Failed to encode report: %v", err)
+		}
+	} else {
+		for _, rowError := range report.Errors {
+			fields := make([]string, 0, len(rowError.Errors))
+			for field, message := range rowError.Errors {
+				fields = append(fields, field+": "+message)
+			}
+			sort.Strings(fields)
+			fmt.Printf("line %d %s: %s\n", rowError.Line, rowError.Email, strings.Join(fields, ", "))
+		}
+		if *dryRun {
+			fmt.Print("Dry run, nothing imported. ")
+		}
+		fmt.Printf("%d rows: %d created, %d updated, %d failed\n", report.Total, report.Created, report.Updated, report.Failed)
+	}
+
+	if err != nil || report.Failed > 0 {
+		database.DisconnectRedis()
+		database.DisconnectDB()
+		os.Exit(1)
+	}
+}
+
+func splitNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -17,6 +18,49 @@ type Config struct {
 	SMTPPort      int
 	SMTPUser      string
 	SMTPPassword  string
+	// StrictPermissions makes startup fail when a route requires a
+	// permission that no role or access group grants.
+	StrictPermissions bool
+	// PolicyReloadInterval is how often access policies and the relation
+	// schema are reloaded from the database.
+	PolicyReloadInterval time.Duration
+	// RoleGrantCheckInterval is how often expired temporary role grants
+	// are removed.
+	RoleGrantCheckInterval time.Duration
+	// RoleGrantMaxDuration is the longest temporary role grant a user may
+	// request.
+	RoleGrantMaxDuration time.Duration
+	// AccessReviewCheckInterval is how often ended access review campaigns
+	// are completed.
+	AccessReviewCheckInterval time.Duration
+	// TenantBaseDomain enables selecting the organization by subdomain,
+	// e.g. acme.example.com for the base domain example.com.
+	TenantBaseDomain string
+	// UserRetentionPeriod is how long deleted users can be restored before
+	// they are purged.
+	UserRetentionPeriod time.Duration
+	// UserPurgeCheckInterval is how often deleted users past the retention
+	// period are purged.
+	UserPurgeCheckInterval time.Duration
+	// SuspensionCheckInterval is how often expired suspensions are lifted.
+	SuspensionCheckInterval time.Duration
+	// InvitationTTL is how long invited users can set their password.
+	InvitationTTL time.Duration
+	// DataExportTTL is how long a user's data export can be downloaded.
+	DataExportTTL time.Duration
+	// AccountDeletionCoolingOff is how long after requesting the deletion
+	// of their account users can still cancel it before it is erased.
+	AccountDeletionCoolingOff time.Duration
+	// PrivacyCheckInterval is how often data exports are built and accounts
+	// due for erasure are erased.
+	PrivacyCheckInterval time.Duration
+	// PermissionCacheSize is how many users' resolved permissions each
+	// replica keeps in memory; zero disables the permission cache.
+	PermissionCacheSize int
+	// PermissionCacheTTL bounds how long resolved permissions are served
+	// from the cache, and so how stale they can be when an invalidation is
+	// missed.
+	PermissionCacheTTL time.Duration
 }
 
 func LoadConfig() *Config {
@@ -39,5 +83,56 @@ func LoadConfig() *Config {
 		SMTPPort:      smtpPort,
 		SMTPUser:      os.Getenv("SMTP_USER"),
 		SMTPPassword:  os.Getenv("SMTP_PASSWORD"),
+
+		StrictPermissions:    os.Getenv("STRICT_PERMISSIONS") == "true",
+		PolicyReloadInterval: durationEnv("POLICY_RELOAD_INTERVAL", 30*time.Second),
+
+		RoleGrantCheckInterval: durationEnv("ROLE_GRANT_CHECK_INTERVAL", time.Minute),
+		RoleGrantMaxDuration:   durationEnv("ROLE_GRANT_MAX_DURATION", 24*time.Hour),
+
+		AccessReviewCheckInterval: durationEnv("ACCESS_REVIEW_CHECK_INTERVAL", 5*time.Minute),
+
+		TenantBaseDomain: os.Getenv("TENANT_BASE_DOMAIN"),
+
+		UserRetentionPeriod:    durationEnv("USER_RETENTION_PERIOD", 30*24*time.Hour),
+		UserPurgeCheckInterval: durationEnv("USER_PURGE_CHECK_INTERVAL", time.Hour),
+
+		SuspensionCheckInterval: durationEnv("SUSPENSION_CHECK_INTERVAL", time.Minute),
+		InvitationTTL:           durationEnv("INVITATION_TTL", 72*time.Hour),
+
+		DataExportTTL:             durationEnv("DATA_EXPORT_TTL", 7*24*time.Hour),
+		AccountDeletionCoolingOff: durationEnv("ACCOUNT_DELETION_COOLING_OFF", 14*24*time.Hour),
+		PrivacyCheckInterval:      durationEnv("PRIVACY_CHECK_INTERVAL", time.Minute),
+
+		PermissionCacheSize: intEnv("PERMISSION_CACHE_SIZE", 10000),
+		PermissionCacheTTL:  durationEnv("PERMISSION_CACHE_TTL", time.Minute),
+	}
+}
+
+// durationEnv parses the named environment variable as a duration, falling
+// back when it is unset.
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Fatalf("Invalid %s: %q", name, value)
+	}
+	return duration
+}
+
+// intEnv parses the named environment variable as a non-negative integer,
+// falling back when it is unset.
+func intEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		log.Fatalf("Invalid %s: %q", name, value)
 	}
+	return number
 }
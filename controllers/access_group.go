@@ -2,14 +2,23 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strings"
+	"unified-go-backend/authz"
 	"unified-go-backend/database"
+	"unified-go-backend/integrity"
 	"unified-go-backend/models"
+	"unified-go-backend/pagination"
+	"unified-go-backend/tenant"
+	"unified-go-backend/userquery"
 	"unified-go-backend/utils"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type AccessGroupController struct{}
@@ -20,13 +29,14 @@ func NewAccessGroupController() *AccessGroupController {
 
 // CreateAccessGroup godoc
 // @Summary Create a new access group
-// @Description Create a new access group with roles and permissions
+// @Description Create a new access group with existing roles, permissions and deny rules. Access groups of an organization only hold its own roles and cannot grant * or the permissions of platform administration.
 // @Tags access_group
 // @Accept json
 // @Produce json
 // @Param access_group body models.AccessGroup true "Access group data"
 // @Success 201 {object} models.AccessGroup
 // @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 409 {object} utils.ErrorResponse "Access group already exists"
 // @Failure 500 {object} utils.ErrorResponse "Internal server error"
 // @Router /api/v1/access_groups [post]
 // @Security BearerAuth
@@ -46,6 +56,17 @@ func (a *AccessGroupController) CreateAccessGroup(c *gin.Context) {
 		return
 	}
 
+	accessGroup.Permissions = authz.CanonicalList(accessGroup.Permissions)
+	accessGroup.Deny = authz.CanonicalList(accessGroup.Deny)
+	accessGroup.OrgID = tenant.ID(c)
+
+	if !validateAccessGroup(c, "CreateAccessGroup", accessGroup) {
+		return
+	}
+	if !uniqueAccessGroupName(c, "CreateAccessGroup", accessGroup.Name, primitive.NilObjectID) {
+		return
+	}
+
 	collection := database.MongoClient.Database("mdmdb").Collection("access_groups")
 	result, err := collection.InsertOne(context.TODO(), accessGroup)
 	if err != nil {
@@ -60,49 +81,47 @@ func (a *AccessGroupController) CreateAccessGroup(c *gin.Context) {
 }
 
 // ListAccessGroups godoc
-// @Summary List all access groups
-// @Description List all access groups
+// @Summary List access groups
+// @Description List access groups by name, a page at a time. Pass the next or prev cursor of a page to move to the neighbouring one.
 // @Tags access_group
 // @Produce json
-// @Success 200 {array} models.AccessGroup
+// @Param cursor query string false "Cursor of the page to fetch, none for the first page"
+// @Param limit query int false "Number of items per page" default(10)
+// @Param count query string false "Whether to count the access groups: exact, estimate or none" Enums(exact, estimate, none) default(none)
+// @Success 200 {object} utils.CursorResponse
+// @Failure 400 {object} utils.ErrorResponse "Validation error"
 // @Failure 500 {object} utils.ErrorResponse "Internal server error"
 // @Router /api/v1/access_groups [get]
 // @Security BearerAuth
 func (a *AccessGroupController) ListAccessGroups(c *gin.Context) {
-	collection := database.MongoClient.Database("mdmdb").Collection("access_groups")
-
-	var accessGroups []models.AccessGroup
-	cursor, err := collection.Find(context.TODO(), bson.M{})
-	if err != nil {
-		utils.Logger.Errorf("ListAccessGroups: Error fetching access groups: %v", err)
-		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching access groups", nil))
+	request, validationErrors := pagination.Parse(c.Request.URL.Query())
+	if validationErrors != nil {
+		utils.Logger.Errorf("ListAccessGroups: Validation error: %v", validationErrors)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
 		return
 	}
-	defer cursor.Close(context.TODO())
 
-	for cursor.Next(context.TODO()) {
-		var accessGroup models.AccessGroup
-		if err := cursor.Decode(&accessGroup); err != nil {
-			utils.Logger.Errorf("ListAccessGroups: Error decoding access group: %v", err)
-			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error decoding access group", nil))
-			return
-		}
-		accessGroups = append(accessGroups, accessGroup)
+	collection := database.MongoClient.Database("mdmdb").Collection("access_groups")
+	order := bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}
+	page, err := pagination.Find[models.AccessGroup](context.TODO(), collection, tenant.Filter(c), order, nil, request)
+	if err == pagination.ErrInvalidCursor {
+		utils.Logger.Errorf("ListAccessGroups: Invalid cursor: %s", request.Cursor)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"cursor": "is not a cursor returned by this listing"}))
+		return
 	}
-
-	if err := cursor.Err(); err != nil {
-		utils.Logger.Errorf("ListAccessGroups: Cursor error: %v", err)
-		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Cursor error", nil))
+	if err != nil {
+		utils.Logger.Errorf("ListAccessGroups: Error fetching access groups: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching access groups", nil))
 		return
 	}
 
-	utils.Logger.Infof("Fetched %d access groups", len(accessGroups))
-	c.JSON(http.StatusOK, accessGroups)
+	utils.Logger.Infof("Fetched %d access groups", len(page.Items))
+	c.JSON(http.StatusOK, utils.CreateCursorResponse(page.Items, request.Limit, page.Next, page.Prev, page.TotalCount, page.Estimated))
 }
 
 // UpdateAccessGroup godoc
 // @Summary Update an access group
-// @Description Update an access group's details
+// @Description Update an access group's details. Its roles and permissions must exist, and inside an organization the roles must be its own. Members reference the group by ID, so renaming it keeps them.
 // @Tags access_group
 // @Accept json
 // @Produce json
@@ -111,6 +130,7 @@ func (a *AccessGroupController) ListAccessGroups(c *gin.Context) {
 // @Success 200 {object} map[string]string "message": "Access group updated successfully"
 // @Failure 400 {object} utils.ErrorResponse "Invalid request"
 // @Failure 404 {object} utils.ErrorResponse "Access group not found"
+// @Failure 409 {object} utils.ErrorResponse "Access group already exists"
 // @Failure 500 {object} utils.ErrorResponse "Internal server error"
 // @Router /api/v1/access_groups/{id} [put]
 // @Security BearerAuth
@@ -138,16 +158,27 @@ func (a *AccessGroupController) UpdateAccessGroup(c *gin.Context) {
 		return
 	}
 
+	accessGroup.Permissions = authz.CanonicalList(accessGroup.Permissions)
+	accessGroup.Deny = authz.CanonicalList(accessGroup.Deny)
+	accessGroup.OrgID = tenant.ID(c)
+	if !validateAccessGroup(c, "UpdateAccessGroup", accessGroup) {
+		return
+	}
+	if !uniqueAccessGroupName(c, "UpdateAccessGroup", accessGroup.Name, objectId) {
+		return
+	}
+
 	collection := database.MongoClient.Database("mdmdb").Collection("access_groups")
 	update := bson.M{
 		"$set": bson.M{
 			"name":        accessGroup.Name,
 			"roles":       accessGroup.Roles,
 			"permissions": accessGroup.Permissions,
+			"deny":        accessGroup.Deny,
 		},
 	}
 
-	filter := bson.M{"_id": objectId}
+	filter := tenant.With(tenant.Filter(c), bson.M{"_id": objectId})
 	result, err := collection.UpdateOne(context.TODO(), filter, update)
 	if err != nil {
 		utils.Logger.Errorf("UpdateAccessGroup: Error updating access group: %v", err)
@@ -160,45 +191,330 @@ func (a *AccessGroupController) UpdateAccessGroup(c *gin.Context) {
 		return
 	}
 
+	authz.InvalidateAll(context.TODO())
+
 	utils.Logger.Infof("Access group updated successfully: %s", id)
 	c.JSON(http.StatusOK, gin.H{"message": "Access group updated successfully"})
 }
 
 // DeleteAccessGroup godoc
 // @Summary Delete an access group
-// @Description Delete an access group by ID
+// @Description Delete an access group by ID. By default a group that still has members cannot be deleted; cascade=strip removes it from its members and cascade=reassign moves its members to the fallback group.
 // @Tags access_group
 // @Produce json
 // @Param id path string true "Access Group ID"
+// @Param cascade query string false "What to do with the members: block, strip or reassign" Enums(block, strip, reassign)
+// @Param fallback query string false "ID of the access group taking over the members, required with cascade=reassign"
 // @Success 200 {object} map[string]string "message": "Access group deleted successfully"
 // @Failure 400 {object} utils.ErrorResponse "Invalid request"
 // @Failure 404 {object} utils.ErrorResponse "Access group not found"
+// @Failure 409 {object} utils.ErrorResponse "Access group is still in use"
 // @Failure 500 {object} utils.ErrorResponse "Internal server error"
 // @Router /api/v1/access_groups/{id} [delete]
 // @Security BearerAuth
 func (a *AccessGroupController) DeleteAccessGroup(c *gin.Context) {
-	id := c.Param("id")
-	objectId, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		utils.Logger.Errorf("DeleteAccessGroup: Invalid access group ID: %v", err)
-		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid access group ID", nil))
+	accessGroup, ok := findAccessGroupByParam(c, "DeleteAccessGroup")
+	if !ok {
 		return
 	}
 
-	collection := database.MongoClient.Database("mdmdb").Collection("access_groups")
-	filter := bson.M{"_id": objectId}
-	result, err := collection.DeleteOne(context.TODO(), filter)
+	mode := c.DefaultQuery("cascade", integrity.CascadeBlock)
+	if !integrity.ValidCascade(mode) {
+		utils.Logger.Errorf("DeleteAccessGroup: Invalid cascade mode: %s", mode)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"cascade": "must be block, strip or reassign"}))
+		return
+	}
+	var fallback primitive.ObjectID
+	if mode == integrity.CascadeReassign {
+		fallbackID, err := primitive.ObjectIDFromHex(c.Query("fallback"))
+		if err == nil && fallbackID != accessGroup.ID {
+			// The fallback must belong to the same organization
+			err = database.MongoClient.Database("mdmdb").Collection("access_groups").FindOne(context.TODO(),
+				tenant.With(tenant.OwnedBy(accessGroup.OrgID), bson.M{"_id": fallbackID}),
+			).Err()
+			if err != nil && err != mongo.ErrNoDocuments {
+				utils.Logger.Errorf("DeleteAccessGroup: Error fetching fallback access group: %v", err)
+				c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching access group", nil))
+				return
+			}
+		}
+		if err != nil || fallbackID == accessGroup.ID {
+			utils.Logger.Errorf("DeleteAccessGroup: Invalid fallback access group: %s", c.Query("fallback"))
+			c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"fallback": "must be another access group of the same organization"}))
+			return
+		}
+		fallback = fallbackID
+	}
+
+	err := integrity.DeleteAccessGroup(context.TODO(), accessGroup, mode, fallback)
+	var inUse *integrity.InUseError
+	if errors.As(err, &inUse) {
+		utils.Logger.Errorf("DeleteAccessGroup: Access group %s is %v", accessGroup.Name, inUse)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Access group is still in use", inUse.Details()))
+		return
+	}
 	if err != nil {
 		utils.Logger.Errorf("DeleteAccessGroup: Error deleting access group: %v", err)
 		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error deleting access group", nil))
 		return
 	}
-	if result.DeletedCount == 0 {
-		utils.Logger.Errorf("DeleteAccessGroup: Access group not found with ID: %s", id)
-		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Access group not found", nil))
+
+	authz.InvalidateAll(context.TODO())
+
+	utils.Logger.Infof("Access group deleted successfully: %s (cascade %s)", accessGroup.Name, mode)
+	c.JSON(http.StatusOK, gin.H{"message": "Access group deleted successfully"})
+}
+
+// ListAccessGroupMembers godoc
+// @Summary List access group members
+// @Description List the users that belong to an access group. Users are shown as models.UserListItem, or as models.UserAdminView to callers with users:read_sensitive.
+// @Tags access_group
+// @Produce json
+// @Param id path string true "Access Group ID"
+// @Success 200 {array} models.UserListItem
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Access group not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/access_groups/{id}/members [get]
+// @Security BearerAuth
+func (a *AccessGroupController) ListAccessGroupMembers(c *gin.Context) {
+	accessGroup, ok := findAccessGroupByParam(c, "ListAccessGroupMembers")
+	if !ok {
 		return
 	}
 
-	utils.Logger.Infof("Access group deleted successfully: %s", id)
-	c.JSON(http.StatusOK, gin.H{"message": "Access group deleted successfully"})
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	users := []models.User{}
+	cursor, err := collection.Find(context.TODO(), userquery.Live(integrity.AccessGroupMembers(accessGroup)))
+	if err != nil {
+		utils.Logger.Errorf("ListAccessGroupMembers: Error fetching users: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching users", nil))
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	for cursor.Next(context.TODO()) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			utils.Logger.Errorf("ListAccessGroupMembers: Error decoding user: %v", err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error decoding user", nil))
+			return
+		}
+		users = append(users, user)
+	}
+
+	if err := cursor.Err(); err != nil {
+		utils.Logger.Errorf("ListAccessGroupMembers: Cursor error: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Cursor error", nil))
+		return
+	}
+
+	views, ok := userViews(c, "ListAccessGroupMembers", users, tenant.ID(c), nil)
+	if !ok {
+		return
+	}
+
+	utils.Logger.Infof("Fetched %d members of access group %s", len(users), accessGroup.Name)
+	c.JSON(http.StatusOK, views)
+}
+
+// AddAccessGroupMembers godoc
+// @Summary Add users to an access group
+// @Description Add one or more users to an access group. The caller must hold every permission the group grants.
+// @Tags access_group
+// @Accept json
+// @Produce json
+// @Param id path string true "Access Group ID"
+// @Param members body models.AccessGroupMembersRequest true "Users to add"
+// @Success 200 {object} map[string]interface{} "message": "Members added successfully", "modified": 1
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 404 {object} utils.ErrorResponse "Access group not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/access_groups/{id}/members [post]
+// @Security BearerAuth
+func (a *AccessGroupController) AddAccessGroupMembers(c *gin.Context) {
+	a.updateAccessGroupMembers(c, "AddAccessGroupMembers", "$addToSet", "Members added successfully")
+}
+
+// RemoveAccessGroupMembers godoc
+// @Summary Remove users from an access group
+// @Description Remove one or more users from an access group. The caller must hold every permission the group grants.
+// @Tags access_group
+// @Accept json
+// @Produce json
+// @Param id path string true "Access Group ID"
+// @Param members body models.AccessGroupMembersRequest true "Users to remove"
+// @Success 200 {object} map[string]interface{} "message": "Members removed successfully", "modified": 1
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 404 {object} utils.ErrorResponse "Access group not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/access_groups/{id}/members [delete]
+// @Security BearerAuth
+func (a *AccessGroupController) RemoveAccessGroupMembers(c *gin.Context) {
+	a.updateAccessGroupMembers(c, "RemoveAccessGroupMembers", "$pull", "Members removed successfully")
+}
+
+// updateAccessGroupMembers applies operator ($addToSet or $pull) with the
+// access group's ID to the access_groups of the requested users.
+func (a *AccessGroupController) updateAccessGroupMembers(c *gin.Context, handler, operator, message string) {
+	accessGroup, ok := findAccessGroupByParam(c, handler)
+	if !ok {
+		return
+	}
+
+	var request models.AccessGroupMembersRequest
+	if err := c.BindJSON(&request); err != nil {
+		utils.Logger.Errorf("%s: Invalid request: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return
+	}
+
+	// Validate the members request
+	if err := utils.ValidateStruct(request); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("%s: Validation error: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	userIDs := make([]primitive.ObjectID, 0, len(request.UserIDs))
+	for _, id := range request.UserIDs {
+		objectId, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			utils.Logger.Errorf("%s: Invalid user ID %s: %v", handler, id, err)
+			c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"user_ids": "invalid user ID: " + id}))
+			return
+		}
+		userIDs = append(userIDs, objectId)
+	}
+
+	// Only users holding everything the group grants may change who holds it
+	subject, ok := currentUser(c, handler)
+	if !ok {
+		return
+	}
+	roles, err := authz.LoadRoles(context.TODO(), accessGroup.OrgID)
+	if err != nil {
+		utils.Logger.Errorf("%s: Error fetching roles: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching roles", nil))
+		return
+	}
+	granted := authz.GroupPermissions(authz.OwnRoles(roles, accessGroup.OrgID), []models.AccessGroup{accessGroup})
+	if !grantable(c, handler, subject, map[string]authz.PermissionSet{"access_group": granted}) {
+		return
+	}
+
+	// Inside an organization the group is part of each user's membership
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	filter := bson.M{"_id": bson.M{"$in": userIDs}}
+	update := bson.M{operator: bson.M{"access_groups": accessGroup.ID}}
+	updateOptions := options.Update()
+	if !accessGroup.OrgID.IsZero() {
+		filter["orgs.org_id"] = accessGroup.OrgID
+		update = bson.M{operator: bson.M{"orgs.$[membership].access_groups": accessGroup.ID}}
+		updateOptions.SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"membership.org_id": accessGroup.OrgID}}})
+	}
+	result, err := collection.UpdateMany(context.TODO(), filter, update, updateOptions)
+	if err != nil {
+		utils.Logger.Errorf("%s: Error updating users: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error updating access group members", nil))
+		return
+	}
+
+	authz.InvalidateUsers(context.TODO(), userIDs...)
+
+	utils.Logger.Infof("%s: Updated %d members of access group %s", handler, result.ModifiedCount, accessGroup.Name)
+	c.JSON(http.StatusOK, gin.H{"message": message, "modified": result.ModifiedCount})
+}
+
+// uniqueAccessGroupName checks that no other access group of the request's
+// organization (self excluded) is called name. Names are resolved to IDs
+// when assigning groups, so they must be unique. It writes the error
+// response and returns false otherwise.
+func uniqueAccessGroupName(c *gin.Context, handler, name string, self primitive.ObjectID) bool {
+	collection := database.MongoClient.Database("mdmdb").Collection("access_groups")
+	err := collection.FindOne(context.TODO(), tenant.With(tenant.Filter(c), bson.M{"name": name, "_id": bson.M{"$ne": self}})).Err()
+	if err == nil {
+		utils.Logger.Errorf("%s: Access group already exists with name: %s", handler, name)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Access group already exists", nil))
+		return false
+	}
+	if err != mongo.ErrNoDocuments {
+		utils.Logger.Errorf("%s: Error checking for duplicate access group: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error checking for duplicate access group", nil))
+		return false
+	}
+	return true
+}
+
+// validateAccessGroup checks that the roles and permissions of an access
+// group exist in its organization and that it only grants permissions the
+// organization may grant. It writes the error response and returns false
+// otherwise.
+func validateAccessGroup(c *gin.Context, handler string, accessGroup models.AccessGroup) bool {
+	validationErrors := make(map[string]string)
+
+	missing, err := findMissingPermissions(append(append([]string{}, accessGroup.Permissions...), accessGroup.Deny...))
+	if err != nil {
+		utils.Logger.Errorf("%s: Error checking permissions: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error checking permissions", nil))
+		return false
+	}
+	if len(missing) > 0 {
+		validationErrors["permissions"] = "unknown permissions: " + strings.Join(missing, ", ")
+	}
+
+	roles, err := authz.LoadRoles(context.TODO(), accessGroup.OrgID)
+	if err != nil {
+		utils.Logger.Errorf("%s: Error fetching roles: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching roles", nil))
+		return false
+	}
+	roles = authz.OwnRoles(roles, accessGroup.OrgID)
+	var missingRoles []string
+	for _, name := range accessGroup.Roles {
+		if _, exists := roles[name]; !exists {
+			missingRoles = append(missingRoles, name)
+		}
+	}
+	if len(missingRoles) > 0 {
+		validationErrors["roles"] = "unknown roles: " + strings.Join(missingRoles, ", ")
+	}
+
+	if len(validationErrors) > 0 {
+		utils.Logger.Errorf("%s: Validation error: %v", handler, validationErrors)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return false
+	}
+	return scopedPermissions(c, handler, accessGroup.OrgID, accessGroup.Permissions)
+}
+
+// findAccessGroupByParam loads the access group identified by the id route
+// parameter within the request's organization. It writes the error response and returns false on failure.
+func findAccessGroupByParam(c *gin.Context, handler string) (models.AccessGroup, bool) {
+	var accessGroup models.AccessGroup
+
+	id := c.Param("id")
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		utils.Logger.Errorf("%s: Invalid access group ID: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid access group ID", nil))
+		return accessGroup, false
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("access_groups")
+	err = collection.FindOne(context.TODO(), tenant.With(tenant.Filter(c), bson.M{"_id": objectId})).Decode(&accessGroup)
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("%s: Access group not found with ID: %s", handler, id)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Access group not found", nil))
+		return accessGroup, false
+	}
+	if err != nil {
+		utils.Logger.Errorf("%s: Error fetching access group: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching access group", nil))
+		return accessGroup, false
+	}
+	return accessGroup, true
 }
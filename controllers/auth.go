@@ -4,13 +4,17 @@ import (
 	"context"
 	"net/http"
 	"time"
+	"unified-go-backend/authz"
 	"unified-go-backend/config"
 	"unified-go-backend/database"
 	"unified-go-backend/models"
+	"unified-go-backend/tenant"
+	"unified-go-backend/userquery"
 	"unified-go-backend/utils"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -81,15 +85,30 @@ func (a *AuthController) Register(c *gin.Context) {
 		return
 	}
 
+	// Look up the default access group
+	defaultGroups, err := authz.FindAccessGroups(context.TODO(), []string{"user_group"}, primitive.NilObjectID)
+	if err != nil {
+		utils.Logger.Errorf("Register: Error fetching default access group: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching default access group", nil))
+		return
+	}
+	accessGroups := []primitive.ObjectID{}
+	for _, group := range defaultGroups {
+		accessGroups = append(accessGroups, group.ID)
+	}
+	if len(accessGroups) == 0 {
+		utils.Logger.Warnf("Register: Default access group user_group does not exist")
+	}
+
 	// Create the user
 	user := models.User{
-		ID:          primitive.NewObjectID(),
-		Email:       req.Email,
-		Username:    req.Username,
-		Password:    string(hashedPassword),
-		Verified:    false,
-		Roles:       []string{"user"}, // Default role
-		AccessGroup: "user_group",     // Default access group
+		ID:           primitive.NewObjectID(),
+		Email:        req.Email,
+		Username:     req.Username,
+		Password:     string(hashedPassword),
+		Verified:     false,
+		Roles:        []string{"user"}, // Default role
+		AccessGroups: accessGroups,
 	}
 
 	_, err = collection.InsertOne(context.TODO(), user)
@@ -175,6 +194,74 @@ func (a *AuthController) VerifyEmail(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
 }
 
+// SetPassword godoc
+// @Summary Set the password of an invited user
+// @Description Set a password with the token of an invitation sent on user creation. The token can be used once; setting the password verifies the email address.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.SetPasswordRequest true "Invitation token and password"
+// @Success 200 {object} map[string]string "message": "Password set successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid or expired invitation"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/set-password [post]
+func (a *AuthController) SetPassword(c *gin.Context) {
+	var req models.SetPasswordRequest
+	if err := c.BindJSON(&req); err != nil {
+		utils.Logger.Errorf("SetPassword: Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return
+	}
+
+	// Validate the request
+	if err := utils.ValidateStruct(req); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("SetPassword: Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	// The invitation is consumed whatever happens next
+	email, err := database.RedisClient.GetDel(context.TODO(), invitationKey(req.Token)).Result()
+	if err == redis.Nil {
+		utils.Logger.Errorf("SetPassword: Invalid or expired invitation")
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid or expired invitation", nil))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("SetPassword: Error reading invitation: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error reading invitation", nil))
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		utils.Logger.Errorf("SetPassword: Error hashing password: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error hashing password", nil))
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	update := bson.M{
+		"$set":   bson.M{"password": string(hashedPassword), "verified": true, "verified_at": time.Now()},
+		"$unset": bson.M{"password_change_required": ""},
+	}
+	result, err := collection.UpdateOne(context.TODO(), userquery.Live(bson.M{"email": email}), update)
+	if err != nil {
+		utils.Logger.Errorf("SetPassword: Error updating user %s: %v", email, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error setting password", nil))
+		return
+	}
+	if result.MatchedCount == 0 {
+		utils.Logger.Errorf("SetPassword: Invited user %s no longer exists", email)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid or expired invitation", nil))
+		return
+	}
+
+	utils.Logger.Infof("Invited user set their password: %s", email)
+	c.JSON(http.StatusOK, gin.H{"message": "Password set successfully"})
+}
+
 // Login godoc
 // @Summary Login a user
 // @Description Login a user with email and password
@@ -185,6 +272,7 @@ func (a *AuthController) VerifyEmail(c *gin.Context) {
 // @Success 200 {object} models.LoginResponse "Returns a token on successful login"
 // @Failure 400 {object} utils.ErrorResponse "Invalid request"
 // @Failure 401 {object} utils.ErrorResponse "Invalid email or password"
+// @Failure 403 {object} utils.ErrorResponse "Account suspended or banned, or not a member of this organization"
 // @Failure 500 {object} utils.ErrorResponse "Internal server error"
 // @Router /api/v1/login [post]
 func (a *AuthController) Login(c *gin.Context) {
@@ -205,7 +293,7 @@ func (a *AuthController) Login(c *gin.Context) {
 
 	collection := database.MongoClient.Database("mdmdb").Collection("users")
 	var user models.User
-	err := collection.FindOne(context.TODO(), bson.M{"email": loginRequest.Email}).Decode(&user)
+	err := collection.FindOne(context.TODO(), userquery.Live(bson.M{"email": loginRequest.Email})).Decode(&user)
 	if err != nil {
 		utils.Logger.Errorf("Login: Invalid email or password: %s", loginRequest.Email)
 		c.JSON(http.StatusUnauthorized, utils.CreateErrorResponse("Invalid email or password", nil))
@@ -218,11 +306,35 @@ func (a *AuthController) Login(c *gin.Context) {
 		return
 	}
 
-	// Create JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	if user.Status.Blocked(time.Now()) {
+		utils.Logger.Warnf("Login: Account of %s is %s", user.Email, user.Status.State)
+		c.JSON(http.StatusForbidden, utils.CreateErrorResponse("Account "+user.Status.State, statusDetails(user.Status)))
+		return
+	}
+
+	claims := jwt.MapClaims{
 		"email": user.Email,
 		"exp":   time.Now().Add(time.Hour * 72).Unix(),
-	})
+	}
+
+	// Bind the token to the requested organization
+	if loginRequest.Org != "" {
+		org, err := tenant.FindOrganization(context.TODO(), loginRequest.Org)
+		if err != nil && err != mongo.ErrNoDocuments {
+			utils.Logger.Errorf("Login: Error fetching organization: %v", err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching organization", nil))
+			return
+		}
+		if _, member := tenant.Membership(user, org.ID); err != nil || !member {
+			utils.Logger.Errorf("Login: User %s is not a member of organization %s", user.Email, loginRequest.Org)
+			c.JSON(http.StatusForbidden, utils.CreateErrorResponse("Not a member of this organization", nil))
+			return
+		}
+		claims["org"] = org.ID.Hex()
+	}
+
+	// Create JWT token
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString([]byte(a.config.JwtSecret))
 	if err != nil {
@@ -232,5 +344,15 @@ func (a *AuthController) Login(c *gin.Context) {
 	}
 
 	utils.Logger.Infof("User logged in successfully: %s", user.Email)
-	c.JSON(http.StatusOK, models.LoginResponse{Token: tokenString})
+	c.JSON(http.StatusOK, models.LoginResponse{Token: tokenString, PasswordChangeRequired: user.PasswordChangeRequired})
+}
+
+// statusDetails describes why an account is blocked, for the error
+// response.
+func statusDetails(status models.UserStatus) map[string]string {
+	details := map[string]string{"reason": status.Reason}
+	if !status.ExpiresAt.IsZero() {
+		details["expires_at"] = status.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return details
 }
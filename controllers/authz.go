@@ -0,0 +1,296 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+	"unified-go-backend/authz"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/tenant"
+	"unified-go-backend/userquery"
+	"unified-go-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AuthzController exposes the authorization decisions made for users.
+type AuthzController struct{}
+
+// NewAuthzController creates a new AuthzController.
+func NewAuthzController() *AuthzController {
+	return &AuthzController{}
+}
+
+// Explain godoc
+// @Summary Explain a permission decision
+// @Description Check one or more permissions for a user and report which allow or deny rule decided each of them. Deny rules always take precedence over grants.
+// @Tags authz
+// @Produce json
+// @Param user_id query string true "User ID"
+// @Param permission query []string true "Permissions to check" collectionFormat(multi)
+// @Success 200 {object} authz.Explanation
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "User not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/authz/explain [get]
+// @Security BearerAuth
+func (a *AuthzController) Explain(c *gin.Context) {
+	objectId, err := primitive.ObjectIDFromHex(c.Query("user_id"))
+	if err != nil {
+		utils.Logger.Errorf("Explain: Invalid user ID: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"user_id": "invalid"}))
+		return
+	}
+
+	permissions := c.QueryArray("permission")
+	if len(permissions) == 0 {
+		utils.Logger.Errorf("Explain: No permissions requested")
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"permission": "required"}))
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	var user models.User
+	err = collection.FindOne(context.TODO(), tenant.With(tenant.Users(c), userquery.Live(bson.M{"_id": objectId}))).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("Explain: User not found with ID: %s", objectId.Hex())
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("User not found", nil))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("Explain: Error fetching user: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching user", nil))
+		return
+	}
+
+	grants, err := authz.ResolveUser(context.TODO(), user, tenant.ID(c))
+	if err != nil {
+		utils.Logger.Errorf("Explain: Error resolving permissions: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error resolving permissions", nil))
+		return
+	}
+
+	allowed, decisions := grants.CheckAll(permissions)
+	utils.Logger.Infof("Explained %d permissions for user %s", len(decisions), user.Email)
+	c.JSON(http.StatusOK, authz.Explanation{
+		Email:     user.Email,
+		Allowed:   allowed,
+		Decisions: decisions,
+		Grants:    grants,
+	})
+}
+
+// Check godoc
+// @Summary Check the caller's permissions
+// @Description Decide a batch of permissions for the authenticated user, optionally on specific resources. Uses the same role, deny rule and policy resolution as route authorization.
+// @Tags authz
+// @Accept json
+// @Produce json
+// @Param check body models.AuthzCheckRequest true "Permissions to check"
+// @Success 200 {array} models.AuthzCheckResult
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 401 {object} utils.ErrorResponse "Unauthorized"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/authz/check [post]
+// @Security BearerAuth
+func (a *AuthzController) Check(c *gin.Context) {
+	var request models.AuthzCheckRequest
+	if err := c.BindJSON(&request); err != nil {
+		utils.Logger.Errorf("Check: Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return
+	}
+
+	// Validate the check request
+	if err := utils.ValidateStruct(request); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("Check: Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	subject, ok := currentUser(c, "Check")
+	if !ok {
+		return
+	}
+
+	grants, err := authz.ResolveUser(context.TODO(), subject, tenant.ID(c))
+	if err != nil {
+		utils.Logger.Errorf("Check: Error resolving permissions: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error resolving permissions", nil))
+		return
+	}
+
+	results := make([]models.AuthzCheckResult, 0, len(request.Items))
+	for _, item := range request.Items {
+		result := models.AuthzCheckResult{
+			Permission:   item.Permission,
+			ResourceType: item.ResourceType,
+			ResourceID:   item.ResourceID,
+		}
+
+		var resource interface{}
+		if item.ResourceType != "" {
+			resource, err = loadResource(c, item.ResourceType, item.ResourceID)
+			if err != nil {
+				result.Reason = "resource not found"
+				results = append(results, result)
+				continue
+			}
+		}
+
+		decision := grants.Authorize(authz.PolicyRequest{
+			Action:   item.Permission,
+			Subject:  subject,
+			Resource: resource,
+			IP:       c.ClientIP(),
+			Time:     time.Now(),
+		})
+		result.Allowed = decision.Allowed
+		result.Reason = decision.Reason
+		results = append(results, result)
+	}
+
+	utils.Logger.Infof("Checked %d permissions for user %s", len(results), subject.Email)
+	c.JSON(http.StatusOK, results)
+}
+
+// resourceCollections maps the resource types accepted by Check to the
+// collections they are loaded from.
+var resourceCollections = map[string]string{
+	"user":         "users",
+	"access_group": "access_groups",
+	"role":         "roles",
+}
+
+// loadResource fetches a resource document visible in the request's
+// organization by type and ID for policy evaluation.
+func loadResource(c *gin.Context, resourceType, id string) (interface{}, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection(resourceCollections[resourceType])
+	filter := bson.M{"_id": objectId}
+	switch resourceType {
+	case "user":
+		var user models.User
+		err = collection.FindOne(context.TODO(), tenant.With(tenant.Users(c), userquery.Live(filter))).Decode(&user)
+		return user, err
+	case "access_group":
+		var accessGroup models.AccessGroup
+		err = collection.FindOne(context.TODO(), tenant.With(tenant.Filter(c), filter)).Decode(&accessGroup)
+		return accessGroup, err
+	}
+	var role models.Role
+	err = collection.FindOne(context.TODO(), tenant.With(tenant.VisibleRoles(c), filter)).Decode(&role)
+	return role, err
+}
+
+// currentUser loads the authenticated user. It writes the error response and
+// returns false on failure.
+func currentUser(c *gin.Context, handler string) (models.User, bool) {
+	var user models.User
+
+	email, exists := c.Get("email")
+	if !exists {
+		utils.Logger.Errorf("%s: Failed to get email from context", handler)
+		c.JSON(http.StatusUnauthorized, utils.CreateErrorResponse("Unauthorized", nil))
+		return user, false
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	err := collection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&user)
+	if err != nil {
+		utils.Logger.Errorf("%s: Error fetching user %s: %v", handler, email, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching user", nil))
+		return user, false
+	}
+	return user, true
+}
+
+// holdsPermission reports whether the user's grants inside the request's
+// organization allow permission, policies included. It writes a 500
+// response and returns ok false when the grants cannot be resolved.
+func holdsPermission(c *gin.Context, handler, permission string, user models.User) (allowed, ok bool) {
+	grants, err := authz.CachedGrants(context.TODO(), user, tenant.ID(c))
+	if err != nil {
+		utils.Logger.Errorf("%s: Error resolving permissions: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error resolving permissions", nil))
+		return false, false
+	}
+	decision := grants.Authorize(authz.PolicyRequest{
+		Action:  permission,
+		Subject: user,
+		IP:      c.ClientIP(),
+		Time:    time.Now(),
+	})
+	if !decision.Allowed {
+		utils.Logger.Debugf("%s: User %s refused %s: %s", handler, user.Email, permission, decision.Reason)
+	}
+	return decision.Allowed, true
+}
+
+// grantable checks that the subject holds, inside the request's
+// organization, every permission granted through each field of a request:
+// users may only hand out permissions they hold themselves. It writes a 403
+// response listing the others by field and returns false when there are
+// any.
+func grantable(c *gin.Context, handler string, subject models.User, granted map[string]authz.PermissionSet) bool {
+	grants, err := authz.CachedGrants(context.TODO(), subject, tenant.ID(c))
+	if err != nil {
+		utils.Logger.Errorf("%s: Error resolving permissions: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error resolving permissions", nil))
+		return false
+	}
+	withheldErrors := make(map[string]string)
+	for field, permissions := range granted {
+		if withheld := grants.Withheld(permissions); len(withheld) > 0 {
+			withheldErrors[field] = "grant permissions you do not hold: " + strings.Join(withheld, ", ")
+		}
+	}
+	if len(withheldErrors) > 0 {
+		utils.Logger.Warnf("%s: User %s refused to grant permissions they do not hold: %v", handler, subject.Email, withheldErrors)
+		c.JSON(http.StatusForbidden, utils.CreateErrorResponse("Forbidden", withheldErrors))
+		return false
+	}
+	return true
+}
+
+// authorizeResource evaluates the access policies for action against a
+// loaded resource. It writes a 403 response and returns false when a policy
+// refuses the request.
+func authorizeResource(c *gin.Context, handler, action string, subject models.User, resource interface{}) bool {
+	decision := authz.EvaluatePolicies(authz.PolicyRequest{
+		Action:   action,
+		Subject:  subject,
+		Resource: resource,
+		IP:       c.ClientIP(),
+		Time:     time.Now(),
+	})
+	if !decision.Allowed {
+		utils.Logger.Warnf("%s: User %s refused %s", handler, subject.Email, action)
+		utils.Logger.Debugf("%s: User %s refused %s: %s", handler, subject.Email, action, decision.Reason)
+		c.JSON(http.StatusForbidden, utils.CreateErrorResponse("Forbidden", nil))
+		return false
+	}
+	return true
+}
+
+// globalContext refuses requests made inside an organization for the routes
+// of platform administration, whose data applies to every organization. It
+// writes the error response and returns false for those.
+func globalContext(c *gin.Context, handler string) bool {
+	if tenant.Scoped(c) {
+		utils.Logger.Errorf("%s: Refused inside organization %s", handler, tenant.ID(c).Hex())
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Only available outside organizations", nil))
+		return false
+	}
+	return true
+}
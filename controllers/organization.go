@@ -0,0 +1,540 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+	"unified-go-backend/authz"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/tenant"
+	"unified-go-backend/userquery"
+	"unified-go-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// OrganizationController handles organizations (tenants) and their members.
+type OrganizationController struct{}
+
+// NewOrganizationController creates a new OrganizationController.
+func NewOrganizationController() *OrganizationController {
+	return &OrganizationController{}
+}
+
+// CreateOrganization godoc
+// @Summary Create an organization
+// @Description Create an organization. Its slug selects it by subdomain or the X-Org header.
+// @Tags organization
+// @Accept json
+// @Produce json
+// @Param organization body models.Organization true "Organization"
+// @Success 201 {object} models.Organization
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 409 {object} utils.ErrorResponse "Organization already exists"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/orgs [post]
+// @Security BearerAuth
+func (o *OrganizationController) CreateOrganization(c *gin.Context) {
+	if !globalContext(c, "CreateOrganization") {
+		return
+	}
+	org, ok := bindOrganization(c, "CreateOrganization")
+	if !ok {
+		return
+	}
+
+	org.ID = primitive.NewObjectID()
+	org.CreatedAt = time.Now()
+	collection := database.MongoClient.Database("mdmdb").Collection("organizations")
+	_, err := collection.InsertOne(context.TODO(), org)
+	if mongo.IsDuplicateKeyError(err) {
+		utils.Logger.Errorf("CreateOrganization: Organization already exists with slug: %s", org.Slug)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Organization already exists", nil))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("CreateOrganization: Error creating organization: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error creating organization", nil))
+		return
+	}
+
+	utils.Logger.Infof("Organization created successfully: %s", org.Slug)
+	c.JSON(http.StatusCreated, org)
+}
+
+// ListOrganizations godoc
+// @Summary List organizations
+// @Description List every organization. Inside an organization only that organization is listed.
+// @Tags organization
+// @Produce json
+// @Success 200 {array} models.Organization
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/orgs [get]
+// @Security BearerAuth
+func (o *OrganizationController) ListOrganizations(c *gin.Context) {
+	filter := bson.M{}
+	if tenant.Scoped(c) {
+		filter["_id"] = tenant.ID(c)
+	}
+	listOrganizations(c, "ListOrganizations", filter)
+}
+
+// ListMyOrganizations godoc
+// @Summary List the caller's organizations
+// @Description List the organizations the authenticated user belongs to
+// @Tags organization
+// @Produce json
+// @Success 200 {array} models.Organization
+// @Failure 401 {object} utils.ErrorResponse "Unauthorized"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/user/orgs [get]
+// @Security BearerAuth
+func (o *OrganizationController) ListMyOrganizations(c *gin.Context) {
+	user, ok := currentUser(c, "ListMyOrganizations")
+	if !ok {
+		return
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(user.Orgs))
+	for _, membership := range user.Orgs {
+		ids = append(ids, membership.OrgID)
+	}
+	listOrganizations(c, "ListMyOrganizations", bson.M{"_id": bson.M{"$in": ids}})
+}
+
+// GetOrganization godoc
+// @Summary Get an organization
+// @Description Get an organization by ID
+// @Tags organization
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Success 200 {object} models.Organization
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Organization not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/orgs/{id} [get]
+// @Security BearerAuth
+func (o *OrganizationController) GetOrganization(c *gin.Context) {
+	org, ok := findOrganizationByParam(c, "GetOrganization")
+	if !ok {
+		return
+	}
+
+	utils.Logger.Infof("Fetched organization: %s", org.Slug)
+	c.JSON(http.StatusOK, org)
+}
+
+// UpdateOrganization godoc
+// @Summary Update an organization
+// @Description Update an organization's name and slug
+// @Tags organization
+// @Accept json
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Param organization body models.Organization true "Organization"
+// @Success 200 {object} map[string]string "message": "Organization updated successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Organization not found"
+// @Failure 409 {object} utils.ErrorResponse "Organization already exists"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/orgs/{id} [put]
+// @Security BearerAuth
+func (o *OrganizationController) UpdateOrganization(c *gin.Context) {
+	existing, ok := findOrganizationByParam(c, "UpdateOrganization")
+	if !ok {
+		return
+	}
+	org, ok := bindOrganization(c, "UpdateOrganization")
+	if !ok {
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("organizations")
+	update := bson.M{"$set": bson.M{"name": org.Name, "slug": org.Slug}}
+	_, err := collection.UpdateOne(context.TODO(), bson.M{"_id": existing.ID}, update)
+	if mongo.IsDuplicateKeyError(err) {
+		utils.Logger.Errorf("UpdateOrganization: Organization already exists with slug: %s", org.Slug)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Organization already exists", nil))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("UpdateOrganization: Error updating organization: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error updating organization", nil))
+		return
+	}
+
+	utils.Logger.Infof("Organization updated successfully: %s", existing.ID.Hex())
+	c.JSON(http.StatusOK, gin.H{"message": "Organization updated successfully"})
+}
+
+// DeleteOrganization godoc
+// @Summary Delete an organization
+// @Description Delete an organization that no longer has members, together with its roles, access groups and teams
+// @Tags organization
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Success 200 {object} map[string]string "message": "Organization deleted successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Organization not found"
+// @Failure 409 {object} utils.ErrorResponse "Organization still has members"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/orgs/{id} [delete]
+// @Security BearerAuth
+func (o *OrganizationController) DeleteOrganization(c *gin.Context) {
+	org, ok := findOrganizationByParam(c, "DeleteOrganization")
+	if !ok {
+		return
+	}
+
+	db := database.MongoClient.Database("mdmdb")
+	members, err := db.Collection("users").CountDocuments(context.TODO(), bson.M{"orgs.org_id": org.ID})
+	if err != nil {
+		utils.Logger.Errorf("DeleteOrganization: Error counting members: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error counting members", nil))
+		return
+	}
+	if members > 0 {
+		utils.Logger.Errorf("DeleteOrganization: Organization %s still has %d members", org.Slug, members)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Organization still has members", nil))
+		return
+	}
+
+	for _, name := range []string{"roles", "access_groups", "teams"} {
+		if _, err := db.Collection(name).DeleteMany(context.TODO(), tenant.OwnedBy(org.ID)); err != nil {
+			utils.Logger.Errorf("DeleteOrganization: Error deleting %s: %v", name, err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error deleting organization", nil))
+			return
+		}
+	}
+	if _, err := db.Collection("organizations").DeleteOne(context.TODO(), bson.M{"_id": org.ID}); err != nil {
+		utils.Logger.Errorf("DeleteOrganization: Error deleting organization: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error deleting organization", nil))
+		return
+	}
+
+	authz.InvalidateAll(context.TODO())
+
+	utils.Logger.Infof("Organization deleted successfully: %s", org.Slug)
+	c.JSON(http.StatusOK, gin.H{"message": "Organization deleted successfully"})
+}
+
+// ListOrganizationMembers godoc
+// @Summary List organization members
+// @Description List the users belonging to an organization. Users are shown as models.UserListItem, or as models.UserAdminView to callers with users:read_sensitive.
+// @Tags organization
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Success 200 {array} models.UserListItem
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Organization not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/orgs/{id}/members [get]
+// @Security BearerAuth
+func (o *OrganizationController) ListOrganizationMembers(c *gin.Context) {
+	org, ok := findOrganizationByParam(c, "ListOrganizationMembers")
+	if !ok {
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	cursor, err := collection.Find(context.TODO(), userquery.Live(bson.M{"orgs.org_id": org.ID}))
+	if err != nil {
+		utils.Logger.Errorf("ListOrganizationMembers: Error fetching users: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching users", nil))
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	users := []models.User{}
+	if err := cursor.All(context.TODO(), &users); err != nil {
+		utils.Logger.Errorf("ListOrganizationMembers: Error decoding users: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error decoding users", nil))
+		return
+	}
+
+	views, ok := userViews(c, "ListOrganizationMembers", users, org.ID, nil)
+	if !ok {
+		return
+	}
+
+	utils.Logger.Infof("Fetched %d members of organization %s", len(users), org.Slug)
+	c.JSON(http.StatusOK, views)
+}
+
+// SetOrganizationMember godoc
+// @Summary Add or update an organization member
+// @Description Add a user to an organization, or replace the roles and access groups they hold in it. Roles and access groups must be owned by the organization.
+// @Tags organization
+// @Accept json
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Param member body models.OrgMemberRequest true "Membership"
+// @Success 200 {object} models.OrgMembership
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Organization or user not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/orgs/{id}/members [put]
+// @Security BearerAuth
+func (o *OrganizationController) SetOrganizationMember(c *gin.Context) {
+	org, ok := findOrganizationByParam(c, "SetOrganizationMember")
+	if !ok {
+		return
+	}
+
+	var request models.OrgMemberRequest
+	if err := c.BindJSON(&request); err != nil {
+		utils.Logger.Errorf("SetOrganizationMember: Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return
+	}
+
+	// Validate the membership request
+	if err := utils.ValidateStruct(request); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("SetOrganizationMember: Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(request.UserID)
+	if err != nil {
+		utils.Logger.Errorf("SetOrganizationMember: Invalid user ID: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"user_id": "invalid"}))
+		return
+	}
+
+	membership := models.OrgMembership{OrgID: org.ID, Roles: request.Roles, AccessGroups: []primitive.ObjectID{}}
+	if membership.Roles == nil {
+		membership.Roles = []string{}
+	}
+	validationErrors, err := validateMembership(&membership, request.AccessGroups)
+	if err != nil {
+		utils.Logger.Errorf("SetOrganizationMember: Error checking roles and access groups: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error checking roles and access groups", nil))
+		return
+	}
+	if validationErrors != nil {
+		utils.Logger.Errorf("SetOrganizationMember: Validation error: %v", validationErrors)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	// Replace the existing membership, or add one
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	result, err := collection.UpdateOne(context.TODO(),
+		bson.M{"_id": userID, "orgs.org_id": org.ID},
+		bson.M{"$set": bson.M{"orgs.$": membership}},
+	)
+	if err == nil && result.MatchedCount == 0 {
+		result, err = collection.UpdateOne(context.TODO(),
+			bson.M{"_id": userID, "orgs.org_id": bson.M{"$ne": org.ID}},
+			bson.M{"$push": bson.M{"orgs": membership}},
+		)
+	}
+	if err != nil {
+		utils.Logger.Errorf("SetOrganizationMember: Error updating user: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error updating organization member", nil))
+		return
+	}
+	if result.MatchedCount == 0 {
+		utils.Logger.Errorf("SetOrganizationMember: User not found with ID: %s", request.UserID)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("User not found", nil))
+		return
+	}
+
+	authz.InvalidateUsers(context.TODO(), userID)
+
+	utils.Logger.Infof("Set membership of user %s in organization %s", request.UserID, org.Slug)
+	c.JSON(http.StatusOK, membership)
+}
+
+// RemoveOrganizationMember godoc
+// @Summary Remove an organization member
+// @Description Remove a user from an organization together with the roles, access groups and team memberships they held in it
+// @Tags organization
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Param user_id path string true "User ID"
+// @Success 200 {object} map[string]string "message": "Member removed successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Organization or member not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/orgs/{id}/members/{user_id} [delete]
+// @Security BearerAuth
+func (o *OrganizationController) RemoveOrganizationMember(c *gin.Context) {
+	org, ok := findOrganizationByParam(c, "RemoveOrganizationMember")
+	if !ok {
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		utils.Logger.Errorf("RemoveOrganizationMember: Invalid user ID: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid user ID", nil))
+		return
+	}
+
+	// Team memberships in the organization go with the membership
+	db := database.MongoClient.Database("mdmdb")
+	teamIDs, err := db.Collection("teams").Distinct(context.TODO(), "_id", tenant.OwnedBy(org.ID))
+	if err != nil {
+		utils.Logger.Errorf("RemoveOrganizationMember: Error fetching teams: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error removing organization member", nil))
+		return
+	}
+	result, err := db.Collection("users").UpdateOne(context.TODO(),
+		bson.M{"_id": userID, "orgs.org_id": org.ID},
+		bson.M{"$pull": bson.M{
+			"orgs":  bson.M{"org_id": org.ID},
+			"teams": bson.M{"team_id": bson.M{"$in": teamIDs}},
+		}},
+	)
+	if err != nil {
+		utils.Logger.Errorf("RemoveOrganizationMember: Error updating user: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error removing organization member", nil))
+		return
+	}
+	if result.MatchedCount == 0 {
+		utils.Logger.Errorf("RemoveOrganizationMember: User %s is not a member of %s", userID.Hex(), org.Slug)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Member not found", nil))
+		return
+	}
+
+	authz.InvalidateUsers(context.TODO(), userID)
+
+	utils.Logger.Infof("Removed user %s from organization %s", userID.Hex(), org.Slug)
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+func bindOrganization(c *gin.Context, handler string) (models.Organization, bool) {
+	var org models.Organization
+	if err := c.BindJSON(&org); err != nil {
+		utils.Logger.Errorf("%s: Invalid request: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return org, false
+	}
+
+	// Slugs are used as subdomains, so keep them lowercase
+	org.Slug = strings.ToLower(org.Slug)
+
+	// Validate the organization request
+	if err := utils.ValidateStruct(org); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("%s: Validation error: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return org, false
+	}
+	if strings.Contains(org.Slug, ".") {
+		utils.Logger.Errorf("%s: Invalid slug: %s", handler, org.Slug)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"slug": "must be a single DNS label"}))
+		return org, false
+	}
+	return org, true
+}
+
+func listOrganizations(c *gin.Context, handler string, filter bson.M) {
+	collection := database.MongoClient.Database("mdmdb").Collection("organizations")
+	cursor, err := collection.Find(context.TODO(), filter)
+	if err != nil {
+		utils.Logger.Errorf("%s: Error fetching organizations: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching organizations", nil))
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	orgs := []models.Organization{}
+	if err := cursor.All(context.TODO(), &orgs); err != nil {
+		utils.Logger.Errorf("%s: Error decoding organizations: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error decoding organizations", nil))
+		return
+	}
+
+	utils.Logger.Infof("Fetched %d organizations", len(orgs))
+	c.JSON(http.StatusOK, orgs)
+}
+
+// validateMembership checks that the membership's roles are usable in the
+// organization and resolves the named access groups of the organization
+// into the membership. It returns validation errors keyed by field, or nil
+// when the membership is valid.
+func validateMembership(membership *models.OrgMembership, groupNames []string) (map[string]string, error) {
+	validationErrors := make(map[string]string)
+
+	roles, err := authz.LoadRoles(context.TODO(), membership.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	roles = authz.OwnRoles(roles, membership.OrgID)
+	var missingRoles []string
+	for _, name := range membership.Roles {
+		if _, exists := roles[name]; !exists {
+			missingRoles = append(missingRoles, name)
+		}
+	}
+	if len(missingRoles) > 0 {
+		validationErrors["roles"] = "unknown roles: " + strings.Join(missingRoles, ", ")
+	}
+
+	groups, err := authz.FindAccessGroups(context.TODO(), groupNames, membership.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]primitive.ObjectID, len(groups))
+	for _, group := range groups {
+		found[group.Name] = group.ID
+	}
+	var missingGroups []string
+	for _, name := range groupNames {
+		id, exists := found[name]
+		if !exists {
+			missingGroups = append(missingGroups, name)
+			continue
+		}
+		membership.AccessGroups = append(membership.AccessGroups, id)
+	}
+	if len(missingGroups) > 0 {
+		validationErrors["access_groups"] = "unknown access groups: " + strings.Join(missingGroups, ", ")
+	}
+
+	if len(validationErrors) == 0 {
+		return nil, nil
+	}
+	return validationErrors, nil
+}
+
+// findOrganizationByParam loads the organization named by the id route
+// parameter. Inside an organization only that organization can be loaded.
+// It writes the error response and returns false on failure.
+func findOrganizationByParam(c *gin.Context, handler string) (models.Organization, bool) {
+	var org models.Organization
+
+	objectId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.Logger.Errorf("%s: Invalid organization ID: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid organization ID", nil))
+		return org, false
+	}
+
+	if tenant.Scoped(c) && tenant.ID(c) != objectId {
+		utils.Logger.Errorf("%s: Organization %s is outside the request's organization", handler, objectId.Hex())
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Organization not found", nil))
+		return org, false
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("organizations")
+	err = collection.FindOne(context.TODO(), bson.M{"_id": objectId}).Decode(&org)
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("%s: Organization not found with ID: %s", handler, objectId.Hex())
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Organization not found", nil))
+		return org, false
+	}
+	if err != nil {
+		utils.Logger.Errorf("%s: Error fetching organization: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching organization", nil))
+		return org, false
+	}
+	return org, true
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PermissionController handles permission-related operations.
+type PermissionController struct{}
+
+// NewPermissionController creates a new PermissionController.
+func NewPermissionController() *PermissionController {
+	return &PermissionController{}
+}
+
+// ListPermissions godoc
+// @Summary List all permissions
+// @Description List all known permissions with their descriptions, sorted by name
+// @Tags permission
+// @Produce json
+// @Success 200 {array} models.Permission
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/permissions [get]
+// @Security BearerAuth
+func (p *PermissionController) ListPermissions(c *gin.Context) {
+	collection := database.MongoClient.Database("mdmdb").Collection("permissions")
+
+	permissions := []models.Permission{}
+	findOptions := options.Find().SetSort(bson.M{"name": 1})
+	cursor, err := collection.Find(context.TODO(), bson.M{}, findOptions)
+	if err != nil {
+		utils.Logger.Errorf("ListPermissions: Error fetching permissions: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching permissions", nil))
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	for cursor.Next(context.TODO()) {
+		var permission models.Permission
+		if err := cursor.Decode(&permission); err != nil {
+			utils.Logger.Errorf("ListPermissions: Error decoding permission: %v", err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error decoding permission", nil))
+			return
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err := cursor.Err(); err != nil {
+		utils.Logger.Errorf("ListPermissions: Cursor error: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Cursor error", nil))
+		return
+	}
+
+	utils.Logger.Infof("Fetched %d permissions", len(permissions))
+	c.JSON(http.StatusOK, permissions)
+}
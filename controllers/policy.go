@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"unified-go-backend/authz"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PolicyController handles attribute-based access policy operations.
+type PolicyController struct{}
+
+// NewPolicyController creates a new PolicyController.
+func NewPolicyController() *PolicyController {
+	return &PolicyController{}
+}
+
+// CreatePolicy godoc
+// @Summary Create a new access policy
+// @Description Create an attribute-based access policy. Conditions compare subject, resource or env attributes with a literal value or another attribute.
+// @Tags policy
+// @Accept json
+// @Produce json
+// @Param policy body models.Policy true "Policy data"
+// @Success 201 {object} models.Policy
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 409 {object} utils.ErrorResponse "Policy already exists"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/policies [post]
+// @Security BearerAuth
+func (p *PolicyController) CreatePolicy(c *gin.Context) {
+	if !globalContext(c, "CreatePolicy") {
+		return
+	}
+	policy, ok := bindPolicy(c, "CreatePolicy")
+	if !ok {
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("policies")
+
+	// Check for duplicate policy
+	err := collection.FindOne(context.TODO(), bson.M{"name": policy.Name}).Err()
+	if err == nil {
+		utils.Logger.Errorf("CreatePolicy: Policy already exists with name: %s", policy.Name)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Policy already exists", nil))
+		return
+	}
+	if err != mongo.ErrNoDocuments {
+		utils.Logger.Errorf("CreatePolicy: Error checking for duplicate policy: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error checking for duplicate policy", nil))
+		return
+	}
+
+	policy.ID = primitive.NewObjectID()
+	policy.UpdatedAt = time.Now()
+	_, err = collection.InsertOne(context.TODO(), policy)
+	if err != nil {
+		utils.Logger.Errorf("CreatePolicy: Error creating policy: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error creating policy", nil))
+		return
+	}
+
+	reloadPolicies("CreatePolicy")
+	utils.Logger.Infof("Policy created successfully: %s", policy.Name)
+	c.JSON(http.StatusCreated, policy)
+}
+
+// ListPolicies godoc
+// @Summary List all access policies
+// @Description List all access policies, including disabled ones
+// @Tags policy
+// @Produce json
+// @Success 200 {array} models.Policy
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/policies [get]
+// @Security BearerAuth
+func (p *PolicyController) ListPolicies(c *gin.Context) {
+	if !globalContext(c, "ListPolicies") {
+		return
+	}
+	collection := database.MongoClient.Database("mdmdb").Collection("policies")
+
+	policies := []models.Policy{}
+	cursor, err := collection.Find(context.TODO(), bson.M{})
+	if err != nil {
+		utils.Logger.Errorf("ListPolicies: Error fetching policies: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching policies", nil))
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	for cursor.Next(context.TODO()) {
+		var policy models.Policy
+		if err := cursor.Decode(&policy); err != nil {
+			utils.Logger.Errorf("ListPolicies: Error decoding policy: %v", err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error decoding policy", nil))
+			return
+		}
+		policies = append(policies, policy)
+	}
+
+	if err := cursor.Err(); err != nil {
+		utils.Logger.Errorf("ListPolicies: Cursor error: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Cursor error", nil))
+		return
+	}
+
+	utils.Logger.Infof("Fetched %d policies", len(policies))
+	c.JSON(http.StatusOK, policies)
+}
+
+// GetPolicy godoc
+// @Summary Get an access policy
+// @Description Get an access policy by ID
+// @Tags policy
+// @Produce json
+// @Param id path string true "Policy ID"
+// @Success 200 {object} models.Policy
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Policy not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/policies/{id} [get]
+// @Security BearerAuth
+func (p *PolicyController) GetPolicy(c *gin.Context) {
+	if !globalContext(c, "GetPolicy") {
+		return
+	}
+	id := c.Param("id")
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		utils.Logger.Errorf("GetPolicy: Invalid policy ID: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid policy ID", nil))
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("policies")
+	var policy models.Policy
+	err = collection.FindOne(context.TODO(), bson.M{"_id": objectId}).Decode(&policy)
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("GetPolicy: Policy not found with ID: %s", id)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Policy not found", nil))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("GetPolicy: Error fetching policy: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching policy", nil))
+		return
+	}
+
+	utils.Logger.Infof("Fetched policy: %s", policy.Name)
+	c.JSON(http.StatusOK, policy)
+}
+
+// UpdatePolicy godoc
+// @Summary Update an access policy
+// @Description Replace an access policy's effect, actions and conditions
+// @Tags policy
+// @Accept json
+// @Produce json
+// @Param id path string true "Policy ID"
+// @Param policy body models.Policy true "Policy data"
+// @Success 200 {object} map[string]string "message": "Policy updated successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Policy not found"
+// @Failure 409 {object} utils.ErrorResponse "Policy already exists"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/policies/{id} [put]
+// @Security BearerAuth
+func (p *PolicyController) UpdatePolicy(c *gin.Context) {
+	if !globalContext(c, "UpdatePolicy") {
+		return
+	}
+	id := c.Param("id")
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		utils.Logger.Errorf("UpdatePolicy: Invalid policy ID: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid policy ID", nil))
+		return
+	}
+
+	policy, ok := bindPolicy(c, "UpdatePolicy")
+	if !ok {
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("policies")
+
+	// Check that no other policy already uses the requested name
+	err = collection.FindOne(context.TODO(), bson.M{"name": policy.Name, "_id": bson.M{"$ne": objectId}}).Err()
+	if err == nil {
+		utils.Logger.Errorf("UpdatePolicy: Policy already exists with name: %s", policy.Name)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Policy already exists", nil))
+		return
+	}
+	if err != mongo.ErrNoDocuments {
+		utils.Logger.Errorf("UpdatePolicy: Error checking for duplicate policy: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error checking for duplicate policy", nil))
+		return
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"name":        policy.Name,
+			"description": policy.Description,
+			"effect":      policy.Effect,
+			"actions":     policy.Actions,
+			"conditions":  policy.Conditions,
+			"enabled":     policy.Enabled,
+			"updated_at":  time.Now(),
+		},
+	}
+
+	result, err := collection.UpdateOne(context.TODO(), bson.M{"_id": objectId}, update)
+	if err != nil {
+		utils.Logger.Errorf("UpdatePolicy: Error updating policy: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error updating policy", nil))
+		return
+	}
+	if result.MatchedCount == 0 {
+		utils.Logger.Errorf("UpdatePolicy: Policy not found with ID: %s", id)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Policy not found", nil))
+		return
+	}
+
+	reloadPolicies("UpdatePolicy")
+	utils.Logger.Infof("Policy updated successfully: %s", id)
+	c.JSON(http.StatusOK, gin.H{"message": "Policy updated successfully"})
+}
+
+// DeletePolicy godoc
+// @Summary Delete an access policy
+// @Description Delete an access policy by ID
+// @Tags policy
+// @Produce json
+// @Param id path string true "Policy ID"
+// @Success 200 {object} map[string]string "message": "Policy deleted successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Policy not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/policies/{id} [delete]
+// @Security BearerAuth
+func (p *PolicyController) DeletePolicy(c *gin.Context) {
+	if !globalContext(c, "DeletePolicy") {
+		return
+	}
+	id := c.Param("id")
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		utils.Logger.Errorf("DeletePolicy: Invalid policy ID: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid policy ID", nil))
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("policies")
+	result, err := collection.DeleteOne(context.TODO(), bson.M{"_id": objectId})
+	if err != nil {
+		utils.Logger.Errorf("DeletePolicy: Error deleting policy: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error deleting policy", nil))
+		return
+	}
+	if result.DeletedCount == 0 {
+		utils.Logger.Errorf("DeletePolicy: Policy not found with ID: %s", id)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Policy not found", nil))
+		return
+	}
+
+	reloadPolicies("DeletePolicy")
+	utils.Logger.Infof("Policy deleted successfully: %s", id)
+	c.JSON(http.StatusOK, gin.H{"message": "Policy deleted successfully"})
+}
+
+// bindPolicy reads and validates a policy from the request body. It writes
+// the error response and returns false on failure.
+func bindPolicy(c *gin.Context, handler string) (models.Policy, bool) {
+	var policy models.Policy
+	if err := c.BindJSON(&policy); err != nil {
+		utils.Logger.Errorf("%s: Invalid request: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return policy, false
+	}
+
+	// Validate the policy request
+	if err := utils.ValidateStruct(policy); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("%s: Validation error: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return policy, false
+	}
+	if validationErrors := authz.ValidatePolicy(policy); validationErrors != nil {
+		utils.Logger.Errorf("%s: Validation error: %v", handler, validationErrors)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return policy, false
+	}
+
+	policy.Actions = authz.CanonicalList(policy.Actions)
+	if policy.Conditions == nil {
+		policy.Conditions = []models.Condition{}
+	}
+	return policy, true
+}
+
+// reloadPolicies refreshes this replica's policy cache right away; other
+// replicas pick the change up on their next periodic reload.
+func reloadPolicies(handler string) {
+	if err := authz.ReloadPolicies(context.TODO()); err != nil {
+		utils.Logger.Errorf("%s: Error reloading policies: %v", handler, err)
+	}
+}
@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+	"unified-go-backend/config"
+	"unified-go-backend/models"
+	"unified-go-backend/privacy"
+	"unified-go-backend/utils"
+	"unified-go-backend/worker"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PrivacyController handles the data subject requests of the authenticated
+// user: exports of their data and the deletion of their account.
+type PrivacyController struct {
+	config *config.Config
+}
+
+// NewPrivacyController creates a new PrivacyController.
+func NewPrivacyController(cfg *config.Config) *PrivacyController {
+	return &PrivacyController{
+		config: cfg,
+	}
+}
+
+// RequestDataExport godoc
+// @Summary Request an export of your data
+// @Description Queue an archive of everything held about the authenticated user: profile, memberships, role requests, access reviews, relations, imports and exports. The archive is built in the background; poll the export until it is ready, then download it before it expires. A pending export is returned instead of queueing another.
+// @Tags user
+// @Produce json
+// @Success 202 {object} models.DataExport
+// @Failure 401 {object} utils.ErrorResponse "Unauthorized"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/user/data-export [post]
+// @Security BearerAuth
+func (p *PrivacyController) RequestDataExport(c *gin.Context) {
+	user, ok := currentUser(c, "RequestDataExport")
+	if !ok {
+		return
+	}
+
+	export, err := privacy.RequestExport(context.TODO(), user)
+	if err != nil {
+		utils.Logger.Errorf("RequestDataExport: Error queueing data export for %s: %v", user.Email, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error requesting data export", nil))
+		return
+	}
+
+	utils.Logger.Infof("Data export %s requested by %s", export.ID.Hex(), user.Email)
+	c.JSON(http.StatusAccepted, export)
+}
+
+// GetDataExport godoc
+// @Summary Get a data export
+// @Description Get the status of one of the authenticated user's data exports
+// @Tags user
+// @Produce json
+// @Param id path string true "Data export ID"
+// @Success 200 {object} models.DataExport
+// @Failure 400 {object} utils.ErrorResponse "Invalid data export ID"
+// @Failure 401 {object} utils.ErrorResponse "Unauthorized"
+// @Failure 404 {object} utils.ErrorResponse "Data export not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/user/data-export/{id} [get]
+// @Security BearerAuth
+func (p *PrivacyController) GetDataExport(c *gin.Context) {
+	export, ok := findDataExport(c, "GetDataExport")
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, export)
+}
+
+// DownloadDataExport godoc
+// @Summary Download a data export
+// @Description Download the zip archive of a ready data export, holding one JSON file per kind of data
+// @Tags user
+// @Produce application/zip
+// @Param id path string true "Data export ID"
+// @Success 200 {file} file "Data export archive"
+// @Failure 400 {object} utils.ErrorResponse "Invalid data export ID"
+// @Failure 401 {object} utils.ErrorResponse "Unauthorized"
+// @Failure 404 {object} utils.ErrorResponse "Data export not found"
+// @Failure 409 {object} utils.ErrorResponse "Data export not ready"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/user/data-export/{id}/download [get]
+// @Security BearerAuth
+func (p *PrivacyController) DownloadDataExport(c *gin.Context) {
+	export, ok := findDataExport(c, "DownloadDataExport")
+	if !ok {
+		return
+	}
+
+	archive, err := privacy.OpenArchive(export)
+	if err == privacy.ErrExportNotReady {
+		utils.Logger.Errorf("DownloadDataExport: Data export %s is %s", export.ID.Hex(), export.Status)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Data export not ready", map[string]string{"status": export.Status}))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("DownloadDataExport: Error opening data export %s: %v", export.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error downloading data export", nil))
+		return
+	}
+	defer archive.Close()
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="data-export-%s.zip"`, export.ID.Hex()))
+	c.Header("Content-Length", strconv.FormatInt(export.Size, 10))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, archive); err != nil {
+		utils.Logger.Errorf("DownloadDataExport: Error streaming data export %s: %v", export.ID.Hex(), err)
+		return
+	}
+	utils.Logger.Infof("Data export %s downloaded", export.ID.Hex())
+}
+
+// RequestAccountDeletion godoc
+// @Summary Request the deletion of your account
+// @Description Schedule the erasure of the authenticated user's account after a cooling-off period, during which the request can be cancelled. Erasure anonymises the account's personal data; records kept for accountability refer to the user by a pseudonym. A pending request is returned unchanged.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param request body models.AccountDeletionRequest true "Password confirming the request"
+// @Success 202 {object} models.AccountDeletionResponse
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 401 {object} utils.ErrorResponse "Invalid password"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/user/deletion-request [post]
+// @Security BearerAuth
+func (p *PrivacyController) RequestAccountDeletion(c *gin.Context) {
+	var request models.AccountDeletionRequest
+	if err := c.BindJSON(&request); err != nil {
+		utils.Logger.Errorf("RequestAccountDeletion: Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return
+	}
+
+	// Validate the deletion request
+	if err := utils.ValidateStruct(request); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("RequestAccountDeletion: Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	user, ok := currentUser(c, "RequestAccountDeletion")
+	if !ok {
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.Password)); err != nil {
+		utils.Logger.Errorf("RequestAccountDeletion: Invalid password for %s", user.Email)
+		c.JSON(http.StatusUnauthorized, utils.CreateErrorResponse("Invalid password", nil))
+		return
+	}
+
+	scheduledAt, err := privacy.RequestDeletion(context.TODO(), user, p.config.AccountDeletionCoolingOff)
+	if err != nil {
+		utils.Logger.Errorf("RequestAccountDeletion: Error scheduling deletion of %s: %v", user.Email, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error requesting account deletion", nil))
+		return
+	}
+
+	body := fmt.Sprintf("Your account %s will be deleted on %s and its personal data erased.\n\nIf you did not request this, sign in and cancel the request before then.",
+		user.Username, scheduledAt.UTC().Format(time.RFC3339))
+	if err := worker.EnqueueNotification(context.TODO(), user.Email, "Your account will be deleted", body); err != nil {
+		utils.Logger.Errorf("RequestAccountDeletion: Error queueing notification for %s: %v", user.Email, err)
+	}
+
+	utils.Logger.Infof("Deletion of %s scheduled for %s", user.Email, scheduledAt.UTC().Format(time.RFC3339))
+	c.JSON(http.StatusAccepted, models.AccountDeletionResponse{ScheduledAt: scheduledAt})
+}
+
+// CancelAccountDeletion godoc
+// @Summary Cancel the deletion of your account
+// @Description Cancel the authenticated user's pending account deletion request
+// @Tags user
+// @Produce json
+// @Success 200 {object} map[string]string "message": "Account deletion cancelled"
+// @Failure 401 {object} utils.ErrorResponse "Unauthorized"
+// @Failure 404 {object} utils.ErrorResponse "No pending deletion request"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/user/deletion-request [delete]
+// @Security BearerAuth
+func (p *PrivacyController) CancelAccountDeletion(c *gin.Context) {
+	user, ok := currentUser(c, "CancelAccountDeletion")
+	if !ok {
+		return
+	}
+
+	cancelled, err := privacy.CancelDeletion(context.TODO(), user.ID)
+	if err != nil {
+		utils.Logger.Errorf("CancelAccountDeletion: Error cancelling deletion of %s: %v", user.Email, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error cancelling account deletion", nil))
+		return
+	}
+	if !cancelled {
+		utils.Logger.Errorf("CancelAccountDeletion: No pending deletion request for %s", user.Email)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("No pending deletion request", nil))
+		return
+	}
+
+	utils.Logger.Infof("Deletion of %s cancelled", user.Email)
+	c.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+}
+
+// findDataExport loads the authenticated user's data export named by the
+// id parameter. It writes the error response and returns false on failure.
+func findDataExport(c *gin.Context, handler string) (models.DataExport, bool) {
+	var export models.DataExport
+	objectId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.Logger.Errorf("%s: Invalid data export ID: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid data export ID", nil))
+		return export, false
+	}
+
+	user, ok := currentUser(c, handler)
+	if !ok {
+		return export, false
+	}
+	export, err = privacy.FindExport(context.TODO(), objectId, user.ID)
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("%s: Data export not found with ID: %s", handler, objectId.Hex())
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Data export not found", nil))
+		return export, false
+	}
+	if err != nil {
+		utils.Logger.Errorf("%s: Error fetching data export: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching data export", nil))
+		return export, false
+	}
+	return export, true
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"unified-go-backend/integrity"
+	"unified-go-backend/rbac"
+	"unified-go-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RBACController imports and exports the declarative RBAC configuration.
+type RBACController struct{}
+
+// NewRBACController creates a new RBACController.
+func NewRBACController() *RBACController {
+	return &RBACController{}
+}
+
+// ExportRBAC godoc
+// @Summary Export the RBAC configuration
+// @Description Export the global permissions, roles and access groups as a policy file
+// @Tags rbac
+// @Produce json,application/yaml
+// @Param format query string false "File format" Enums(yaml, json) default(yaml)
+// @Success 200 {object} rbac.File
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/rbac [get]
+// @Security BearerAuth
+func (r *RBACController) ExportRBAC(c *gin.Context) {
+	if !globalContext(c, "ExportRBAC") {
+		return
+	}
+	format := c.DefaultQuery("format", rbac.FormatYAML)
+	if format != rbac.FormatYAML && format != rbac.FormatJSON {
+		utils.Logger.Errorf("ExportRBAC: Invalid format: %s", format)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"format": "must be yaml or json"}))
+		return
+	}
+
+	file, err := rbac.Export(context.TODO())
+	if err != nil {
+		utils.Logger.Errorf("ExportRBAC: Error exporting configuration: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error exporting configuration", nil))
+		return
+	}
+	data, err := rbac.Marshal(file, format)
+	if err != nil {
+		utils.Logger.Errorf("ExportRBAC: Error encoding configuration: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error encoding configuration", nil))
+		return
+	}
+
+	contentType := "application/yaml"
+	if format == rbac.FormatJSON {
+		contentType = "application/json"
+	}
+	utils.Logger.Infof("Exported RBAC configuration with %d roles and %d access groups", len(file.Roles), len(file.AccessGroups))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// PlanRBAC godoc
+// @Summary Plan an RBAC import
+// @Description Diff a policy file (YAML or JSON) against the global permissions, roles and access groups without changing anything
+// @Tags rbac
+// @Accept json,application/yaml
+// @Produce json
+// @Param file body rbac.File true "Policy file"
+// @Param prune query bool false "Delete entries missing from the file"
+// @Success 200 {object} rbac.Plan
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/rbac/plan [post]
+// @Security BearerAuth
+func (r *RBACController) PlanRBAC(c *gin.Context) {
+	r.importRBAC(c, "PlanRBAC", true)
+}
+
+// ImportRBAC godoc
+// @Summary Import an RBAC configuration
+// @Description Make the global permissions, roles and access groups match a policy file (YAML or JSON). Importing the same file again changes nothing. Deleting a role or access group that is still in use fails.
+// @Tags rbac
+// @Accept json,application/yaml
+// @Produce json
+// @Param file body rbac.File true "Policy file"
+// @Param prune query bool false "Delete entries missing from the file"
+// @Success 200 {object} rbac.Plan
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 409 {object} utils.ErrorResponse "A role or access group to delete is still in use"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/rbac/import [post]
+// @Security BearerAuth
+func (r *RBACController) ImportRBAC(c *gin.Context) {
+	r.importRBAC(c, "ImportRBAC", false)
+}
+
+func (r *RBACController) importRBAC(c *gin.Context, handler string, dryRun bool) {
+	if !globalContext(c, handler) {
+		return
+	}
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		utils.Logger.Errorf("%s: Error reading request: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return
+	}
+	file, err := rbac.Parse(data)
+	if err != nil {
+		utils.Logger.Errorf("%s: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", map[string]string{"file": err.Error()}))
+		return
+	}
+
+	plan, validationErrors, err := rbac.Import(context.TODO(), file, c.Query("prune") == "true", dryRun)
+	if validationErrors != nil {
+		utils.Logger.Errorf("%s: Validation error: %v", handler, validationErrors)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+	var inUse *integrity.InUseError
+	if errors.As(err, &inUse) {
+		utils.Logger.Errorf("%s: Import stopped: %v", handler, err)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Import failed", map[string]string{"error": err.Error()}))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("%s: Error applying configuration: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error applying configuration", nil))
+		return
+	}
+
+	utils.Logger.Infof("%s: %d changes", handler, len(plan.Changes))
+	c.JSON(http.StatusOK, plan)
+}
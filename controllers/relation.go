@@ -0,0 +1,382 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"unified-go-backend/authz"
+	"unified-go-backend/models"
+	"unified-go-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RelationController handles relationship-based authorization: the relation
+// schema, relation tuples and checks against them.
+type RelationController struct{}
+
+// NewRelationController creates a new RelationController.
+func NewRelationController() *RelationController {
+	return &RelationController{}
+}
+
+// GetSchema godoc
+// @Summary Get the relation schema
+// @Description Get the schema declaring object types, relations and computed permissions
+// @Tags relation
+// @Produce json
+// @Success 200 {object} models.RelationSchema
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 409 {object} utils.ErrorResponse "No relation schema has been defined"
+// @Router /api/v1/relations/schema [get]
+// @Security BearerAuth
+func (r *RelationController) GetSchema(c *gin.Context) {
+	if !globalContext(c, "GetSchema") {
+		return
+	}
+	if _, err := authz.CurrentSchema(); err != nil {
+		utils.Logger.Errorf("GetSchema: %v", err)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("No relation schema has been defined", nil))
+		return
+	}
+
+	schema, err := authz.SchemaSource(context.TODO())
+	if err != nil {
+		utils.Logger.Errorf("GetSchema: Error fetching schema: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching schema", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, schema)
+}
+
+// UpdateSchema godoc
+// @Summary Replace the relation schema
+// @Description Validate and store a new relation schema. It takes effect on this instance immediately and on others at their next reload.
+// @Tags relation
+// @Accept json
+// @Produce json
+// @Param schema body models.RelationSchema true "Schema source"
+// @Success 200 {object} map[string]string "message": "Schema updated successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid schema"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/relations/schema [put]
+// @Security BearerAuth
+func (r *RelationController) UpdateSchema(c *gin.Context) {
+	if !globalContext(c, "UpdateSchema") {
+		return
+	}
+	var request models.RelationSchema
+	if err := c.BindJSON(&request); err != nil {
+		utils.Logger.Errorf("UpdateSchema: Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return
+	}
+
+	// Validate the schema request
+	if err := utils.ValidateStruct(request); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("UpdateSchema: Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+	if _, err := authz.ParseSchema(request.Source); err != nil {
+		utils.Logger.Errorf("UpdateSchema: Invalid schema: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"source": err.Error()}))
+		return
+	}
+
+	if err := authz.SaveSchema(context.TODO(), request.Source); err != nil {
+		utils.Logger.Errorf("UpdateSchema: Error saving schema: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error saving schema", nil))
+		return
+	}
+
+	utils.Logger.Infof("Relation schema updated successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Schema updated successfully"})
+}
+
+// ListTuples godoc
+// @Summary List relation tuples
+// @Description List relation tuples, optionally filtered by object, relation and subject
+// @Tags relation
+// @Produce json
+// @Param object query string false "Object, e.g. document:42"
+// @Param relation query string false "Relation"
+// @Param subject query string false "Subject, e.g. user:64b... or group:eng#member"
+// @Success 200 {array} models.RelationTuple
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/relations [get]
+// @Security BearerAuth
+func (r *RelationController) ListTuples(c *gin.Context) {
+	if !globalContext(c, "ListTuples") {
+		return
+	}
+	tuples, err := authz.ReadTuples(context.TODO(), c.Query("object"), c.Query("relation"), c.Query("subject"))
+	if err != nil {
+		utils.Logger.Errorf("ListTuples: Error fetching tuples: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching tuples", nil))
+		return
+	}
+
+	utils.Logger.Infof("Fetched %d relation tuples", len(tuples))
+	c.JSON(http.StatusOK, tuples)
+}
+
+// ListObjectTuples godoc
+// @Summary List the relation tuples of an object
+// @Description List who holds which relation on an object. Allowed to users with the view permission on the object under the relation schema.
+// @Tags relation
+// @Produce json
+// @Param type path string true "Object type, e.g. document"
+// @Param id path string true "Object ID"
+// @Success 200 {array} models.RelationTuple
+// @Failure 400 {object} utils.ErrorResponse "Validation error"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 409 {object} utils.ErrorResponse "No relation schema has been defined"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/objects/{type}/{id}/relations [get]
+// @Security BearerAuth
+func (r *RelationController) ListObjectTuples(c *gin.Context) {
+	if !globalContext(c, "ListObjectTuples") {
+		return
+	}
+	object := c.Param("type") + ":" + c.Param("id")
+	tuples, err := authz.ReadTuples(context.TODO(), object, "", "")
+	if err != nil {
+		utils.Logger.Errorf("ListObjectTuples: Error fetching tuples of %s: %v", object, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching tuples", nil))
+		return
+	}
+
+	utils.Logger.Infof("Fetched %d relation tuples of %s", len(tuples), object)
+	c.JSON(http.StatusOK, tuples)
+}
+
+// WriteTuple godoc
+// @Summary Write a relation tuple
+// @Description Grant a subject a relation on an object. Writing an existing tuple has no effect.
+// @Tags relation
+// @Accept json
+// @Produce json
+// @Param tuple body models.RelationTuple true "Relation tuple"
+// @Success 201 {object} map[string]string "message": "Tuple written successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 409 {object} utils.ErrorResponse "No relation schema has been defined"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/relations [post]
+// @Security BearerAuth
+func (r *RelationController) WriteTuple(c *gin.Context) {
+	if !globalContext(c, "WriteTuple") {
+		return
+	}
+	tuple, ok := bindTuple(c, "WriteTuple")
+	if !ok {
+		return
+	}
+
+	schema, err := authz.CurrentSchema()
+	if err != nil {
+		utils.Logger.Errorf("WriteTuple: %v", err)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("No relation schema has been defined", nil))
+		return
+	}
+	if err := schema.ValidateTuple(tuple.Object, tuple.Relation, tuple.Subject); err != nil {
+		utils.Logger.Errorf("WriteTuple: Invalid tuple: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"tuple": err.Error()}))
+		return
+	}
+
+	if err := authz.WriteTuple(context.TODO(), tuple); err != nil {
+		utils.Logger.Errorf("WriteTuple: Error writing tuple: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error writing tuple", nil))
+		return
+	}
+
+	utils.Logger.Infof("Tuple written: %s#%s@%s", tuple.Object, tuple.Relation, tuple.Subject)
+	c.JSON(http.StatusCreated, gin.H{"message": "Tuple written successfully"})
+}
+
+// DeleteTuple godoc
+// @Summary Delete a relation tuple
+// @Description Revoke a subject's relation on an object
+// @Tags relation
+// @Accept json
+// @Produce json
+// @Param tuple body models.RelationTuple true "Relation tuple"
+// @Success 200 {object} map[string]string "message": "Tuple deleted successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Tuple not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/relations [delete]
+// @Security BearerAuth
+func (r *RelationController) DeleteTuple(c *gin.Context) {
+	if !globalContext(c, "DeleteTuple") {
+		return
+	}
+	tuple, ok := bindTuple(c, "DeleteTuple")
+	if !ok {
+		return
+	}
+
+	deleted, err := authz.DeleteTuple(context.TODO(), tuple)
+	if err != nil {
+		utils.Logger.Errorf("DeleteTuple: Error deleting tuple: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error deleting tuple", nil))
+		return
+	}
+	if !deleted {
+		utils.Logger.Errorf("DeleteTuple: Tuple not found: %s#%s@%s", tuple.Object, tuple.Relation, tuple.Subject)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Tuple not found", nil))
+		return
+	}
+
+	utils.Logger.Infof("Tuple deleted: %s#%s@%s", tuple.Object, tuple.Relation, tuple.Subject)
+	c.JSON(http.StatusOK, gin.H{"message": "Tuple deleted successfully"})
+}
+
+// Check godoc
+// @Summary Check a relation
+// @Description Check whether a subject has a relation or permission on an object
+// @Tags relation
+// @Accept json
+// @Produce json
+// @Param check body models.RelationCheckRequest true "Check request"
+// @Success 200 {object} map[string]bool "allowed": true
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 409 {object} utils.ErrorResponse "No relation schema has been defined"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/relations/check [post]
+// @Security BearerAuth
+func (r *RelationController) Check(c *gin.Context) {
+	if !globalContext(c, "Check") {
+		return
+	}
+	var request models.RelationCheckRequest
+	if err := c.BindJSON(&request); err != nil {
+		utils.Logger.Errorf("Check: Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return
+	}
+
+	// Validate the check request
+	if err := utils.ValidateStruct(request); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("Check: Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	allowed, err := authz.Check(context.TODO(), request.Subject, request.Relation, request.Object)
+	if !relationError(c, "Check", err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"allowed": allowed})
+}
+
+// Expand godoc
+// @Summary Expand a relation
+// @Description Expand a relation or permission on an object into the tree of subjects and usersets that hold it
+// @Tags relation
+// @Produce json
+// @Param object query string true "Object, e.g. document:42"
+// @Param relation query string true "Relation or permission"
+// @Success 200 {object} authz.UsersetTree
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 409 {object} utils.ErrorResponse "No relation schema has been defined"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/relations/expand [get]
+// @Security BearerAuth
+func (r *RelationController) Expand(c *gin.Context) {
+	if !globalContext(c, "Expand") {
+		return
+	}
+	object, relation := c.Query("object"), c.Query("relation")
+	if object == "" || relation == "" {
+		utils.Logger.Errorf("Expand: Missing object or relation")
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"object": "required", "relation": "required"}))
+		return
+	}
+
+	tree, err := authz.Expand(context.TODO(), relation, object)
+	if !relationError(c, "Expand", err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, tree)
+}
+
+// ListObjects godoc
+// @Summary List objects a subject can access
+// @Description List the objects of a type on which a subject has a relation or permission
+// @Tags relation
+// @Produce json
+// @Param subject query string true "Subject, e.g. user:64b..."
+// @Param relation query string true "Relation or permission"
+// @Param type query string true "Object type"
+// @Success 200 {array} string
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 409 {object} utils.ErrorResponse "No relation schema has been defined"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/relations/objects [get]
+// @Security BearerAuth
+func (r *RelationController) ListObjects(c *gin.Context) {
+	if !globalContext(c, "ListObjects") {
+		return
+	}
+	subject, relation, objectType := c.Query("subject"), c.Query("relation"), c.Query("type")
+	if subject == "" || relation == "" || objectType == "" {
+		utils.Logger.Errorf("ListObjects: Missing subject, relation or type")
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"subject": "required", "relation": "required", "type": "required"}))
+		return
+	}
+
+	objects, err := authz.ListObjects(context.TODO(), subject, relation, objectType)
+	if !relationError(c, "ListObjects", err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, objects)
+}
+
+// bindTuple reads and validates a relation tuple from the request body. It
+// writes the error response and returns false on failure.
+func bindTuple(c *gin.Context, handler string) (models.RelationTuple, bool) {
+	var tuple models.RelationTuple
+	if err := c.BindJSON(&tuple); err != nil {
+		utils.Logger.Errorf("%s: Invalid request: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return tuple, false
+	}
+
+	// Validate the tuple request
+	if err := utils.ValidateStruct(tuple); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("%s: Validation error: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return tuple, false
+	}
+	return tuple, true
+}
+
+// relationError writes the response for an error returned by the relation
+// store and reports whether the handler may continue.
+func relationError(c *gin.Context, handler string, err error) bool {
+	if err == nil {
+		return true
+	}
+	if err == authz.ErrNoSchema {
+		utils.Logger.Errorf("%s: %v", handler, err)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("No relation schema has been defined", nil))
+		return false
+	}
+	if authz.IsRelationInputError(err) {
+		utils.Logger.Errorf("%s: Invalid request: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"request": err.Error()}))
+		return false
+	}
+	utils.Logger.Errorf("%s: Error evaluating relation: %v", handler, err)
+	c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error evaluating relation", nil))
+	return false
+}
@@ -0,0 +1,568 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"unified-go-backend/authz"
+	"unified-go-backend/database"
+	"unified-go-backend/integrity"
+	"unified-go-backend/models"
+	"unified-go-backend/tenant"
+	"unified-go-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RoleController handles role-related operations.
+type RoleController struct{}
+
+// NewRoleController creates a new RoleController.
+func NewRoleController() *RoleController {
+	return &RoleController{}
+}
+
+// CreateRole godoc
+// @Summary Create a new role
+// @Description Create a new role with a unique name, a set of existing permissions, optional deny rules that override grants and optional parent roles to inherit from. Roles of an organization only inherit from its own roles and cannot grant * or the permissions of platform administration.
+// @Tags role
+// @Accept json
+// @Produce json
+// @Param role body models.Role true "Role data"
+// @Success 201 {object} models.Role
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 409 {object} utils.ErrorResponse "Role already exists"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/roles [post]
+// @Security BearerAuth
+func (r *RoleController) CreateRole(c *gin.Context) {
+	var role models.Role
+	if err := c.BindJSON(&role); err != nil {
+		utils.Logger.Errorf("CreateRole: Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return
+	}
+
+	// Validate the role request
+	if err := utils.ValidateStruct(role); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("CreateRole: Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	role.Permissions = authz.CanonicalList(role.Permissions)
+	role.Deny = authz.CanonicalList(role.Deny)
+	role.ApproverPermission = authz.Canonical(role.ApproverPermission)
+	role.OrgID = tenant.ID(c)
+	missing, err := findMissingPermissions(roleReferencedPermissions(role))
+	if err != nil {
+		utils.Logger.Errorf("CreateRole: Error checking permissions: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error checking permissions", nil))
+		return
+	}
+	if len(missing) > 0 {
+		utils.Logger.Errorf("CreateRole: Unknown permissions: %v", missing)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{
+			"permissions": "unknown permissions: " + strings.Join(missing, ", "),
+		}))
+		return
+	}
+	if !scopedPermissions(c, "CreateRole", role.OrgID, role.Permissions) {
+		return
+	}
+
+	parentErrors, err := validateRoleParents(role)
+	if err != nil {
+		utils.Logger.Errorf("CreateRole: Error checking parent roles: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error checking parent roles", nil))
+		return
+	}
+	if parentErrors != nil {
+		utils.Logger.Errorf("CreateRole: Invalid parent roles: %v", parentErrors)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", parentErrors))
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("roles")
+
+	// Check for duplicate role
+	var existingRole models.Role
+	err = collection.FindOne(context.TODO(), tenant.With(tenant.VisibleRoles(c), bson.M{"name": role.Name})).Decode(&existingRole)
+	if err == nil {
+		utils.Logger.Errorf("CreateRole: Role already exists with name: %s", role.Name)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Role already exists", nil))
+		return
+	}
+	if err != mongo.ErrNoDocuments {
+		utils.Logger.Errorf("CreateRole: Error checking for duplicate role: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error checking for duplicate role", nil))
+		return
+	}
+
+	role.ID = primitive.NewObjectID()
+	_, err = collection.InsertOne(context.TODO(), role)
+	if err != nil {
+		utils.Logger.Errorf("CreateRole: Error creating role: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error creating role", nil))
+		return
+	}
+
+	authz.InvalidateAll(context.TODO())
+
+	utils.Logger.Infof("Role created successfully: %s", role.Name)
+	c.JSON(http.StatusCreated, role)
+}
+
+// ListRoles godoc
+// @Summary List all roles
+// @Description List all roles
+// @Tags role
+// @Produce json
+// @Success 200 {array} models.Role
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/roles [get]
+// @Security BearerAuth
+func (r *RoleController) ListRoles(c *gin.Context) {
+	collection := database.MongoClient.Database("mdmdb").Collection("roles")
+
+	roles := []models.Role{}
+	cursor, err := collection.Find(context.TODO(), tenant.VisibleRoles(c))
+	if err != nil {
+		utils.Logger.Errorf("ListRoles: Error fetching roles: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching roles", nil))
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	for cursor.Next(context.TODO()) {
+		var role models.Role
+		if err := cursor.Decode(&role); err != nil {
+			utils.Logger.Errorf("ListRoles: Error decoding role: %v", err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error decoding role", nil))
+			return
+		}
+		roles = append(roles, role)
+	}
+
+	if err := cursor.Err(); err != nil {
+		utils.Logger.Errorf("ListRoles: Cursor error: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Cursor error", nil))
+		return
+	}
+
+	utils.Logger.Infof("Fetched %d roles", len(roles))
+	c.JSON(http.StatusOK, roles)
+}
+
+// GetRole godoc
+// @Summary Get a role
+// @Description Get a role by ID
+// @Tags role
+// @Produce json
+// @Param id path string true "Role ID"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Role not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/roles/{id} [get]
+// @Security BearerAuth
+func (r *RoleController) GetRole(c *gin.Context) {
+	id := c.Param("id")
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		utils.Logger.Errorf("GetRole: Invalid role ID: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid role ID", nil))
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("roles")
+	var role models.Role
+	err = collection.FindOne(context.TODO(), tenant.With(tenant.VisibleRoles(c), bson.M{"_id": objectId})).Decode(&role)
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("GetRole: Role not found with ID: %s", id)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Role not found", nil))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("GetRole: Error fetching role: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching role", nil))
+		return
+	}
+
+	utils.Logger.Infof("Fetched role: %s", role.Name)
+	c.JSON(http.StatusOK, role)
+}
+
+// UpdateRole godoc
+// @Summary Update a role
+// @Description Update a role's name, permissions, deny rules and parent roles. Renaming a role renames every reference to it. Roles of an organization only inherit from its own roles and cannot grant * or the permissions of platform administration.
+// @Tags role
+// @Accept json
+// @Produce json
+// @Param id path string true "Role ID"
+// @Param role body models.Role true "Role data"
+// @Success 200 {object} map[string]string "message": "Role updated successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Role not found"
+// @Failure 409 {object} utils.ErrorResponse "Role already exists"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/roles/{id} [put]
+// @Security BearerAuth
+func (r *RoleController) UpdateRole(c *gin.Context) {
+	id := c.Param("id")
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		utils.Logger.Errorf("UpdateRole: Invalid role ID: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid role ID", nil))
+		return
+	}
+
+	var role models.Role
+	if err := c.BindJSON(&role); err != nil {
+		utils.Logger.Errorf("UpdateRole: Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return
+	}
+
+	// Validate the role request
+	if err := utils.ValidateStruct(role); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("UpdateRole: Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	role.Permissions = authz.CanonicalList(role.Permissions)
+	role.Deny = authz.CanonicalList(role.Deny)
+	role.ApproverPermission = authz.Canonical(role.ApproverPermission)
+	role.OrgID = tenant.ID(c)
+	missing, err := findMissingPermissions(roleReferencedPermissions(role))
+	if err != nil {
+		utils.Logger.Errorf("UpdateRole: Error checking permissions: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error checking permissions", nil))
+		return
+	}
+	if len(missing) > 0 {
+		utils.Logger.Errorf("UpdateRole: Unknown permissions: %v", missing)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{
+			"permissions": "unknown permissions: " + strings.Join(missing, ", "),
+		}))
+		return
+	}
+	if !scopedPermissions(c, "UpdateRole", role.OrgID, role.Permissions) {
+		return
+	}
+
+	role.ID = objectId
+	parentErrors, err := validateRoleParents(role)
+	if err != nil {
+		utils.Logger.Errorf("UpdateRole: Error checking parent roles: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error checking parent roles", nil))
+		return
+	}
+	if parentErrors != nil {
+		utils.Logger.Errorf("UpdateRole: Invalid parent roles: %v", parentErrors)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", parentErrors))
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("roles")
+
+	// Check that no other role already uses the requested name
+	var existingRole models.Role
+	err = collection.FindOne(context.TODO(), tenant.With(tenant.VisibleRoles(c), bson.M{"name": role.Name, "_id": bson.M{"$ne": objectId}})).Decode(&existingRole)
+	if err == nil {
+		utils.Logger.Errorf("UpdateRole: Role already exists with name: %s", role.Name)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Role already exists", nil))
+		return
+	}
+	if err != mongo.ErrNoDocuments {
+		utils.Logger.Errorf("UpdateRole: Error checking for duplicate role: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error checking for duplicate role", nil))
+		return
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"name":                role.Name,
+			"permissions":         role.Permissions,
+			"deny":                role.Deny,
+			"parents":             role.Parents,
+			"approver_permission": role.ApproverPermission,
+		},
+	}
+
+	// Keep the previous version to rewrite the references on a rename
+	var previous models.Role
+	filter := tenant.With(tenant.Filter(c), bson.M{"_id": objectId})
+	err = collection.FindOneAndUpdate(context.TODO(), filter, update).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("UpdateRole: Role not found with ID: %s", id)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Role not found", nil))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("UpdateRole: Error updating role: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error updating role", nil))
+		return
+	}
+	if previous.Name != role.Name {
+		role.ID = objectId
+		if err := integrity.RenameRole(context.TODO(), role, previous.Name); err != nil {
+			utils.Logger.Errorf("UpdateRole: Error renaming references to role %s: %v", previous.Name, err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error renaming role references", nil))
+			return
+		}
+		utils.Logger.Infof("Role %s renamed to %s", previous.Name, role.Name)
+	}
+
+	authz.InvalidateAll(context.TODO())
+
+	utils.Logger.Infof("Role updated successfully: %s", id)
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated successfully"})
+}
+
+// DeleteRole godoc
+// @Summary Delete a role
+// @Description Delete a role by ID. By default a role still assigned to users, access groups or teams, or inherited by other roles, cannot be deleted; cascade=strip removes every reference and cascade=reassign replaces them with the fallback role.
+// @Tags role
+// @Produce json
+// @Param id path string true "Role ID"
+// @Param cascade query string false "What to do with the references: block, strip or reassign" Enums(block, strip, reassign)
+// @Param fallback query string false "Name of the role replacing the deleted one, required with cascade=reassign"
+// @Success 200 {object} map[string]string "message": "Role deleted successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Role not found"
+// @Failure 409 {object} utils.ErrorResponse "Role is still in use"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/roles/{id} [delete]
+// @Security BearerAuth
+func (r *RoleController) DeleteRole(c *gin.Context) {
+	id := c.Param("id")
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		utils.Logger.Errorf("DeleteRole: Invalid role ID: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid role ID", nil))
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("roles")
+	var role models.Role
+	err = collection.FindOne(context.TODO(), tenant.With(tenant.Filter(c), bson.M{"_id": objectId})).Decode(&role)
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("DeleteRole: Role not found with ID: %s", id)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Role not found", nil))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("DeleteRole: Error fetching role: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching role", nil))
+		return
+	}
+
+	mode := c.DefaultQuery("cascade", integrity.CascadeBlock)
+	if !integrity.ValidCascade(mode) {
+		utils.Logger.Errorf("DeleteRole: Invalid cascade mode: %s", mode)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"cascade": "must be block, strip or reassign"}))
+		return
+	}
+	fallback := c.Query("fallback")
+	if mode == integrity.CascadeReassign {
+		roles, err := authz.LoadRoles(context.TODO(), role.OrgID)
+		if err != nil {
+			utils.Logger.Errorf("DeleteRole: Error fetching roles: %v", err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching roles", nil))
+			return
+		}
+		// A global role is referenced from every organization, so only a
+		// global role can take over
+		target, exists := roles[fallback]
+		if !exists || fallback == role.Name || role.OrgID.IsZero() && !target.OrgID.IsZero() {
+			utils.Logger.Errorf("DeleteRole: Invalid fallback role: %s", fallback)
+			c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"fallback": "must be another role usable wherever the role is"}))
+			return
+		}
+	}
+
+	err = integrity.DeleteRole(context.TODO(), role, mode, fallback)
+	var inUse *integrity.InUseError
+	if errors.As(err, &inUse) {
+		utils.Logger.Errorf("DeleteRole: Role %s is %v", role.Name, inUse)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Role is still in use", inUse.Details()))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("DeleteRole: Error deleting role: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error deleting role", nil))
+		return
+	}
+
+	authz.InvalidateAll(context.TODO())
+
+	utils.Logger.Infof("Role deleted successfully: %s (cascade %s)", role.Name, mode)
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
+
+// GetRoleTree godoc
+// @Summary Get a role's inheritance tree
+// @Description Get a role with its parent roles expanded recursively, including the effective permissions at every level
+// @Tags role
+// @Produce json
+// @Param id path string true "Role ID"
+// @Success 200 {object} authz.RoleTree
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Role not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/roles/{id}/tree [get]
+// @Security BearerAuth
+func (r *RoleController) GetRoleTree(c *gin.Context) {
+	id := c.Param("id")
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		utils.Logger.Errorf("GetRoleTree: Invalid role ID: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid role ID", nil))
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("roles")
+	var role models.Role
+	err = collection.FindOne(context.TODO(), tenant.With(tenant.VisibleRoles(c), bson.M{"_id": objectId})).Decode(&role)
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("GetRoleTree: Role not found with ID: %s", id)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Role not found", nil))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("GetRoleTree: Error fetching role: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching role", nil))
+		return
+	}
+
+	roles, err := authz.LoadRoles(context.TODO(), tenant.ID(c))
+	if err != nil {
+		utils.Logger.Errorf("GetRoleTree: Error fetching roles: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching roles", nil))
+		return
+	}
+
+	utils.Logger.Infof("Fetched role tree: %s", role.Name)
+	c.JSON(http.StatusOK, authz.BuildRoleTree(roles, role.Name))
+}
+
+// validateRoleParents checks that every parent of role exists and that
+// inheriting from them would not create a cycle. An updated role is
+// identified by its ID, since it may be renamed. It returns validation
+// errors keyed by field, or nil when the parents are valid.
+func validateRoleParents(role models.Role) (map[string]string, error) {
+	if len(role.Parents) == 0 {
+		return nil, nil
+	}
+
+	roles, err := authz.LoadRoles(context.TODO(), role.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	// Check the inheritance as it will be once the role is saved under its
+	// new name
+	roles = authz.ReplaceRole(authz.OwnRoles(roles, role.OrgID), role)
+
+	var missing []string
+	for _, parent := range role.Parents {
+		if _, exists := roles[parent]; !exists {
+			missing = append(missing, parent)
+		}
+	}
+	if len(missing) > 0 {
+		return map[string]string{"parents": "unknown roles: " + strings.Join(missing, ", ")}, nil
+	}
+
+	if cycle := authz.FindCycle(roles, role.Name, role.Parents); cycle != nil {
+		return map[string]string{"parents": "inheritance cycle: " + strings.Join(cycle, " -> ")}, nil
+	}
+	return nil, nil
+}
+
+// roleReferencedPermissions lists every permission a role refers to.
+func roleReferencedPermissions(role models.Role) []string {
+	permissions := append(append([]string{}, role.Permissions...), role.Deny...)
+	if role.ApproverPermission != "" {
+		permissions = append(permissions, role.ApproverPermission)
+	}
+	return permissions
+}
+
+// findMissingPermissions returns the names in permissions that have no
+// matching document in the permissions collection. Wildcard patterns are
+// accepted when they cover at least one known permission.
+func findMissingPermissions(permissions []string) ([]string, error) {
+	if len(permissions) == 0 {
+		return nil, nil
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("permissions")
+	cursor, err := collection.Find(context.TODO(), bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var known []string
+	for cursor.Next(context.TODO()) {
+		var permission models.Permission
+		if err := cursor.Decode(&permission); err != nil {
+			return nil, err
+		}
+		known = append(known, authz.Canonical(permission.Name))
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, name := range permissions {
+		if !coversKnownPermission(name, known) {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+// scopedPermissions checks that the roles and access groups of org only
+// grant permissions organizations may grant; outside organizations any is
+// allowed. It writes the error response and returns false otherwise.
+func scopedPermissions(c *gin.Context, handler string, org primitive.ObjectID, permissions []string) bool {
+	if org.IsZero() {
+		return true
+	}
+	var unscoped []string
+	for _, name := range permissions {
+		if !authz.OrgScoped(name) {
+			unscoped = append(unscoped, name)
+		}
+	}
+	if len(unscoped) == 0 {
+		return true
+	}
+	utils.Logger.Errorf("%s: Permissions not grantable inside organization %s: %v", handler, org.Hex(), unscoped)
+	c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{
+		"permissions": "not grantable inside an organization: " + strings.Join(unscoped, ", "),
+	}))
+	return false
+}
+
+func coversKnownPermission(name string, known []string) bool {
+	if name == "*" {
+		return true
+	}
+	for _, perm := range known {
+		if authz.Matches(name, perm) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,485 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+	"unified-go-backend/authz"
+	"unified-go-backend/config"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/tenant"
+	"unified-go-backend/utils"
+	"unified-go-backend/worker"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultApproverPermission is required to approve requests for roles that
+// do not name their own approver permission.
+const DefaultApproverPermission = "role_requests:approve"
+
+// RoleRequestController handles requests for temporary role grants.
+type RoleRequestController struct {
+	cfg *config.Config
+}
+
+// NewRoleRequestController creates a new RoleRequestController.
+func NewRoleRequestController(cfg *config.Config) *RoleRequestController {
+	return &RoleRequestController{cfg: cfg}
+}
+
+// CreateRoleRequest godoc
+// @Summary Request a temporary role
+// @Description Request a role for a limited duration, e.g. "4h". Users holding the role's approver permission are notified and can approve or deny the request.
+// @Tags role_request
+// @Accept json
+// @Produce json
+// @Param request body models.NewRoleRequest true "Role request"
+// @Success 201 {object} models.RoleRequest
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 401 {object} utils.ErrorResponse "Unauthorized"
+// @Failure 409 {object} utils.ErrorResponse "Role already held or requested"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/role_requests [post]
+// @Security BearerAuth
+func (r *RoleRequestController) CreateRoleRequest(c *gin.Context) {
+	if !globalContext(c, "CreateRoleRequest") {
+		return
+	}
+	var request models.NewRoleRequest
+	if err := c.BindJSON(&request); err != nil {
+		utils.Logger.Errorf("CreateRoleRequest: Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return
+	}
+
+	// Validate the role request
+	if err := utils.ValidateStruct(request); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("CreateRoleRequest: Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	duration, err := time.ParseDuration(request.Duration)
+	if err != nil || duration <= 0 || duration > r.cfg.RoleGrantMaxDuration {
+		utils.Logger.Errorf("CreateRoleRequest: Invalid duration: %s", request.Duration)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{
+			"duration": "must be a positive duration of at most " + r.cfg.RoleGrantMaxDuration.String(),
+		}))
+		return
+	}
+
+	user, ok := currentUser(c, "CreateRoleRequest")
+	if !ok {
+		return
+	}
+
+	role, err := findRoleByName(request.Role)
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("CreateRoleRequest: Role not found with name: %s", request.Role)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"role": "unknown role"}))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("CreateRoleRequest: Error fetching role: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching role", nil))
+		return
+	}
+
+	if holdsRole(user, role.Name, time.Now()) {
+		utils.Logger.Errorf("CreateRoleRequest: User %s already holds role %s", user.Email, role.Name)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Role already held", nil))
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("role_requests")
+
+	// Only one pending request per user and role
+	var existing models.RoleRequest
+	err = collection.FindOne(context.TODO(), bson.M{"user_id": user.ID, "role": role.Name, "status": models.RoleRequestPending}).Decode(&existing)
+	if err == nil {
+		utils.Logger.Errorf("CreateRoleRequest: User %s already requested role %s", user.Email, role.Name)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Role request already pending", nil))
+		return
+	}
+	if err != mongo.ErrNoDocuments {
+		utils.Logger.Errorf("CreateRoleRequest: Error checking for pending request: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error checking for pending request", nil))
+		return
+	}
+
+	roleRequest := models.RoleRequest{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      role.Name,
+		Reason:    request.Reason,
+		Duration:  duration.String(),
+		Status:    models.RoleRequestPending,
+		CreatedAt: time.Now(),
+	}
+	if _, err := collection.InsertOne(context.TODO(), roleRequest); err != nil {
+		utils.Logger.Errorf("CreateRoleRequest: Error creating role request: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error creating role request", nil))
+		return
+	}
+
+	notifyApprovers(role, roleRequest)
+
+	utils.Logger.Infof("Role request created: %s requested %s for %s", user.Email, role.Name, roleRequest.Duration)
+	c.JSON(http.StatusCreated, roleRequest)
+}
+
+// ListRoleRequests godoc
+// @Summary List role requests
+// @Description List temporary role requests, newest first, optionally filtered by status
+// @Tags role_request
+// @Produce json
+// @Param status query string false "Request status" Enums(pending, approved, denied, expired)
+// @Success 200 {array} models.RoleRequest
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/role_requests [get]
+// @Security BearerAuth
+func (r *RoleRequestController) ListRoleRequests(c *gin.Context) {
+	if !globalContext(c, "ListRoleRequests") {
+		return
+	}
+	filter := bson.M{}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	listRoleRequests(c, "ListRoleRequests", filter)
+}
+
+// ListMyRoleRequests godoc
+// @Summary List the caller's role requests
+// @Description List the authenticated user's temporary role requests, newest first
+// @Tags role_request
+// @Produce json
+// @Success 200 {array} models.RoleRequest
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 401 {object} utils.ErrorResponse "Unauthorized"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/user/role_requests [get]
+// @Security BearerAuth
+func (r *RoleRequestController) ListMyRoleRequests(c *gin.Context) {
+	if !globalContext(c, "ListMyRoleRequests") {
+		return
+	}
+	user, ok := currentUser(c, "ListMyRoleRequests")
+	if !ok {
+		return
+	}
+	listRoleRequests(c, "ListMyRoleRequests", bson.M{"user_id": user.ID})
+}
+
+// ApproveRoleRequest godoc
+// @Summary Approve a role request
+// @Description Approve a pending role request. The approver needs the role's approver permission and cannot approve their own request. The role is granted until the requested duration has passed, replacing any earlier grant of the role; requests for a role the user has since been given permanently cannot be approved.
+// @Tags role_request
+// @Accept json
+// @Produce json
+// @Param id path string true "Role request ID"
+// @Param decision body models.RoleRequestDecision false "Decision note"
+// @Success 200 {object} models.RoleRequest
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 404 {object} utils.ErrorResponse "Role request not found"
+// @Failure 409 {object} utils.ErrorResponse "Role request already decided or role already held"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/role_requests/{id}/approve [post]
+// @Security BearerAuth
+func (r *RoleRequestController) ApproveRoleRequest(c *gin.Context) {
+	r.decideRoleRequest(c, "ApproveRoleRequest", models.RoleRequestApproved)
+}
+
+// DenyRoleRequest godoc
+// @Summary Deny a role request
+// @Description Deny a pending role request. The approver needs the role's approver permission.
+// @Tags role_request
+// @Accept json
+// @Produce json
+// @Param id path string true "Role request ID"
+// @Param decision body models.RoleRequestDecision false "Decision note"
+// @Success 200 {object} models.RoleRequest
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 404 {object} utils.ErrorResponse "Role request not found"
+// @Failure 409 {object} utils.ErrorResponse "Role request already decided"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/role_requests/{id}/deny [post]
+// @Security BearerAuth
+func (r *RoleRequestController) DenyRoleRequest(c *gin.Context) {
+	r.decideRoleRequest(c, "DenyRoleRequest", models.RoleRequestDenied)
+}
+
+func (r *RoleRequestController) decideRoleRequest(c *gin.Context, handler, status string) {
+	if !globalContext(c, handler) {
+		return
+	}
+	objectId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.Logger.Errorf("%s: Invalid role request ID: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid role request ID", nil))
+		return
+	}
+
+	var decision models.RoleRequestDecision
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&decision); err != nil {
+			utils.Logger.Errorf("%s: Invalid request: %v", handler, err)
+			c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+			return
+		}
+	}
+	if err := utils.ValidateStruct(decision); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("%s: Validation error: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	approver, ok := currentUser(c, handler)
+	if !ok {
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("role_requests")
+	var roleRequest models.RoleRequest
+	err = collection.FindOne(context.TODO(), bson.M{"_id": objectId}).Decode(&roleRequest)
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("%s: Role request not found with ID: %s", handler, objectId.Hex())
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Role request not found", nil))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("%s: Error fetching role request: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching role request", nil))
+		return
+	}
+	if roleRequest.Status != models.RoleRequestPending {
+		utils.Logger.Errorf("%s: Role request %s is already %s", handler, objectId.Hex(), roleRequest.Status)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Role request already decided", nil))
+		return
+	}
+
+	role, err := findRoleByName(roleRequest.Role)
+	if err != nil {
+		utils.Logger.Errorf("%s: Error fetching role %s: %v", handler, roleRequest.Role, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching role", nil))
+		return
+	}
+
+	// Approvers need the role's approver permission outside any organization
+	// and may not decide their own requests
+	if approver.ID == roleRequest.UserID {
+		utils.Logger.Warnf("%s: User %s tried to decide their own role request", handler, approver.Email)
+		c.JSON(http.StatusForbidden, utils.CreateErrorResponse("Forbidden", nil))
+		return
+	}
+	grants, err := authz.ResolveUser(context.TODO(), approver, primitive.NilObjectID)
+	if err != nil {
+		utils.Logger.Errorf("%s: Error resolving permissions: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error resolving permissions", nil))
+		return
+	}
+	permission := approverPermission(role)
+	authorization := grants.Authorize(authz.PolicyRequest{
+		Action:   permission,
+		Subject:  approver,
+		Resource: roleRequest,
+		IP:       c.ClientIP(),
+		Time:     time.Now(),
+	})
+	if !authorization.Allowed {
+		utils.Logger.Warnf("%s: User %s refused %s", handler, approver.Email, permission)
+		utils.Logger.Debugf("%s: User %s refused %s: %s", handler, approver.Email, permission, authorization.Reason)
+		c.JSON(http.StatusForbidden, utils.CreateErrorResponse("Forbidden", nil))
+		return
+	}
+
+	// The role may have been given to the requester since the request was
+	// made, permanently or by another request
+	users := database.MongoClient.Database("mdmdb").Collection("users")
+	if status == models.RoleRequestApproved {
+		var requester models.User
+		if err := users.FindOne(context.TODO(), bson.M{"_id": roleRequest.UserID}).Decode(&requester); err != nil {
+			utils.Logger.Errorf("%s: Error fetching requester %s: %v", handler, roleRequest.Email, err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching user", nil))
+			return
+		}
+		for _, name := range requester.Roles {
+			if name == roleRequest.Role {
+				utils.Logger.Errorf("%s: User %s already holds role %s", handler, roleRequest.Email, roleRequest.Role)
+				c.JSON(http.StatusConflict, utils.CreateErrorResponse("Role already held", nil))
+				return
+			}
+		}
+	}
+
+	now := time.Now()
+	set := bson.M{
+		"status":     status,
+		"decided_by": approver.Email,
+		"decided_at": now,
+		"note":       decision.Note,
+	}
+	if status == models.RoleRequestApproved {
+		duration, err := time.ParseDuration(roleRequest.Duration)
+		if err != nil {
+			utils.Logger.Errorf("%s: Invalid stored duration %q: %v", handler, roleRequest.Duration, err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error approving role request", nil))
+			return
+		}
+		set["expires_at"] = now.Add(duration)
+	}
+
+	// Only decide requests that are still pending
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = collection.FindOneAndUpdate(context.TODO(),
+		bson.M{"_id": objectId, "status": models.RoleRequestPending},
+		bson.M{"$set": set},
+		opts,
+	).Decode(&roleRequest)
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("%s: Role request %s was decided concurrently", handler, objectId.Hex())
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Role request already decided", nil))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("%s: Error updating role request: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error updating role request", nil))
+		return
+	}
+
+	if status == models.RoleRequestApproved {
+		grant := models.RoleGrant{
+			Role:      roleRequest.Role,
+			ExpiresAt: roleRequest.ExpiresAt,
+			GrantedBy: approver.Email,
+			RequestID: roleRequest.ID,
+		}
+		// A grant of the same role from an earlier request is replaced, so
+		// that a user holds at most one grant per role
+		replace := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"role_grants": bson.M{"$concatArrays": bson.A{
+				bson.M{"$filter": bson.M{
+					"input": bson.M{"$ifNull": bson.A{"$role_grants", bson.A{}}},
+					"cond":  bson.M{"$ne": bson.A{"$$this.role", grant.Role}},
+				}},
+				bson.A{grant},
+			}},
+		}}}}
+		_, err := users.UpdateOne(context.TODO(), bson.M{"_id": roleRequest.UserID}, replace)
+		if err != nil {
+			utils.Logger.Errorf("%s: Error granting role %s to %s: %v", handler, grant.Role, roleRequest.Email, err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error granting role", nil))
+			return
+		}
+		authz.InvalidateUsers(context.TODO(), roleRequest.UserID)
+	}
+
+	notifyRequester(roleRequest)
+
+	utils.Logger.Infof("Role request %s %s by %s", objectId.Hex(), status, approver.Email)
+	c.JSON(http.StatusOK, roleRequest)
+}
+
+func listRoleRequests(c *gin.Context, handler string, filter bson.M) {
+	collection := database.MongoClient.Database("mdmdb").Collection("role_requests")
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := collection.Find(context.TODO(), filter, findOptions)
+	if err != nil {
+		utils.Logger.Errorf("%s: Error fetching role requests: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching role requests", nil))
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	requests := []models.RoleRequest{}
+	if err := cursor.All(context.TODO(), &requests); err != nil {
+		utils.Logger.Errorf("%s: Error decoding role requests: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error decoding role requests", nil))
+		return
+	}
+
+	utils.Logger.Infof("Fetched %d role requests", len(requests))
+	c.JSON(http.StatusOK, requests)
+}
+
+// findRoleByName loads a global role. Temporary grants only cover global
+// roles.
+func findRoleByName(name string) (models.Role, error) {
+	var role models.Role
+	collection := database.MongoClient.Database("mdmdb").Collection("roles")
+	err := collection.FindOne(context.TODO(), tenant.With(tenant.OwnedBy(primitive.NilObjectID), bson.M{"name": name})).Decode(&role)
+	return role, err
+}
+
+// holdsRole reports whether the user has the role directly or through an
+// unexpired grant.
+func holdsRole(user models.User, role string, now time.Time) bool {
+	for _, name := range user.Roles {
+		if name == role {
+			return true
+		}
+	}
+	for _, grant := range user.RoleGrants {
+		if grant.Role == role && grant.ExpiresAt.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func approverPermission(role models.Role) string {
+	if role.ApproverPermission != "" {
+		return role.ApproverPermission
+	}
+	return DefaultApproverPermission
+}
+
+// notifyApprovers queues an email for every user allowed to decide the
+// request. Failures are logged and do not affect the request.
+func notifyApprovers(role models.Role, request models.RoleRequest) {
+	approvers, err := authz.UsersWithPermission(context.TODO(), approverPermission(role))
+	if err != nil {
+		utils.Logger.Errorf("notifyApprovers: Error finding approvers for role %s: %v", role.Name, err)
+		return
+	}
+
+	subject := "Role request: " + request.Role + " for " + request.Email
+	body := fmt.Sprintf("%s requested the %s role for %s.\n\nReason: %s\n\nRequest ID: %s",
+		request.Email, request.Role, request.Duration, request.Reason, request.ID.Hex())
+	for _, approver := range approvers {
+		if approver.ID == request.UserID {
+			continue
+		}
+		if err := worker.EnqueueNotification(context.TODO(), approver.Email, subject, body); err != nil {
+			utils.Logger.Errorf("notifyApprovers: Error queueing notification for %s: %v", approver.Email, err)
+		}
+	}
+}
+
+// notifyRequester queues an email telling the requester about the decision.
+func notifyRequester(request models.RoleRequest) {
+	subject := "Role request " + request.Status + ": " + request.Role
+	body := fmt.Sprintf("Your request for the %s role was %s by %s.", request.Role, request.Status, request.DecidedBy)
+	if request.Status == models.RoleRequestApproved {
+		body += fmt.Sprintf(" It expires at %s.", request.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	if request.Note != "" {
+		body += "\n\nNote: " + request.Note
+	}
+	if err := worker.EnqueueNotification(context.TODO(), request.Email, subject, body); err != nil {
+		utils.Logger.Errorf("notifyRequester: Error queueing notification for %s: %v", request.Email, err)
+	}
+}
@@ -0,0 +1,665 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+	"unified-go-backend/authz"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/tenant"
+	"unified-go-backend/userquery"
+	"unified-go-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TeamController handles teams and their delegated administration.
+type TeamController struct{}
+
+// NewTeamController creates a new TeamController.
+func NewTeamController() *TeamController {
+	return &TeamController{}
+}
+
+// CreateTeam godoc
+// @Summary Create a team
+// @Description Create a team, optionally nested under a parent team. A team can only make assignable the roles its parent can assign.
+// @Tags team
+// @Accept json
+// @Produce json
+// @Param team body models.TeamRequest true "Team"
+// @Success 201 {object} models.Team
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 409 {object} utils.ErrorResponse "Team already exists"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/teams [post]
+// @Security BearerAuth
+func (t *TeamController) CreateTeam(c *gin.Context) {
+	team, teams, ok := bindTeam(c, "CreateTeam", primitive.NilObjectID)
+	if !ok {
+		return
+	}
+
+	team.ID = primitive.NewObjectID()
+	team.CreatedAt = time.Now()
+	if !validateTeam(c, "CreateTeam", team, teams) {
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("teams")
+	if _, err := collection.InsertOne(context.TODO(), team); err != nil {
+		utils.Logger.Errorf("CreateTeam: Error creating team: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error creating team", nil))
+		return
+	}
+
+	utils.Logger.Infof("Team created successfully: %s", team.Name)
+	c.JSON(http.StatusCreated, team)
+}
+
+// ListTeams godoc
+// @Summary List teams
+// @Description List the teams of the request's organization
+// @Tags team
+// @Produce json
+// @Success 200 {array} models.Team
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/teams [get]
+// @Security BearerAuth
+func (t *TeamController) ListTeams(c *gin.Context) {
+	collection := database.MongoClient.Database("mdmdb").Collection("teams")
+	cursor, err := collection.Find(context.TODO(), tenant.Filter(c))
+	if err != nil {
+		utils.Logger.Errorf("ListTeams: Error fetching teams: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching teams", nil))
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	teams := []models.Team{}
+	if err := cursor.All(context.TODO(), &teams); err != nil {
+		utils.Logger.Errorf("ListTeams: Error decoding teams: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error decoding teams", nil))
+		return
+	}
+
+	utils.Logger.Infof("Fetched %d teams", len(teams))
+	c.JSON(http.StatusOK, teams)
+}
+
+// ListMyTeams godoc
+// @Summary List the caller's teams
+// @Description List the authenticated user's team memberships in the request's organization
+// @Tags team
+// @Produce json
+// @Success 200 {array} models.TeamMembership
+// @Failure 401 {object} utils.ErrorResponse "Unauthorized"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/user/teams [get]
+// @Security BearerAuth
+func (t *TeamController) ListMyTeams(c *gin.Context) {
+	user, ok := currentUser(c, "ListMyTeams")
+	if !ok {
+		return
+	}
+
+	teams, err := authz.LoadTeams(context.TODO(), tenant.ID(c))
+	if err != nil {
+		utils.Logger.Errorf("ListMyTeams: Error fetching teams: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching teams", nil))
+		return
+	}
+
+	memberships := []models.TeamMembership{}
+	for _, membership := range user.Teams {
+		if _, exists := teams[membership.TeamID]; exists {
+			memberships = append(memberships, membership)
+		}
+	}
+
+	utils.Logger.Infof("Fetched %d teams of %s", len(memberships), user.Email)
+	c.JSON(http.StatusOK, memberships)
+}
+
+// GetTeam godoc
+// @Summary Get a team
+// @Description Get a team by ID
+// @Tags team
+// @Produce json
+// @Param id path string true "Team ID"
+// @Success 200 {object} models.Team
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Team not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/teams/{id} [get]
+// @Security BearerAuth
+func (t *TeamController) GetTeam(c *gin.Context) {
+	team, _, ok := findTeamByParam(c, "GetTeam")
+	if !ok {
+		return
+	}
+
+	utils.Logger.Infof("Fetched team: %s", team.Name)
+	c.JSON(http.StatusOK, team)
+}
+
+// UpdateTeam godoc
+// @Summary Update a team
+// @Description Update a team's name, parent, roles and assignable roles
+// @Tags team
+// @Accept json
+// @Produce json
+// @Param id path string true "Team ID"
+// @Param team body models.TeamRequest true "Team"
+// @Success 200 {object} models.Team
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Team not found"
+// @Failure 409 {object} utils.ErrorResponse "Team already exists"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/teams/{id} [put]
+// @Security BearerAuth
+func (t *TeamController) UpdateTeam(c *gin.Context) {
+	existing, _, ok := findTeamByParam(c, "UpdateTeam")
+	if !ok {
+		return
+	}
+	team, teams, ok := bindTeam(c, "UpdateTeam", existing.ID)
+	if !ok {
+		return
+	}
+
+	team.ID = existing.ID
+	team.CreatedAt = existing.CreatedAt
+	if !validateTeam(c, "UpdateTeam", team, teams) {
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("teams")
+	if _, err := collection.ReplaceOne(context.TODO(), bson.M{"_id": team.ID}, team); err != nil {
+		utils.Logger.Errorf("UpdateTeam: Error updating team: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error updating team", nil))
+		return
+	}
+
+	authz.InvalidateAll(context.TODO())
+
+	utils.Logger.Infof("Team updated successfully: %s", team.Name)
+	c.JSON(http.StatusOK, team)
+}
+
+// DeleteTeam godoc
+// @Summary Delete a team
+// @Description Delete a team without child teams and remove its memberships
+// @Tags team
+// @Produce json
+// @Param id path string true "Team ID"
+// @Success 200 {object} map[string]string "message": "Team deleted successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Team not found"
+// @Failure 409 {object} utils.ErrorResponse "Team has child teams"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/teams/{id} [delete]
+// @Security BearerAuth
+func (t *TeamController) DeleteTeam(c *gin.Context) {
+	team, teams, ok := findTeamByParam(c, "DeleteTeam")
+	if !ok {
+		return
+	}
+
+	for _, other := range teams {
+		if other.ParentID == team.ID {
+			utils.Logger.Errorf("DeleteTeam: Team %s still has child team %s", team.Name, other.Name)
+			c.JSON(http.StatusConflict, utils.CreateErrorResponse("Team has child teams", nil))
+			return
+		}
+	}
+
+	db := database.MongoClient.Database("mdmdb")
+	if _, err := db.Collection("users").UpdateMany(context.TODO(),
+		bson.M{"teams.team_id": team.ID},
+		bson.M{"$pull": bson.M{"teams": bson.M{"team_id": team.ID}}},
+	); err != nil {
+		utils.Logger.Errorf("DeleteTeam: Error removing memberships: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error removing team memberships", nil))
+		return
+	}
+	if _, err := db.Collection("teams").DeleteOne(context.TODO(), bson.M{"_id": team.ID}); err != nil {
+		utils.Logger.Errorf("DeleteTeam: Error deleting team: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error deleting team", nil))
+		return
+	}
+
+	authz.InvalidateAll(context.TODO())
+
+	utils.Logger.Infof("Team deleted successfully: %s", team.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Team deleted successfully"})
+}
+
+// ListTeamMembers godoc
+// @Summary List team members
+// @Description List the members of a team. Allowed for admins of the team or its ancestors and for users with teams:read. Users are shown as models.UserListItem, or as models.UserAdminView to callers with users:read_sensitive.
+// @Tags team
+// @Produce json
+// @Param id path string true "Team ID"
+// @Success 200 {array} models.UserListItem
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 404 {object} utils.ErrorResponse "Team not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/teams/{id}/members [get]
+// @Security BearerAuth
+func (t *TeamController) ListTeamMembers(c *gin.Context) {
+	team, teams, ok := findTeamByParam(c, "ListTeamMembers")
+	if !ok {
+		return
+	}
+	user, ok := currentUser(c, "ListTeamMembers")
+	if !ok {
+		return
+	}
+	if !authorizeTeamAdmin(c, "ListTeamMembers", "teams:read", user, teams, team.ID) {
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	cursor, err := collection.Find(context.TODO(), userquery.Live(bson.M{"teams.team_id": team.ID}))
+	if err != nil {
+		utils.Logger.Errorf("ListTeamMembers: Error fetching users: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching users", nil))
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	users := []models.User{}
+	if err := cursor.All(context.TODO(), &users); err != nil {
+		utils.Logger.Errorf("ListTeamMembers: Error decoding users: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error decoding users", nil))
+		return
+	}
+
+	views, ok := userViews(c, "ListTeamMembers", users, tenant.ID(c), nil)
+	if !ok {
+		return
+	}
+
+	utils.Logger.Infof("Fetched %d members of team %s", len(users), team.Name)
+	c.JSON(http.StatusOK, views)
+}
+
+// SetTeamMember godoc
+// @Summary Add or update a team member
+// @Description Add a user to a team or replace their team roles and admin flag. Allowed for admins of the team or its ancestors and for users with teams:manage_members. Only roles assignable by the team and all its ancestors can be handed out. Adding members to a team, or making them admins, when the team or its ancestors grant roles beyond those assignable requires teams:manage_members.
+// @Tags team
+// @Accept json
+// @Produce json
+// @Param id path string true "Team ID"
+// @Param user_id path string true "User ID"
+// @Param member body models.TeamMemberRequest true "Membership"
+// @Success 200 {object} models.TeamMembership
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 404 {object} utils.ErrorResponse "Team or user not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/teams/{id}/members/{user_id} [put]
+// @Security BearerAuth
+func (t *TeamController) SetTeamMember(c *gin.Context) {
+	team, teams, ok := findTeamByParam(c, "SetTeamMember")
+	if !ok {
+		return
+	}
+
+	var request models.TeamMemberRequest
+	if err := c.BindJSON(&request); err != nil {
+		utils.Logger.Errorf("SetTeamMember: Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return
+	}
+
+	target, ok := findTeamMemberTarget(c, "SetTeamMember")
+	if !ok {
+		return
+	}
+	user, ok := currentUser(c, "SetTeamMember")
+	if !ok {
+		return
+	}
+	if !authorizeTeamAdmin(c, "SetTeamMember", "teams:manage_members", user, teams, team.ID) {
+		return
+	}
+
+	// Team admins hand out only the roles every team on the path allows
+	assignable := assignableRoles(teams, team.ID)
+	var refused []string
+	for _, role := range request.Roles {
+		if !assignable[role] {
+			refused = append(refused, role)
+		}
+	}
+	if len(refused) > 0 {
+		utils.Logger.Errorf("SetTeamMember: Roles not assignable in team %s: %v", team.Name, refused)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{
+			"roles": "not assignable in this team: " + strings.Join(refused, ", "),
+		}))
+		return
+	}
+
+	// Joining the team grants its roles and those of its ancestors, and a new
+	// admin can add members in turn. When these go beyond what team admins
+	// may assign, only holders of teams:manage_members can do either.
+	var current *models.TeamMembership
+	for i := range target.Teams {
+		if target.Teams[i].TeamID == team.ID {
+			current = &target.Teams[i]
+		}
+	}
+	if current == nil || (request.Admin && !current.Admin) {
+		if unassignable := unassignableTeamRoles(teams, team.ID); len(unassignable) > 0 {
+			allowed, ok := holdsPermission(c, "SetTeamMember", "teams:manage_members", user)
+			if !ok {
+				return
+			}
+			if !allowed {
+				utils.Logger.Warnf("SetTeamMember: User %s cannot hand out the roles of team %s: %v", user.Email, team.Name, unassignable)
+				c.JSON(http.StatusForbidden, utils.CreateErrorResponse("Team roles not assignable by team admins", map[string]string{
+					"roles": "team grants roles not assignable in it: " + strings.Join(unassignable, ", "),
+				}))
+				return
+			}
+		}
+	}
+
+	membership := models.TeamMembership{TeamID: team.ID, Roles: request.Roles, Admin: request.Admin}
+	if membership.Roles == nil {
+		membership.Roles = []string{}
+	}
+
+	// Replace the existing membership, or add one
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	result, err := collection.UpdateOne(context.TODO(),
+		bson.M{"_id": target.ID, "teams.team_id": team.ID},
+		bson.M{"$set": bson.M{"teams.$": membership}},
+	)
+	if err == nil && result.MatchedCount == 0 {
+		_, err = collection.UpdateOne(context.TODO(),
+			bson.M{"_id": target.ID, "teams.team_id": bson.M{"$ne": team.ID}},
+			bson.M{"$push": bson.M{"teams": membership}},
+		)
+	}
+	if err != nil {
+		utils.Logger.Errorf("SetTeamMember: Error updating user: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error updating team member", nil))
+		return
+	}
+
+	authz.InvalidateUsers(context.TODO(), target.ID)
+
+	utils.Logger.Infof("%s set membership of %s in team %s", user.Email, target.Email, team.Name)
+	c.JSON(http.StatusOK, membership)
+}
+
+// RemoveTeamMember godoc
+// @Summary Remove a team member
+// @Description Remove a user from a team. Allowed for admins of the team or its ancestors and for users with teams:manage_members.
+// @Tags team
+// @Produce json
+// @Param id path string true "Team ID"
+// @Param user_id path string true "User ID"
+// @Success 200 {object} map[string]string "message": "Member removed successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 404 {object} utils.ErrorResponse "Team or member not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal server error"
+// @Router /api/v1/teams/{id}/members/{user_id} [delete]
+// @Security BearerAuth
+func (t *TeamController) RemoveTeamMember(c *gin.Context) {
+	team, teams, ok := findTeamByParam(c, "RemoveTeamMember")
+	if !ok {
+		return
+	}
+	target, ok := findTeamMemberTarget(c, "RemoveTeamMember")
+	if !ok {
+		return
+	}
+	user, ok := currentUser(c, "RemoveTeamMember")
+	if !ok {
+		return
+	}
+	if !authorizeTeamAdmin(c, "RemoveTeamMember", "teams:manage_members", user, teams, team.ID) {
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	result, err := collection.UpdateOne(context.TODO(),
+		bson.M{"_id": target.ID, "teams.team_id": team.ID},
+		bson.M{"$pull": bson.M{"teams": bson.M{"team_id": team.ID}}},
+	)
+	if err != nil {
+		utils.Logger.Errorf("RemoveTeamMember: Error updating user: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error removing team member", nil))
+		return
+	}
+	if result.MatchedCount == 0 {
+		utils.Logger.Errorf("RemoveTeamMember: User %s is not a member of team %s", target.Email, team.Name)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Member not found", nil))
+		return
+	}
+
+	authz.InvalidateUsers(context.TODO(), target.ID)
+
+	utils.Logger.Infof("%s removed %s from team %s", user.Email, target.Email, team.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// bindTeam parses a team request for the request's organization. It also
+// returns the organization's teams, with the team being updated (self)
+// excluded from the name check. It writes the error response and returns
+// false on failure.
+func bindTeam(c *gin.Context, handler string, self primitive.ObjectID) (models.Team, map[primitive.ObjectID]models.Team, bool) {
+	var request models.TeamRequest
+	if err := c.BindJSON(&request); err != nil {
+		utils.Logger.Errorf("%s: Invalid request: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return models.Team{}, nil, false
+	}
+
+	// Validate the team request
+	if err := utils.ValidateStruct(request); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("%s: Validation error: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return models.Team{}, nil, false
+	}
+
+	team := models.Team{
+		OrgID:           tenant.ID(c),
+		Name:            request.Name,
+		Roles:           request.Roles,
+		AssignableRoles: request.AssignableRoles,
+	}
+	if team.Roles == nil {
+		team.Roles = []string{}
+	}
+	if team.AssignableRoles == nil {
+		team.AssignableRoles = []string{}
+	}
+	if request.ParentID != "" {
+		parentID, err := primitive.ObjectIDFromHex(request.ParentID)
+		if err != nil {
+			utils.Logger.Errorf("%s: Invalid parent team ID: %v", handler, err)
+			c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"parent_id": "invalid"}))
+			return team, nil, false
+		}
+		team.ParentID = parentID
+	}
+
+	teams, err := authz.LoadTeams(context.TODO(), team.OrgID)
+	if err != nil {
+		utils.Logger.Errorf("%s: Error fetching teams: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching teams", nil))
+		return team, nil, false
+	}
+	for id, other := range teams {
+		if id != self && other.Name == team.Name {
+			utils.Logger.Errorf("%s: Team already exists with name: %s", handler, team.Name)
+			c.JSON(http.StatusConflict, utils.CreateErrorResponse("Team already exists", nil))
+			return team, nil, false
+		}
+	}
+	return team, teams, true
+}
+
+// validateTeam checks the team's parent, roles and assignable roles. It
+// writes the error response and returns false when they are invalid.
+func validateTeam(c *gin.Context, handler string, team models.Team, teams map[primitive.ObjectID]models.Team) bool {
+	validationErrors := make(map[string]string)
+
+	if !team.ParentID.IsZero() {
+		if _, exists := teams[team.ParentID]; !exists {
+			validationErrors["parent_id"] = "unknown team"
+		} else {
+			// The new parent must not be the team itself or one of its
+			// descendants
+			for _, ancestor := range authz.TeamPath(teams, team.ParentID) {
+				if ancestor.ID == team.ID {
+					validationErrors["parent_id"] = "team nesting cycle"
+					break
+				}
+			}
+		}
+	}
+
+	roles, err := authz.LoadRoles(context.TODO(), team.OrgID)
+	if err != nil {
+		utils.Logger.Errorf("%s: Error fetching roles: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching roles", nil))
+		return false
+	}
+	roles = authz.OwnRoles(roles, team.OrgID)
+	for field, names := range map[string][]string{"roles": team.Roles, "assignable_roles": team.AssignableRoles} {
+		var missing []string
+		for _, name := range names {
+			if _, exists := roles[name]; !exists {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			validationErrors[field] = "unknown roles: " + strings.Join(missing, ", ")
+		}
+	}
+
+	if _, exists := validationErrors["parent_id"]; !exists && !team.ParentID.IsZero() {
+		parentAssignable := assignableRoles(teams, team.ParentID)
+		var refused []string
+		for _, name := range team.AssignableRoles {
+			if !parentAssignable[name] {
+				refused = append(refused, name)
+			}
+		}
+		if len(refused) > 0 {
+			validationErrors["assignable_roles"] = "not assignable by the parent team: " + strings.Join(refused, ", ")
+		}
+	}
+
+	if len(validationErrors) > 0 {
+		utils.Logger.Errorf("%s: Validation error: %v", handler, validationErrors)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return false
+	}
+	return true
+}
+
+// assignableRoles returns the roles assignable by the team and every one of
+// its ancestors.
+func assignableRoles(teams map[primitive.ObjectID]models.Team, id primitive.ObjectID) map[string]bool {
+	var assignable map[string]bool
+	for _, team := range authz.TeamPath(teams, id) {
+		allowed := make(map[string]bool, len(team.AssignableRoles))
+		for _, role := range team.AssignableRoles {
+			if assignable == nil || assignable[role] {
+				allowed[role] = true
+			}
+		}
+		assignable = allowed
+	}
+	return assignable
+}
+
+// authorizeTeamAdmin allows admins of the team or one of its ancestors and
+// users holding permission. It writes a 403 response and returns false
+// otherwise.
+func authorizeTeamAdmin(c *gin.Context, handler, permission string, user models.User, teams map[primitive.ObjectID]models.Team, id primitive.ObjectID) bool {
+	if authz.IsTeamAdmin(user, teams, id) {
+		return true
+	}
+
+	allowed, ok := holdsPermission(c, handler, permission, user)
+	if !ok {
+		return false
+	}
+	if !allowed {
+		utils.Logger.Warnf("%s: User %s is not an admin of team %s", handler, user.Email, id.Hex())
+		c.JSON(http.StatusForbidden, utils.CreateErrorResponse("Forbidden", nil))
+		return false
+	}
+	return true
+}
+
+// unassignableTeamRoles lists the roles granted to every member of the
+// team, by the team or its ancestors, that are not assignable in the team.
+func unassignableTeamRoles(teams map[primitive.ObjectID]models.Team, id primitive.ObjectID) []string {
+	assignable := assignableRoles(teams, id)
+	seen := make(map[string]bool)
+	var unassignable []string
+	for _, team := range authz.TeamPath(teams, id) {
+		for _, role := range team.Roles {
+			if !assignable[role] && !seen[role] {
+				seen[role] = true
+				unassignable = append(unassignable, role)
+			}
+		}
+	}
+	return unassignable
+}
+
+// findTeamMemberTarget loads the user named by the user_id route parameter
+// within the request's organization.
+func findTeamMemberTarget(c *gin.Context, handler string) (models.User, bool) {
+	objectId, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		utils.Logger.Errorf("%s: Invalid user ID: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid user ID", nil))
+		return models.User{}, false
+	}
+	return findUserByID(c, handler, objectId)
+}
+
+// findTeamByParam loads the team named by the id route parameter within the
+// request's organization, together with all of the organization's teams. It
+// writes the error response and returns false on failure.
+func findTeamByParam(c *gin.Context, handler string) (models.Team, map[primitive.ObjectID]models.Team, bool) {
+	objectId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.Logger.Errorf("%s: Invalid team ID: %v", handler, err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid team ID", nil))
+		return models.Team{}, nil, false
+	}
+
+	teams, err := authz.LoadTeams(context.TODO(), tenant.ID(c))
+	if err != nil {
+		utils.Logger.Errorf("%s: Error fetching teams: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching teams", nil))
+		return models.Team{}, nil, false
+	}
+
+	team, exists := teams[objectId]
+	if !exists {
+		utils.Logger.Errorf("%s: Team not found with ID: %s", handler, objectId.Hex())
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Team not found", nil))
+		return team, nil, false
+	}
+	return team, teams, true
+}
@@ -2,19 +2,38 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"unified-go-backend/authz"
 	"unified-go-backend/config"
 	"unified-go-backend/database"
 	"unified-go-backend/models"
+	"unified-go-backend/pagination"
+	"unified-go-backend/tenant"
+	"unified-go-backend/userexport"
+	"unified-go-backend/userquery"
 	"unified-go-backend/utils"
+	"unified-go-backend/worker"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// exportFlushInterval is how many users are exported between flushes of
+// the response.
+const exportFlushInterval = 500
+
+// SensitiveUserFieldsPermission shows the admin view of users in listings
+// instead of the list view.
+const SensitiveUserFieldsPermission = "users:read_sensitive"
+
 // UserController handles user-related operations.
 type UserController struct {
 	config *config.Config
@@ -32,7 +51,7 @@ func NewUserController(cfg *config.Config) *UserController {
 // @Description Get the authenticated user's profile
 // @Tags user
 // @Produce json
-// @Success 200 {object} models.User
+// @Success 200 {object} models.UserProfile
 // @Failure 401 {object} utils.ErrorResponse "Unauthorized"
 // @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
 // @Router /api/v1/user/profile [get]
@@ -55,16 +74,43 @@ func (u *UserController) Profile(c *gin.Context) {
 	}
 
 	utils.Logger.Infof("Fetched user profile for email: %s", email)
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, models.NewUserProfile(user))
+}
+
+// Permissions godoc
+// @Summary Get the caller's effective permissions
+// @Description List every permission granted to the authenticated user with the roles and access groups granting it, and whether a deny rule overrides it
+// @Tags user
+// @Produce json
+// @Success 200 {array} authz.EffectivePermission
+// @Failure 401 {object} utils.ErrorResponse "Unauthorized"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/user/permissions [get]
+// @Security BearerAuth
+func (u *UserController) Permissions(c *gin.Context) {
+	user, ok := currentUser(c, "Permissions")
+	if !ok {
+		return
+	}
+
+	grants, err := authz.ResolveUser(context.TODO(), user, tenant.ID(c))
+	if err != nil {
+		utils.Logger.Errorf("Permissions: Error resolving permissions for email: %s, error: %v", user.Email, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error resolving permissions", nil))
+		return
+	}
+
+	utils.Logger.Infof("Fetched effective permissions for email: %s", user.Email)
+	c.JSON(http.StatusOK, grants.Effective())
 }
 
 // UpdateProfile godoc
 // @Summary Update user profile
-// @Description Update the authenticated user's profile
+// @Description Update the authenticated user's username. Passwords are changed with PUT /api/v1/user/password, which checks the current one.
 // @Tags user
 // @Accept json
 // @Produce json
-// @Param user body models.User true "User profile data"
+// @Param user body models.UpdateUserRequest true "User profile data"
 // @Success 200 {object} map[string]string "message": "User profile updated successfully"
 // @Failure 400 {object} utils.ErrorResponse "Invalid request"
 // @Failure 500 {object} utils.ErrorResponse "Error updating user profile"
@@ -78,7 +124,7 @@ func (u *UserController) UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	var userUpdate models.User
+	var userUpdate models.UpdateUserRequest
 	if err := c.BindJSON(&userUpdate); err != nil {
 		utils.Logger.Errorf("UpdateProfile: Invalid request for email: %s, error: %v", email, err)
 		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
@@ -97,7 +143,6 @@ func (u *UserController) UpdateProfile(c *gin.Context) {
 	update := bson.M{
 		"$set": bson.M{
 			"username": userUpdate.Username,
-			"password": userUpdate.Password, // This assumes the password is already hashed
 		},
 	}
 
@@ -115,12 +160,27 @@ func (u *UserController) UpdateProfile(c *gin.Context) {
 
 // ListUsers godoc
 // @Summary List all users
-// @Description List all users with pagination
+// @Description List users by page number, or by cursor to page quickly through large listings, in which case the response is a utils.CursorResponse. Users can optionally be searched, filtered, sorted and restricted to some fields of their view, every other field being left out. Inside an organization the role and access group filters apply to the organization membership, whose roles and access groups are shown. Users are shown as models.UserAdminView to callers with users:read_sensitive, and as models.UserListItem, without the fields of the admin view, to the others.
 // @Tags user
 // @Produce json
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Number of items per page" default(10)
-// @Success 200 {object} utils.PaginatedResponse
+// @Param search query string false "Case-insensitive substring of the username or email"
+// @Param verified query bool false "Only verified or unverified users"
+// @Param role query string false "Only users holding this role"
+// @Param status query string false "Only active, suspended or banned users" Enums(active, suspended, banned)
+// @Param access_group query string false "Only members of this access group ID"
+// @Param created_from query string false "Created on or after, YYYY-MM-DD or RFC 3339"
+// @Param created_to query string false "Created on or before, YYYY-MM-DD or RFC 3339"
+// @Param last_login_from query string false "Last logged in on or after, YYYY-MM-DD or RFC 3339"
+// @Param last_login_to query string false "Last logged in on or before, YYYY-MM-DD or RFC 3339"
+// @Param deleted query bool false "List the deleted users, which can be restored, instead of the others"
+// @Param sort query string false "Comma-separated sort fields among username, email, verified, last_login and created, prefixed with - for descending"
+// @Param fields query string false "Comma-separated fields to return besides the id, among those of the view shown to the caller"
+// @Param cursor query string false "Page by cursor instead of page number: empty for the first page, then the next or prev cursor of a page"
+// @Param count query string false "With cursor, whether to count the users: exact, estimate or none" Enums(exact, estimate, none) default(none)
+// @Success 200 {object} utils.PaginatedResponse{data=[]models.UserAdminView}
+// @Failure 400 {object} utils.ErrorResponse "Validation error"
 // @Failure 401 {object} utils.ErrorResponse "Unauthorized"
 // @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
 // @Router /api/v1/users [get]
@@ -128,6 +188,19 @@ func (u *UserController) UpdateProfile(c *gin.Context) {
 func (u *UserController) ListUsers(c *gin.Context) {
 	collection := database.MongoClient.Database("mdmdb").Collection("users")
 
+	query, validationErrors := userquery.Parse(c.Request.URL.Query())
+	if validationErrors != nil {
+		utils.Logger.Errorf("ListUsers: Validation error: %v", validationErrors)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+	filter := query.Filter(tenant.Users(c), tenant.ID(c))
+
+	if pagination.Requested(c.Request.URL.Query()) {
+		listUsersByCursor(c, collection, query, filter)
+		return
+	}
+
 	// Get pagination parameters from query
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
@@ -145,9 +218,13 @@ func (u *UserController) ListUsers(c *gin.Context) {
 	findOptions := options.Find()
 	findOptions.SetSkip(int64(skip))
 	findOptions.SetLimit(int64(limit))
+	findOptions.SetSort(query.SortDocument())
+	if projection := query.Projection(tenant.ID(c)); projection != nil {
+		findOptions.SetProjection(projection)
+	}
 
 	var users []models.User
-	cursor, err := collection.Find(context.TODO(), bson.M{}, findOptions)
+	cursor, err := collection.Find(context.TODO(), filter, findOptions)
 	if err != nil {
 		utils.Logger.Errorf("ListUsers: Error fetching users: %v", err)
 		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching users", nil))
@@ -172,28 +249,380 @@ func (u *UserController) ListUsers(c *gin.Context) {
 	}
 
 	// Get total count of users
-	totalCount, err := collection.CountDocuments(context.TODO(), bson.M{})
+	totalCount, err := collection.CountDocuments(context.TODO(), filter)
 	if err != nil {
 		utils.Logger.Errorf("ListUsers: Error counting users: %v", err)
 		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error counting users", nil))
 		return
 	}
 
+	views, ok := userViews(c, "ListUsers", users, tenant.ID(c), query.Names)
+	if !ok {
+		return
+	}
+
 	utils.Logger.Infof("Fetched %d users", len(users))
-	c.JSON(http.StatusOK, utils.CreatePaginatedResponse(users, page, limit, int(totalCount)))
+	c.JSON(http.StatusOK, utils.CreatePaginatedResponse(views, page, limit, int(totalCount)))
+}
+
+// listUsersByCursor writes the page of users matching filter reached by
+// the request's cursor.
+func listUsersByCursor(c *gin.Context, collection *mongo.Collection, query userquery.Query, filter bson.M) {
+	if _, exists := c.GetQuery("page"); exists {
+		utils.Logger.Errorf("ListUsers: Both page and cursor given")
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"page": "cannot be combined with cursor"}))
+		return
+	}
+	request, validationErrors := pagination.Parse(c.Request.URL.Query())
+	if validationErrors != nil {
+		utils.Logger.Errorf("ListUsers: Validation error: %v", validationErrors)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	page, err := pagination.Find[models.User](context.TODO(), collection, filter, query.SortDocument(), query.Projection(tenant.ID(c)), request)
+	if err == pagination.ErrInvalidCursor {
+		utils.Logger.Errorf("ListUsers: Invalid cursor: %s", request.Cursor)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"cursor": "is not a cursor returned by this listing"}))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("ListUsers: Error fetching users: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching users", nil))
+		return
+	}
+
+	views, ok := userViews(c, "ListUsers", page.Items, tenant.ID(c), query.Names)
+	if !ok {
+		return
+	}
+
+	utils.Logger.Infof("Fetched %d users", len(page.Items))
+	c.JSON(http.StatusOK, utils.CreateCursorResponse(views, request.Limit, page.Next, page.Prev, page.TotalCount, page.Estimated))
+}
+
+// ExportUsers godoc
+// @Summary Export users
+// @Description Stream the users as a CSV, NDJSON or XLSX file. Users are searched, filtered and sorted like in the listing. Columns are chosen among id, username, email, verified, verified_at, status, status_reason, roles, access_groups, created, last_login and deleted_at; password hashes are never exported. Inside an organization roles and access groups are those of the organization membership. In CSV and XLSX files lists are separated by semicolons.
+// @Tags user
+// @Produce text/csv,application/x-ndjson,application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param format query string false "File format" Enums(csv, ndjson, xlsx) default(csv)
+// @Param columns query string false "Comma-separated columns, by default id, username, email, verified, status, roles, access_groups, created and last_login"
+// @Param search query string false "Case-insensitive substring of the username or email"
+// @Param verified query bool false "Only verified or unverified users"
+// @Param role query string false "Only users holding this role"
+// @Param status query string false "Only active, suspended or banned users" Enums(active, suspended, banned)
+// @Param access_group query string false "Only members of this access group ID"
+// @Param created_from query string false "Created on or after, YYYY-MM-DD or RFC 3339"
+// @Param created_to query string false "Created on or before, YYYY-MM-DD or RFC 3339"
+// @Param last_login_from query string false "Last logged in on or after, YYYY-MM-DD or RFC 3339"
+// @Param last_login_to query string false "Last logged in on or before, YYYY-MM-DD or RFC 3339"
+// @Param deleted query bool false "Export the deleted users instead of the others"
+// @Param sort query string false "Comma-separated sort fields among username, email, verified, last_login and created, prefixed with - for descending"
+// @Success 200 {file} file "Users"
+// @Failure 400 {object} utils.ErrorResponse "Validation error"
+// @Failure 401 {object} utils.ErrorResponse "Unauthorized"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users/export [get]
+// @Security BearerAuth
+func (u *UserController) ExportUsers(c *gin.Context) {
+	query, validationErrors := userquery.Parse(c.Request.URL.Query())
+	if validationErrors == nil {
+		validationErrors = make(map[string]string)
+	}
+	if len(query.Fields) > 0 {
+		validationErrors["fields"] = "not supported, use columns"
+	}
+	format := c.DefaultQuery("format", userexport.FormatCSV)
+	if userexport.ContentType(format) == "" {
+		validationErrors["format"] = "must be csv, ndjson or xlsx"
+	}
+	names := userexport.DefaultColumns
+	if value := c.Query("columns"); value != "" {
+		names = splitNames(value)
+	}
+	columns, err := userexport.Columns(names)
+	if err != nil {
+		validationErrors["columns"] = "must be a list of columns among " + strings.Join(userexport.ColumnNames(), ", ")
+	}
+	if len(validationErrors) > 0 {
+		utils.Logger.Errorf("ExportUsers: Validation error: %v", validationErrors)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	filter := query.Filter(tenant.Users(c), tenant.ID(c))
+	findOptions := options.Find().SetSort(query.SortDocument()).SetProjection(userexport.Projection(columns))
+	cursor, err := collection.Find(c.Request.Context(), filter, findOptions)
+	if err != nil {
+		utils.Logger.Errorf("ExportUsers: Error fetching users: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching users", nil))
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	// Once the file has started errors can only cut it short
+	filename := "users-" + time.Now().UTC().Format("20060102T150405Z") + "." + format
+	c.Header("Content-Type", userexport.ContentType(format))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+	writer, err := userexport.NewWriter(c.Writer, format, columns, tenant.ID(c))
+	if err != nil {
+		utils.Logger.Errorf("ExportUsers: Error starting export: %v", err)
+		return
+	}
+
+	exported := 0
+	for cursor.Next(c.Request.Context()) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			utils.Logger.Errorf("ExportUsers: Error decoding user: %v", err)
+			return
+		}
+		if err := writer.Write(user); err != nil {
+			utils.Logger.Errorf("ExportUsers: Error writing user, export cut short after %d users: %v", exported, err)
+			return
+		}
+		exported++
+		if exported%exportFlushInterval == 0 {
+			c.Writer.Flush()
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		utils.Logger.Errorf("ExportUsers: Cursor error, export cut short after %d users: %v", exported, err)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		utils.Logger.Errorf("ExportUsers: Error finishing export: %v", err)
+		return
+	}
+
+	utils.Logger.Infof("Exported %d users as %s", exported, format)
+}
+
+// CreateUser godoc
+// @Summary Create a user
+// @Description Create a user with the given roles and access groups, by name. Inside an organization they are those of the user's membership of it, otherwise the global ones, defaulting to the user role and the user_group access group. With a temporary password the user must change it on first login; without one the user is emailed an invitation to set a password. Users not created verified verify their email address like self-registered ones. The roles and access groups may only grant permissions the caller holds.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param request body models.CreateUserRequest true "User"
+// @Success 201 {object} models.CreateUserResponse
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 409 {object} utils.ErrorResponse "User already exists"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users [post]
+// @Security BearerAuth
+func (u *UserController) CreateUser(c *gin.Context) {
+	var request models.CreateUserRequest
+	if err := c.BindJSON(&request); err != nil {
+		utils.Logger.Errorf("CreateUser: Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return
+	}
+
+	// Validate the user request
+	if err := utils.ValidateStruct(request); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("CreateUser: Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	// Global users get the defaults of self-registered ones
+	org := tenant.ID(c)
+	groupNames := request.AccessGroups
+	membership := models.OrgMembership{OrgID: org, Roles: request.Roles, AccessGroups: []primitive.ObjectID{}}
+	if org.IsZero() && len(membership.Roles) == 0 {
+		membership.Roles = []string{"user"}
+	}
+	if org.IsZero() && len(groupNames) == 0 {
+		groupNames = []string{"user_group"}
+	}
+	if membership.Roles == nil {
+		membership.Roles = []string{}
+	}
+	validationErrors, err := validateMembership(&membership, groupNames)
+	if err != nil {
+		utils.Logger.Errorf("CreateUser: Error checking roles and access groups: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error checking roles and access groups", nil))
+		return
+	}
+	if validationErrors != nil {
+		utils.Logger.Errorf("CreateUser: Validation error: %v", validationErrors)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	user := models.User{
+		ID:           primitive.NewObjectID(),
+		Email:        request.Email,
+		Username:     request.Username,
+		Verified:     request.Verified,
+		Roles:        []string{},
+		AccessGroups: []primitive.ObjectID{},
+	}
+	if request.Verified {
+		user.VerifiedAt = time.Now()
+	}
+	if org.IsZero() {
+		user.Roles, user.AccessGroups = membership.Roles, membership.AccessGroups
+	} else {
+		user.Orgs = []models.OrgMembership{membership}
+	}
+	if request.TemporaryPassword != "" {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.TemporaryPassword), bcrypt.DefaultCost)
+		if err != nil {
+			utils.Logger.Errorf("CreateUser: Error hashing password: %v", err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error hashing password", nil))
+			return
+		}
+		user.Password = string(hashedPassword)
+		user.PasswordChangeRequired = true
+	}
+
+	subject, ok := currentUser(c, "CreateUser")
+	if !ok {
+		return
+	}
+	if !authorizeResource(c, "CreateUser", "users:create", subject, user) {
+		return
+	}
+	roles, err := authz.LoadRoles(context.TODO(), org)
+	if err != nil {
+		utils.Logger.Errorf("CreateUser: Error fetching roles: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching roles", nil))
+		return
+	}
+	roles = authz.OwnRoles(roles, org)
+	groups, err := authz.LoadAccessGroups(context.TODO(), membership.AccessGroups, org)
+	if err != nil {
+		utils.Logger.Errorf("CreateUser: Error fetching access groups: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching access groups", nil))
+		return
+	}
+	if !grantable(c, "CreateUser", subject, map[string]authz.PermissionSet{
+		"roles":         authz.RolePermissions(roles, membership.Roles),
+		"access_groups": authz.GroupPermissions(roles, groups),
+	}) {
+		return
+	}
+
+	// Check for duplicate user, deleted ones included so they can be restored
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	count, err := collection.CountDocuments(context.TODO(), bson.M{"email": request.Email})
+	if err != nil {
+		utils.Logger.Errorf("CreateUser: Error checking for duplicate user: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error checking for duplicate user", nil))
+		return
+	}
+	if count > 0 {
+		utils.Logger.Errorf("CreateUser: User already exists with email: %s", request.Email)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("User already exists", nil))
+		return
+	}
+
+	if _, err := collection.InsertOne(context.TODO(), user); err != nil {
+		utils.Logger.Errorf("CreateUser: Error creating user: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error creating user", nil))
+		return
+	}
+
+	invited := request.TemporaryPassword == ""
+	if invited {
+		if err := inviteUser(context.TODO(), user, u.config.InvitationTTL); err != nil {
+			utils.Logger.Errorf("CreateUser: Error inviting %s: %v", user.Email, err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error sending invitation", nil))
+			return
+		}
+	} else if !user.Verified {
+		if err := queueVerification(context.TODO(), user.Email); err != nil {
+			utils.Logger.Errorf("CreateUser: Error queuing verification of %s: %v", user.Email, err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error adding email to verification queue", nil))
+			return
+		}
+	}
+
+	utils.Logger.Infof("User %s created by %s", user.Email, subject.Email)
+	c.JSON(http.StatusCreated, models.CreateUserResponse{ID: user.ID.Hex(), Invited: invited})
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Change the authenticated user's password. Users created with a temporary password can use nothing else until they have changed it.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param request body models.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} map[string]string "message": "Password changed successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 401 {object} utils.ErrorResponse "Invalid password"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/user/password [put]
+// @Security BearerAuth
+func (u *UserController) ChangePassword(c *gin.Context) {
+	var request models.ChangePasswordRequest
+	if err := c.BindJSON(&request); err != nil {
+		utils.Logger.Errorf("ChangePassword: Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return
+	}
+
+	// Validate the password request
+	if err := utils.ValidateStruct(request); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("ChangePassword: Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	user, ok := currentUser(c, "ChangePassword")
+	if !ok {
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.CurrentPassword)); err != nil {
+		utils.Logger.Errorf("ChangePassword: Invalid password for %s", user.Email)
+		c.JSON(http.StatusUnauthorized, utils.CreateErrorResponse("Invalid password", nil))
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		utils.Logger.Errorf("ChangePassword: Error hashing password: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error hashing password", nil))
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	update := bson.M{
+		"$set":   bson.M{"password": string(hashedPassword)},
+		"$unset": bson.M{"password_change_required": ""},
+	}
+	if _, err := collection.UpdateOne(context.TODO(), bson.M{"_id": user.ID}, update); err != nil {
+		utils.Logger.Errorf("ChangePassword: Error updating user %s: %v", user.Email, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error changing password", nil))
+		return
+	}
+
+	utils.Logger.Infof("Password changed for %s", user.Email)
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
 }
 
 // UpdateUser godoc
 // @Summary Update a user
-// @Description Update a user's details
+// @Description Update a user's username. Passwords are only changed by their users.
 // @Tags user
 // @Accept json
 // @Produce json
 // @Param id path string true "User ID"
-// @Param user body models.User true "User details to update"
+// @Param user body models.UpdateUserRequest true "User details to update"
 // @Success 200 {object} map[string]string "message": "User updated successfully"
 // @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
 // @Failure 404 {object} utils.ErrorResponse "User not found"
+// @Failure 409 {object} utils.ErrorResponse "User belongs to other organizations"
 // @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
 // @Router /api/v1/user/{id} [put]
 // @Security BearerAuth
@@ -206,7 +635,7 @@ func (u *UserController) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	var userUpdate models.User
+	var userUpdate models.UpdateUserRequest
 	if err := c.BindJSON(&userUpdate); err != nil {
 		utils.Logger.Errorf("UpdateUser: Invalid request: %v", err)
 		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
@@ -222,10 +651,21 @@ func (u *UserController) UpdateUser(c *gin.Context) {
 	}
 
 	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	target, ok := findUserByID(c, "UpdateUser", objectId)
+	if !ok || !ownedByTenant(c, "UpdateUser", target) {
+		return
+	}
+	subject, ok := currentUser(c, "UpdateUser")
+	if !ok {
+		return
+	}
+	if !authorizeResource(c, "UpdateUser", "users:update", subject, target) {
+		return
+	}
+
 	update := bson.M{
 		"$set": bson.M{
 			"username": userUpdate.Username,
-			"password": userUpdate.Password, // This assumes the password is already hashed
 		},
 	}
 
@@ -248,13 +688,15 @@ func (u *UserController) UpdateUser(c *gin.Context) {
 
 // DeleteUser godoc
 // @Summary Delete a user
-// @Description Delete a user by ID
+// @Description Delete a user by ID. The user can no longer log in and is hidden from listings, but can be restored until purged after the retention period.
 // @Tags user
 // @Produce json
 // @Param id path string true "User ID"
 // @Success 200 {object} map[string]string "message": "User deleted successfully"
 // @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
 // @Failure 404 {object} utils.ErrorResponse "User not found"
+// @Failure 409 {object} utils.ErrorResponse "User belongs to other organizations"
 // @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
 // @Router /api/v1/user/{id} [delete]
 // @Security BearerAuth
@@ -267,20 +709,361 @@ func (u *UserController) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	target, ok := findUserByID(c, "DeleteUser", objectId)
+	if !ok || !ownedByTenant(c, "DeleteUser", target) {
+		return
+	}
+	subject, ok := currentUser(c, "DeleteUser")
+	if !ok {
+		return
+	}
+	if !authorizeResource(c, "DeleteUser", "users:delete", subject, target) {
+		return
+	}
+
 	collection := database.MongoClient.Database("mdmdb").Collection("users")
-	filter := bson.M{"_id": objectId}
-	result, err := collection.DeleteOne(context.TODO(), filter)
+	filter := userquery.Live(bson.M{"_id": objectId})
+	update := bson.M{"$set": bson.M{"deleted_at": time.Now(), "deleted_by": subject.Email}}
+	result, err := collection.UpdateOne(context.TODO(), filter, update)
 	if err != nil {
 		utils.Logger.Errorf("DeleteUser: Error deleting user: %v", err)
 		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error deleting user", nil))
 		return
 	}
-	if result.DeletedCount == 0 {
+	if result.MatchedCount == 0 {
 		utils.Logger.Errorf("DeleteUser: User not found with ID: %s", id)
 		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("User not found", nil))
 		return
 	}
 
+	authz.InvalidateUsers(context.TODO(), objectId)
+
 	utils.Logger.Infof("User deleted successfully: %s", id)
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
+
+// RestoreUser godoc
+// @Summary Restore a deleted user
+// @Description Restore a deleted user that has not been purged yet
+// @Tags user
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]string "message": "User restored successfully"
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 404 {object} utils.ErrorResponse "Deleted user not found"
+// @Failure 409 {object} utils.ErrorResponse "User belongs to other organizations"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/user/{id}/restore [post]
+// @Security BearerAuth
+func (u *UserController) RestoreUser(c *gin.Context) {
+	id := c.Param("id")
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		utils.Logger.Errorf("RestoreUser: Invalid user ID: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid user ID", nil))
+		return
+	}
+
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	deleted := bson.M{"_id": objectId, "deleted_at": bson.M{"$exists": true}, "erased_at": bson.M{"$exists": false}}
+	var target models.User
+	err = collection.FindOne(context.TODO(), tenant.With(tenant.Users(c), deleted)).Decode(&target)
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("RestoreUser: Deleted user not found with ID: %s", id)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Deleted user not found", nil))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("RestoreUser: Error fetching user: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching user", nil))
+		return
+	}
+	if !ownedByTenant(c, "RestoreUser", target) {
+		return
+	}
+	subject, ok := currentUser(c, "RestoreUser")
+	if !ok {
+		return
+	}
+	if !authorizeResource(c, "RestoreUser", "users:restore", subject, target) {
+		return
+	}
+
+	update := bson.M{"$unset": bson.M{"deleted_at": "", "deleted_by": ""}}
+	result, err := collection.UpdateOne(context.TODO(), deleted, update)
+	if err != nil {
+		utils.Logger.Errorf("RestoreUser: Error restoring user: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error restoring user", nil))
+		return
+	}
+	if result.MatchedCount == 0 {
+		utils.Logger.Errorf("RestoreUser: Deleted user not found with ID: %s", id)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Deleted user not found", nil))
+		return
+	}
+
+	utils.Logger.Infof("User restored successfully: %s (deleted by %s)", target.Email, target.DeletedBy)
+	c.JSON(http.StatusOK, gin.H{"message": "User restored successfully"})
+}
+
+// SuspendUser godoc
+// @Summary Suspend or ban a user
+// @Description Block a user's account with a reason. A suspension may be limited by a duration and is lifted automatically when it expires; a ban lasts until lifted. Existing tokens stop working immediately.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body models.SuspendUserRequest true "Suspension"
+// @Success 200 {object} models.UserStatus
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 404 {object} utils.ErrorResponse "User not found"
+// @Failure 409 {object} utils.ErrorResponse "Cannot suspend yourself"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/user/{id}/suspend [post]
+// @Security BearerAuth
+func (u *UserController) SuspendUser(c *gin.Context) {
+	objectId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.Logger.Errorf("SuspendUser: Invalid user ID: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid user ID", nil))
+		return
+	}
+
+	var request models.SuspendUserRequest
+	if err := c.BindJSON(&request); err != nil {
+		utils.Logger.Errorf("SuspendUser: Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid request", nil))
+		return
+	}
+
+	// Validate the suspension request
+	if err := utils.ValidateStruct(request); err != nil {
+		validationErrors := utils.FormatValidationError(err)
+		utils.Logger.Errorf("SuspendUser: Validation error: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	now := time.Now()
+	status := models.UserStatus{State: request.State, Reason: request.Reason, Since: now}
+	if request.Duration != "" {
+		duration, err := time.ParseDuration(request.Duration)
+		if err != nil || duration <= 0 || request.State != models.UserSuspended {
+			utils.Logger.Errorf("SuspendUser: Invalid duration: %s", request.Duration)
+			c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{
+				"duration": "must be a positive duration, and bans cannot have one",
+			}))
+			return
+		}
+		status.ExpiresAt = now.Add(duration)
+	}
+
+	target, ok := findUserByID(c, "SuspendUser", objectId)
+	if !ok || !ownedByTenant(c, "SuspendUser", target) {
+		return
+	}
+	subject, ok := currentUser(c, "SuspendUser")
+	if !ok {
+		return
+	}
+	if subject.ID == target.ID {
+		utils.Logger.Errorf("SuspendUser: User %s tried to suspend themselves", subject.Email)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("Cannot suspend yourself", nil))
+		return
+	}
+	if !authorizeResource(c, "SuspendUser", "users:suspend", subject, target) {
+		return
+	}
+	status.By = subject.Email
+
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	result, err := collection.UpdateOne(context.TODO(), userquery.Live(bson.M{"_id": objectId}), bson.M{"$set": bson.M{"status": status}})
+	if err != nil {
+		utils.Logger.Errorf("SuspendUser: Error updating user: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error suspending user", nil))
+		return
+	}
+	if result.MatchedCount == 0 {
+		utils.Logger.Errorf("SuspendUser: User not found with ID: %s", objectId.Hex())
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("User not found", nil))
+		return
+	}
+
+	utils.Logger.Infof("User %s %s by %s: %s", target.Email, status.State, subject.Email, status.Reason)
+	c.JSON(http.StatusOK, status)
+}
+
+// UnsuspendUser godoc
+// @Summary Lift a suspension or ban
+// @Description Make a suspended or banned user active again
+// @Tags user
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} models.UserStatus
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 403 {object} utils.ErrorResponse "Forbidden"
+// @Failure 404 {object} utils.ErrorResponse "User not found"
+// @Failure 409 {object} utils.ErrorResponse "User is not suspended"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/user/{id}/unsuspend [post]
+// @Security BearerAuth
+func (u *UserController) UnsuspendUser(c *gin.Context) {
+	objectId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.Logger.Errorf("UnsuspendUser: Invalid user ID: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid user ID", nil))
+		return
+	}
+
+	target, ok := findUserByID(c, "UnsuspendUser", objectId)
+	if !ok || !ownedByTenant(c, "UnsuspendUser", target) {
+		return
+	}
+	if target.Status.State != models.UserSuspended && target.Status.State != models.UserBanned {
+		utils.Logger.Errorf("UnsuspendUser: User %s is not suspended", target.Email)
+		c.JSON(http.StatusConflict, utils.CreateErrorResponse("User is not suspended", nil))
+		return
+	}
+	subject, ok := currentUser(c, "UnsuspendUser")
+	if !ok {
+		return
+	}
+	if !authorizeResource(c, "UnsuspendUser", "users:suspend", subject, target) {
+		return
+	}
+
+	status := models.UserStatus{State: models.UserActive, Reason: "Lifted", By: subject.Email, Since: time.Now()}
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	_, err = collection.UpdateOne(context.TODO(), bson.M{"_id": objectId}, bson.M{"$set": bson.M{"status": status}})
+	if err != nil {
+		utils.Logger.Errorf("UnsuspendUser: Error updating user: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error unsuspending user", nil))
+		return
+	}
+
+	utils.Logger.Infof("User %s unsuspended by %s", target.Email, subject.Email)
+	c.JSON(http.StatusOK, status)
+}
+
+// findUserByID loads a user visible in the request's organization by ID. It
+// writes the error response and returns false on failure.
+func findUserByID(c *gin.Context, handler string, objectId primitive.ObjectID) (models.User, bool) {
+	var user models.User
+	collection := database.MongoClient.Database("mdmdb").Collection("users")
+	err := collection.FindOne(context.TODO(), tenant.With(tenant.Users(c), userquery.Live(bson.M{"_id": objectId}))).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("%s: User not found with ID: %s", handler, objectId.Hex())
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("User not found", nil))
+		return user, false
+	}
+	if err != nil {
+		utils.Logger.Errorf("%s: Error fetching user: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching user", nil))
+		return user, false
+	}
+	return user, true
+}
+
+// ownedByTenant reports whether the request's organization may change the
+// user's account. Inside an organization, accounts shared with other
+// organizations are left alone. It writes a 409 response when not.
+func ownedByTenant(c *gin.Context, handler string, user models.User) bool {
+	if !tenant.Scoped(c) {
+		return true
+	}
+	for _, membership := range user.Orgs {
+		if membership.OrgID != tenant.ID(c) {
+			utils.Logger.Errorf("%s: User %s belongs to other organizations", handler, user.Email)
+			c.JSON(http.StatusConflict, utils.CreateErrorResponse("User belongs to other organizations", nil))
+			return false
+		}
+	}
+	return true
+}
+
+// userViews returns the views of users shown to the caller inside org, or
+// globally when org is zero: the admin view to callers allowed to see
+// sensitive fields, the list view to the others. Given field names, the
+// views keep only their id and those fields. It writes the error response
+// and returns false on failure.
+func userViews(c *gin.Context, handler string, users []models.User, org primitive.ObjectID, names []string) (interface{}, bool) {
+	subject, ok := currentUser(c, handler)
+	if !ok {
+		return nil, false
+	}
+	grants, err := authz.CachedGrants(context.TODO(), subject, org)
+	if err != nil {
+		utils.Logger.Errorf("%s: Error resolving permissions: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error resolving permissions", nil))
+		return nil, false
+	}
+	decision := grants.Authorize(authz.PolicyRequest{
+		Action:  SensitiveUserFieldsPermission,
+		Subject: subject,
+		IP:      c.ClientIP(),
+		Time:    time.Now(),
+	})
+
+	if decision.Allowed {
+		views := make([]models.UserAdminView, 0, len(users))
+		for _, user := range users {
+			views = append(views, models.NewUserAdminView(user, org))
+		}
+		return selectUserFields(c, handler, views, names)
+	}
+	views := make([]models.UserListItem, 0, len(users))
+	for _, user := range users {
+		views = append(views, models.NewUserListItem(user, org))
+	}
+	return selectUserFields(c, handler, views, names)
+}
+
+// selectUserFields returns the views keeping only their id and the named
+// fields, or unchanged without names. It writes the error response and
+// returns false on failure.
+func selectUserFields[T any](c *gin.Context, handler string, views []T, names []string) (interface{}, bool) {
+	if len(names) == 0 {
+		return views, true
+	}
+	selected, unknown, err := models.SelectFields(views, names)
+	if err != nil {
+		utils.Logger.Errorf("%s: Error selecting fields: %v", handler, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error selecting fields", nil))
+		return nil, false
+	}
+	if len(unknown) > 0 {
+		utils.Logger.Errorf("%s: Fields not shown to the caller: %v", handler, unknown)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{"fields": "not shown to you: " + strings.Join(unknown, ", ")}))
+		return nil, false
+	}
+	return selected, true
+}
+
+// invitationKey is the Redis key of an invitation token, holding the email
+// address of the invited user.
+func invitationKey(token string) string {
+	return "password_invitation:" + token
+}
+
+// inviteUser emails the user a token to set their password with, valid for
+// ttl.
+func inviteUser(ctx context.Context, user models.User, ttl time.Duration) error {
+	token := utils.GenerateToken()
+	if err := database.RedisClient.Set(ctx, invitationKey(token), user.Email, ttl).Err(); err != nil {
+		return err
+	}
+	body := fmt.Sprintf("An account was created for you as %s.\n\nSet your password before %s with this invitation token:\n\n%s",
+		user.Username, time.Now().Add(ttl).UTC().Format(time.RFC3339), token)
+	return worker.EnqueueNotification(ctx, user.Email, "You have been invited", body)
+}
+
+// queueVerification sends the user a code to verify their email address
+// with, as on registration.
+func queueVerification(ctx context.Context, email string) error {
+	if err := database.RedisClient.Set(ctx, email, utils.GenerateVerificationCode(), 10*time.Minute).Err(); err != nil {
+		return err
+	}
+	return database.RedisClient.LPush(ctx, "email_verification_queue", email).Err()
+}
@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unified-go-backend/authz"
+	"unified-go-backend/config"
+	"unified-go-backend/models"
+	"unified-go-backend/tenant"
+	"unified-go-backend/userimport"
+	"unified-go-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxImportSize bounds the size of an uploaded import file.
+const maxImportSize = 32 << 20
+
+// UserImportController handles bulk user imports.
+type UserImportController struct {
+	config *config.Config
+}
+
+// NewUserImportController creates a new UserImportController.
+func NewUserImportController(cfg *config.Config) *UserImportController {
+	return &UserImportController{
+		config: cfg,
+	}
+}
+
+// ImportUsers godoc
+// @Summary Import users in bulk
+// @Description Start importing the users of a CSV or NDJSON file sent as the request body, up to 32 MiB. CSV files have a header row naming their columns among email, username, password, roles and access_groups, roles and access groups being separated by semicolons; NDJSON files hold one JSON object per line with the same fields, roles and access groups being arrays. Every row is validated like a registration. Rows naming no roles or access groups get those of the parameters, or globally the defaults of self-registered users. Inside an organization roles and access groups are those of the users' membership. Rows may only grant roles and permissions the importer holds, and may not change the importer's own account. The import runs in the background; poll the returned job for its progress and per-row error report.
+// @Tags user
+// @Accept plain
+// @Produce json
+// @Param file body string true "CSV or NDJSON file"
+// @Param format query string false "File format, by default from the content type" Enums(csv, ndjson)
+// @Param dry_run query bool false "Validate every row without importing anything"
+// @Param upsert query bool false "Update the users that already exist instead of reporting them, leaving their passwords unchanged"
+// @Param verified query bool false "Mark the imported users as verified"
+// @Param roles query string false "Comma-separated roles of the rows naming none"
+// @Param access_groups query string false "Comma-separated access groups of the rows naming none"
+// @Success 202 {object} models.UserImportJob
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 413 {object} utils.ErrorResponse "File too large"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users/import [post]
+// @Security BearerAuth
+func (u *UserImportController) ImportUsers(c *gin.Context) {
+	options, validationErrors := parseImportOptions(c)
+	if validationErrors != nil {
+		utils.Logger.Errorf("ImportUsers: Validation error: %v", validationErrors)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", validationErrors))
+		return
+	}
+
+	subject, ok := currentUser(c, "ImportUsers")
+	if !ok {
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	rows, err := userimport.Read(body, options.Format)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.Logger.Errorf("ImportUsers: File too large")
+			c.JSON(http.StatusRequestEntityTooLarge, utils.CreateErrorResponse("File too large", nil))
+			return
+		}
+		utils.Logger.Errorf("ImportUsers: Invalid file: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid file", map[string]string{"file": err.Error()}))
+		return
+	}
+
+	// Rows may hand out only what the importer holds in the import's scope
+	grants, err := authz.CachedGrants(context.TODO(), subject, tenant.ID(c))
+	if err != nil {
+		utils.Logger.Errorf("ImportUsers: Error resolving grants of %s: %v", subject.Email, err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error starting import", nil))
+		return
+	}
+
+	job := models.UserImportJob{OrgID: tenant.ID(c), Options: options, CreatedBy: subject.Email}
+	caller := &userimport.Caller{ID: subject.ID, Grants: grants}
+	if err := userimport.Start(context.TODO(), &job, rows, caller); err != nil {
+		utils.Logger.Errorf("ImportUsers: Error starting import: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error starting import", nil))
+		return
+	}
+
+	utils.Logger.Infof("User import %s of %d rows started by %s", job.ID.Hex(), len(rows), subject.Email)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetUserImport godoc
+// @Summary Get a user import
+// @Description Get the progress of a bulk user import and, once completed, its per-row error report
+// @Tags user
+// @Produce json
+// @Param id path string true "Import job ID"
+// @Success 200 {object} models.UserImportJob
+// @Failure 400 {object} utils.ErrorResponse "Invalid request"
+// @Failure 404 {object} utils.ErrorResponse "Import not found"
+// @Failure 500 {object} utils.ErrorResponse "Internal Server Error"
+// @Router /api/v1/users/import/{id} [get]
+// @Security BearerAuth
+func (u *UserImportController) GetUserImport(c *gin.Context) {
+	objectId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.Logger.Errorf("GetUserImport: Invalid import ID: %v", err)
+		c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Invalid import ID", nil))
+		return
+	}
+
+	job, err := userimport.FindJob(context.TODO(), objectId, tenant.ID(c))
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("GetUserImport: Import not found with ID: %s", objectId.Hex())
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Import not found", nil))
+		return
+	}
+	if err != nil {
+		utils.Logger.Errorf("GetUserImport: Error fetching import: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching import", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// parseImportOptions reads the import options from the query parameters.
+// Invalid parameters are reported keyed by parameter name.
+func parseImportOptions(c *gin.Context) (models.UserImportOptions, map[string]string) {
+	options := models.UserImportOptions{Format: c.Query("format")}
+	validationErrors := make(map[string]string)
+
+	if options.Format == "" {
+		options.Format = userimport.FormatOf(c.ContentType())
+	}
+	if options.Format != userimport.FormatCSV && options.Format != userimport.FormatNDJSON {
+		validationErrors["format"] = "must be csv or ndjson, or given by the content type"
+	}
+
+	flags := map[string]*bool{"dry_run": &options.DryRun, "upsert": &options.Upsert, "verified": &options.Verified}
+	for name, flag := range flags {
+		if value := c.Query(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				validationErrors[name] = "must be true or false"
+			}
+			*flag = parsed
+		}
+	}
+
+	options.Roles = splitNames(c.Query("roles"))
+	options.AccessGroups = splitNames(c.Query("access_groups"))
+
+	if len(validationErrors) > 0 {
+		return options, validationErrors
+	}
+	return options, nil
+}
+
+func splitNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
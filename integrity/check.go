@@ -0,0 +1,189 @@
+package integrity
+
+import (
+	"context"
+	"sort"
+	"unified-go-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Orphan is a reference to a role, access group, team or organization that
+// does not exist, or that is not usable where it is referenced.
+type Orphan struct {
+	Collection string             `json:"collection"`
+	ID         primitive.ObjectID `json:"id"`
+	Field      string             `json:"field"`
+	Value      interface{}        `json:"value"`
+}
+
+// catalog holds what references may point at.
+type catalog struct {
+	orgs   map[primitive.ObjectID]bool
+	roles  map[primitive.ObjectID]map[string]bool
+	groups map[primitive.ObjectID]primitive.ObjectID
+	teams  map[primitive.ObjectID]models.Team
+}
+
+// role reports whether the role name is usable in org: global roles are
+// usable everywhere, organization roles only in their organization.
+func (c catalog) role(org primitive.ObjectID, name string) bool {
+	return c.roles[primitive.NilObjectID][name] || (!org.IsZero() && c.roles[org][name])
+}
+
+// group reports whether the access group exists and is owned by org.
+func (c catalog) group(org, id primitive.ObjectID) bool {
+	owner, exists := c.groups[id]
+	return exists && owner == org
+}
+
+// Check reports every orphaned reference to roles, access groups, teams and
+// organizations.
+func Check(ctx context.Context) ([]Orphan, error) {
+	db := mdmdb()
+	c, err := loadCatalog(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []Orphan
+	report := func(collection string, id primitive.ObjectID, field string, value interface{}) {
+		orphans = append(orphans, Orphan{Collection: collection, ID: id, Field: field, Value: value})
+	}
+	checkRoles := func(collection string, id, org primitive.ObjectID, field string, names []string) {
+		for _, name := range names {
+			if !c.role(org, name) {
+				report(collection, id, field, name)
+			}
+		}
+	}
+	checkOrg := func(collection string, id, org primitive.ObjectID) {
+		if !org.IsZero() && !c.orgs[org] {
+			report(collection, id, "org_id", org)
+		}
+	}
+
+	err = each(ctx, db.Collection("users"), func(user models.User) {
+		checkRoles("users", user.ID, primitive.NilObjectID, "roles", user.Roles)
+		for _, grant := range user.RoleGrants {
+			checkRoles("users", user.ID, primitive.NilObjectID, "role_grants.role", []string{grant.Role})
+		}
+		for _, id := range user.AccessGroups {
+			if !c.group(primitive.NilObjectID, id) {
+				report("users", user.ID, "access_groups", id)
+			}
+		}
+		for _, membership := range user.Orgs {
+			if !c.orgs[membership.OrgID] {
+				report("users", user.ID, "orgs.org_id", membership.OrgID)
+				continue
+			}
+			checkRoles("users", user.ID, membership.OrgID, "orgs.roles", membership.Roles)
+			for _, id := range membership.AccessGroups {
+				if !c.group(membership.OrgID, id) {
+					report("users", user.ID, "orgs.access_groups", id)
+				}
+			}
+		}
+		for _, membership := range user.Teams {
+			team, exists := c.teams[membership.TeamID]
+			if !exists {
+				report("users", user.ID, "teams.team_id", membership.TeamID)
+				continue
+			}
+			checkRoles("users", user.ID, team.OrgID, "teams.roles", membership.Roles)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = each(ctx, db.Collection("roles"), func(role models.Role) {
+		checkOrg("roles", role.ID, role.OrgID)
+		checkRoles("roles", role.ID, role.OrgID, "parents", role.Parents)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = each(ctx, db.Collection("access_groups"), func(group models.AccessGroup) {
+		checkOrg("access_groups", group.ID, group.OrgID)
+		checkRoles("access_groups", group.ID, group.OrgID, "roles", group.Roles)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, team := range c.teams {
+		checkOrg("teams", team.ID, team.OrgID)
+		if !team.ParentID.IsZero() {
+			if parent, exists := c.teams[team.ParentID]; !exists || parent.OrgID != team.OrgID {
+				report("teams", team.ID, "parent_id", team.ParentID)
+			}
+		}
+		checkRoles("teams", team.ID, team.OrgID, "roles", team.Roles)
+		checkRoles("teams", team.ID, team.OrgID, "assignable_roles", team.AssignableRoles)
+	}
+
+	sort.SliceStable(orphans, func(i, j int) bool {
+		if orphans[i].Collection != orphans[j].Collection {
+			return orphans[i].Collection < orphans[j].Collection
+		}
+		return orphans[i].ID.Hex() < orphans[j].ID.Hex()
+	})
+	return orphans, nil
+}
+
+func loadCatalog(ctx context.Context, db *mongo.Database) (catalog, error) {
+	c := catalog{
+		orgs:   make(map[primitive.ObjectID]bool),
+		roles:  make(map[primitive.ObjectID]map[string]bool),
+		groups: make(map[primitive.ObjectID]primitive.ObjectID),
+		teams:  make(map[primitive.ObjectID]models.Team),
+	}
+	err := each(ctx, db.Collection("organizations"), func(org models.Organization) {
+		c.orgs[org.ID] = true
+	})
+	if err != nil {
+		return c, err
+	}
+	err = each(ctx, db.Collection("roles"), func(role models.Role) {
+		if c.roles[role.OrgID] == nil {
+			c.roles[role.OrgID] = make(map[string]bool)
+		}
+		c.roles[role.OrgID][role.Name] = true
+	})
+	if err != nil {
+		return c, err
+	}
+	err = each(ctx, db.Collection("access_groups"), func(group models.AccessGroup) {
+		c.groups[group.ID] = group.OrgID
+	})
+	if err != nil {
+		return c, err
+	}
+	err = each(ctx, db.Collection("teams"), func(team models.Team) {
+		c.teams[team.ID] = team
+	})
+	return c, err
+}
+
+// each decodes every document of the collection and passes it to fn.
+func each[T any](ctx context.Context, collection *mongo.Collection, fn func(T)) error {
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var document T
+		if err := cursor.Decode(&document); err != nil {
+			return err
+		}
+		fn(document)
+	}
+	return cursor.Err()
+}
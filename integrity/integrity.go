@@ -0,0 +1,312 @@
+// Package integrity keeps the references to roles and access groups
+// consistent. Access groups are referenced by ID, roles by name: renaming a
+// role rewrites every reference to it, and deleting a role or access group
+// that is still referenced is blocked, strips the references or reassigns
+// them to a fallback.
+package integrity
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/tenant"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Cascade modes for deleting a role or access group that is still
+// referenced.
+const (
+	CascadeBlock    = "block"
+	CascadeStrip    = "strip"
+	CascadeReassign = "reassign"
+)
+
+// ValidCascade reports whether mode is one of the cascade modes.
+func ValidCascade(mode string) bool {
+	return mode == CascadeBlock || mode == CascadeStrip || mode == CascadeReassign
+}
+
+// InUseError is returned when deleting with CascadeBlock something that is
+// still referenced. Counts holds the number of referencing documents keyed
+// by where they were found, e.g. "users.roles".
+type InUseError struct {
+	Counts map[string]int64
+}
+
+func (e *InUseError) Error() string {
+	keys := make([]string, 0, len(e.Counts))
+	for key := range e.Counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %d", key, e.Counts[key]))
+	}
+	return "still referenced by " + strings.Join(parts, ", ")
+}
+
+// Details returns the counts as strings, for use as response details.
+func (e *InUseError) Details() map[string]string {
+	details := make(map[string]string, len(e.Counts))
+	for key, count := range e.Counts {
+		details[key] = fmt.Sprintf("%d", count)
+	}
+	return details
+}
+
+// reference is one place holding value, a role name or access group ID.
+// Either list is the path of an array of references, or field is the path
+// of a single reference inside the elements of the elements array.
+type reference struct {
+	key          string
+	collection   string
+	filter       bson.M
+	value        interface{}
+	list         string
+	field        string
+	elements     string
+	arrayFilters []interface{}
+}
+
+func (r reference) count(ctx context.Context, db *mongo.Database) (int64, error) {
+	return db.Collection(r.collection).CountDocuments(ctx, r.filter)
+}
+
+// replace points the reference at value instead.
+func (r reference) replace(ctx context.Context, db *mongo.Database, value interface{}) error {
+	collection := db.Collection(r.collection)
+	opts := options.Update()
+	if len(r.arrayFilters) > 0 {
+		opts.SetArrayFilters(options.ArrayFilters{Filters: r.arrayFilters})
+	}
+	if r.field != "" {
+		_, err := collection.UpdateMany(ctx, r.filter, bson.M{"$set": bson.M{r.field: value}}, opts)
+		return err
+	}
+
+	// Add the new value before pulling the old one, which the filter and
+	// array filters still match
+	if _, err := collection.UpdateMany(ctx, r.filter, bson.M{"$addToSet": bson.M{r.list: value}}, opts); err != nil {
+		return err
+	}
+	return r.strip(ctx, db)
+}
+
+// strip removes the reference.
+func (r reference) strip(ctx context.Context, db *mongo.Database) error {
+	collection := db.Collection(r.collection)
+	opts := options.Update()
+	if len(r.arrayFilters) > 0 {
+		opts.SetArrayFilters(options.ArrayFilters{Filters: r.arrayFilters})
+	}
+	update := bson.M{"$pull": bson.M{r.list: r.value}}
+	if r.list == "" {
+		update = bson.M{"$pull": bson.M{r.elements: bson.M{lastSegment(r.field): r.value}}}
+	}
+	_, err := collection.UpdateMany(ctx, r.filter, update, opts)
+	return err
+}
+
+func lastSegment(path string) string {
+	return path[strings.LastIndex(path, ".")+1:]
+}
+
+// apply deletes with the given cascade mode: CascadeBlock returns an
+// InUseError when any reference remains, CascadeStrip removes the
+// references and CascadeReassign points them at fallback.
+func apply(ctx context.Context, db *mongo.Database, refs []reference, mode string, fallback interface{}) error {
+	switch mode {
+	case CascadeStrip:
+		for _, ref := range refs {
+			if err := ref.strip(ctx, db); err != nil {
+				return err
+			}
+		}
+		return nil
+	case CascadeReassign:
+		for _, ref := range refs {
+			if err := ref.replace(ctx, db, fallback); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	inUse := &InUseError{Counts: make(map[string]int64)}
+	for _, ref := range refs {
+		count, err := ref.count(ctx, db)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			inUse.Counts[ref.key] += count
+		}
+	}
+	if len(inUse.Counts) > 0 {
+		return inUse
+	}
+	return nil
+}
+
+func mdmdb() *mongo.Database {
+	return database.MongoClient.Database("mdmdb")
+}
+
+// DeleteAccessGroup deletes an access group after handling the users
+// referencing it according to mode. With CascadeReassign, fallback is the
+// access group taking over its members and must have the same owner.
+func DeleteAccessGroup(ctx context.Context, group models.AccessGroup, mode string, fallback primitive.ObjectID) error {
+	db := mdmdb()
+	if err := apply(ctx, db, accessGroupReferences(group), mode, fallback); err != nil {
+		return err
+	}
+	_, err := db.Collection("access_groups").DeleteOne(ctx, bson.M{"_id": group.ID})
+	return err
+}
+
+// AccessGroupMembers matches the users belonging to the access group,
+// through their organization membership for groups owned by an organization.
+func AccessGroupMembers(group models.AccessGroup) bson.M {
+	if group.OrgID.IsZero() {
+		return bson.M{"access_groups": group.ID}
+	}
+	return bson.M{"orgs": bson.M{"$elemMatch": bson.M{"org_id": group.OrgID, "access_groups": group.ID}}}
+}
+
+func accessGroupReferences(group models.AccessGroup) []reference {
+	if group.OrgID.IsZero() {
+		return []reference{{
+			key:        "users.access_groups",
+			collection: "users",
+			filter:     AccessGroupMembers(group),
+			value:      group.ID,
+			list:       "access_groups",
+		}}
+	}
+	return []reference{{
+		key:          "users.orgs.access_groups",
+		collection:   "users",
+		filter:       AccessGroupMembers(group),
+		value:        group.ID,
+		list:         "orgs.$[ref].access_groups",
+		arrayFilters: []interface{}{bson.M{"ref.org_id": group.OrgID, "ref.access_groups": group.ID}},
+	}}
+}
+
+// DeleteRole deletes a role after handling the references to it according
+// to mode. With CascadeReassign, fallback is the name of the role taking
+// over and must be usable wherever the deleted role was.
+func DeleteRole(ctx context.Context, role models.Role, mode, fallback string) error {
+	db := mdmdb()
+	refs, err := roleReferences(ctx, db, role)
+	if err != nil {
+		return err
+	}
+	if err := apply(ctx, db, refs, mode, fallback); err != nil {
+		return err
+	}
+	_, err = db.Collection("roles").DeleteOne(ctx, bson.M{"_id": role.ID})
+	return err
+}
+
+// RenameRole rewrites every reference to the role's previous name. The role
+// itself must already carry its new name.
+func RenameRole(ctx context.Context, role models.Role, previous string) error {
+	db := mdmdb()
+	renamed := role
+	renamed.Name = previous
+	refs, err := roleReferences(ctx, db, renamed)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if err := ref.replace(ctx, db, role.Name); err != nil {
+			return err
+		}
+	}
+
+	// Pending requests follow the role; decided ones keep their history
+	_, err = db.Collection("role_requests").UpdateMany(ctx,
+		bson.M{"role": previous, "status": models.RoleRequestPending},
+		bson.M{"$set": bson.M{"role": role.Name}},
+	)
+	return err
+}
+
+// roleReferences lists the places naming the role. A global role can be
+// referenced from every organization, except from those with a role of the
+// same name of their own, which shadows it there.
+func roleReferences(ctx context.Context, db *mongo.Database, role models.Role) ([]reference, error) {
+	name := role.Name
+
+	var owners bson.M
+	var orgFilter bson.M
+	if role.OrgID.IsZero() {
+		shadowing, err := db.Collection("roles").Distinct(ctx, "org_id", bson.M{"name": name, "org_id": bson.M{"$exists": true}})
+		if err != nil {
+			return nil, err
+		}
+		owners = bson.M{"org_id": bson.M{"$nin": nonNil(shadowing)}}
+		orgFilter = bson.M{"ref.org_id": bson.M{"$nin": nonNil(shadowing)}}
+	} else {
+		owners = tenant.OwnedBy(role.OrgID)
+		orgFilter = bson.M{"ref.org_id": role.OrgID}
+	}
+	teamIDs, err := db.Collection("teams").Distinct(ctx, "_id", owners)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []reference{
+		{
+			key:          "users.orgs.roles",
+			collection:   "users",
+			filter:       bson.M{"orgs": bson.M{"$elemMatch": bson.M{"org_id": orgFilter["ref.org_id"], "roles": name}}},
+			value:        name,
+			list:         "orgs.$[ref].roles",
+			arrayFilters: []interface{}{bson.M{"ref.org_id": orgFilter["ref.org_id"], "ref.roles": name}},
+		},
+		{
+			key:          "users.teams.roles",
+			collection:   "users",
+			filter:       bson.M{"teams": bson.M{"$elemMatch": bson.M{"team_id": bson.M{"$in": nonNil(teamIDs)}, "roles": name}}},
+			value:        name,
+			list:         "teams.$[ref].roles",
+			arrayFilters: []interface{}{bson.M{"ref.team_id": bson.M{"$in": nonNil(teamIDs)}, "ref.roles": name}},
+		},
+		{key: "roles.parents", collection: "roles", filter: tenant.With(owners, bson.M{"parents": name}), value: name, list: "parents"},
+		{key: "access_groups.roles", collection: "access_groups", filter: tenant.With(owners, bson.M{"roles": name}), value: name, list: "roles"},
+		{key: "teams.roles", collection: "teams", filter: tenant.With(owners, bson.M{"roles": name}), value: name, list: "roles"},
+		{key: "teams.assignable_roles", collection: "teams", filter: tenant.With(owners, bson.M{"assignable_roles": name}), value: name, list: "assignable_roles"},
+	}
+	if role.OrgID.IsZero() {
+		refs = append(refs,
+			reference{key: "users.roles", collection: "users", filter: bson.M{"roles": name}, value: name, list: "roles"},
+			reference{
+				key:          "users.role_grants",
+				collection:   "users",
+				filter:       bson.M{"role_grants.role": name},
+				value:        name,
+				field:        "role_grants.$[ref].role",
+				elements:     "role_grants",
+				arrayFilters: []interface{}{bson.M{"ref.role": name}},
+			},
+		)
+	}
+	return refs, nil
+}
+
+func nonNil(values []interface{}) []interface{} {
+	if values == nil {
+		return []interface{}{}
+	}
+	return values
+}
@@ -3,15 +3,34 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"strings"
+	"unified-go-backend/authz"
 	"unified-go-backend/database"
 	"unified-go-backend/models"
+	"unified-go-backend/tenant"
 	"unified-go-backend/utils"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// AuthorizationMiddleware allows the request only when the user holds every
+// one of the required permissions.
 func AuthorizationMiddleware(requiredPermissions ...string) gin.HandlerFunc {
+	return authorize(requiredPermissions, false)
+}
+
+// AuthorizationAnyMiddleware allows the request when the user holds at least
+// one of the required permissions.
+func AuthorizationAnyMiddleware(requiredPermissions ...string) gin.HandlerFunc {
+	return authorize(requiredPermissions, true)
+}
+
+func authorize(requiredPermissions []string, anyOf bool) gin.HandlerFunc {
+	// Record the permissions in the catalog so startup can verify them
+	authz.Require(requiredPermissions...)
+
 	return func(c *gin.Context) {
 		email, exists := c.Get("email")
 		if !exists {
@@ -31,8 +50,10 @@ func AuthorizationMiddleware(requiredPermissions ...string) gin.HandlerFunc {
 			return
 		}
 
-		if !hasRequiredPermissions(user, requiredPermissions) {
+		allowed, reason := hasRequiredPermissions(user, tenant.ID(c), requiredPermissions, anyOf, c.ClientIP())
+		if !allowed {
 			utils.Logger.Warnf("AuthorizationMiddleware: User %s does not have required permissions", email)
+			utils.Logger.Debugf("AuthorizationMiddleware: User %s refused: %s", email, reason)
 			c.JSON(http.StatusForbidden, utils.CreateErrorResponse("Forbidden", nil))
 			c.Abort()
 			return
@@ -42,35 +63,36 @@ func AuthorizationMiddleware(requiredPermissions ...string) gin.HandlerFunc {
 	}
 }
 
-func hasRequiredPermissions(user models.User, requiredPermissions []string) bool {
-	userPermissions := make(map[string]bool)
-
-	// Fetch roles and permissions from the user's roles
-	for _, role := range user.Roles {
-		var roleDoc models.Role
-		err := database.MongoClient.Database("mdmdb").Collection("roles").FindOne(context.TODO(), bson.M{"name": role}).Decode(&roleDoc)
-		if err == nil {
-			for _, perm := range roleDoc.Permissions {
-				userPermissions[perm] = true
-			}
-		}
+// hasRequiredPermissions reports whether the user may proceed inside org and,
+// when not, which rules caused the refusal. A permission counts only when
+// both the user's roles grant it and the policies that do not depend on a
+// loaded resource allow it. The user's grants come from the permission
+// cache.
+func hasRequiredPermissions(user models.User, org primitive.ObjectID, requiredPermissions []string, anyOf bool, ip string) (bool, string) {
+	grants, err := authz.CachedGrants(context.TODO(), user, org)
+	if err != nil {
+		utils.Logger.Errorf("hasRequiredPermissions: Error resolving permissions for %s: %v", user.Email, err)
+		return false, "error resolving permissions"
 	}
 
-	// Fetch permissions from the user's access group
-	if user.AccessGroup != "" {
-		var accessGroup models.AccessGroup
-		err := database.MongoClient.Database("mdmdb").Collection("access_groups").FindOne(context.TODO(), bson.M{"name": user.AccessGroup}).Decode(&accessGroup)
-		if err == nil {
-			for _, perm := range accessGroup.Permissions {
-				userPermissions[perm] = true
-			}
+	var reasons []string
+	for _, perm := range requiredPermissions {
+		decision := grants.Authorize(authz.PolicyRequest{Action: perm, Subject: user, IP: ip})
+		allowed, reason := decision.Allowed, decision.Reason
+
+		if anyOf && allowed {
+			return true, ""
+		}
+		if !anyOf && !allowed {
+			return false, perm + ": " + reason
+		}
+		if !allowed {
+			reasons = append(reasons, perm+": "+reason)
 		}
 	}
 
-	for _, requiredPerm := range requiredPermissions {
-		if !userPermissions[requiredPerm] {
-			return false
-		}
+	if anyOf && len(requiredPermissions) > 0 {
+		return false, strings.Join(reasons, "; ")
 	}
-	return true
+	return true, ""
 }
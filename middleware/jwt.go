@@ -3,13 +3,24 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"unified-go-backend/config"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/userquery"
+	"unified-go-backend/utils"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// PasswordChangePath is the route users with a temporary password are
+// limited to.
+const PasswordChangePath = "/api/v1/user/password"
+
 func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.GetHeader("Authorization")
@@ -44,6 +55,45 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 		email := claims["email"].(string) // Assuming "username" is a claim in your JWT
 		c.Set("email", email)
 
+		// Tokens of deleted users stop working at once
+		var user models.User
+		collection := database.MongoClient.Database("mdmdb").Collection("users")
+		err = collection.FindOne(c.Request.Context(), userquery.Live(bson.M{"email": email})).Decode(&user)
+		if err == mongo.ErrNoDocuments {
+			utils.Logger.Warnf("AuthMiddleware: User %s no longer exists", email)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			utils.Logger.Errorf("AuthMiddleware: Error fetching user: %v", err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching user", nil))
+			c.Abort()
+			return
+		}
+
+		// Blocking an account ends its sessions too
+		if user.Status.Blocked(time.Now()) {
+			utils.Logger.Warnf("AuthMiddleware: Account of %s is %s", email, user.Status.State)
+			c.JSON(http.StatusForbidden, utils.CreateErrorResponse("Account "+user.Status.State, nil))
+			c.Abort()
+			return
+		}
+
+		// A temporary password must be changed before anything else
+		if user.PasswordChangeRequired && c.FullPath() != PasswordChangePath {
+			utils.Logger.Warnf("AuthMiddleware: %s must change their temporary password", email)
+			c.JSON(http.StatusForbidden, utils.CreateErrorResponse("Password change required", nil))
+			c.Abort()
+			return
+		}
+
+		// Scope the request to the organization it names, if any
+		if !resolveTenant(c, cfg, claims, user) {
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"unified-go-backend/authz"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RelationMiddleware allows the request only when the authenticated user has
+// relation on the object of objectType identified by the route parameter
+// param, e.g. RelationMiddleware("document", "view", "id") on
+// /documents/:id checks "user:<id>" against "document:<:id>". An objectType
+// starting with ":" names the route parameter holding the type instead.
+// Malformed objects are refused with 400.
+func RelationMiddleware(objectType, relation, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, exists := c.Get("email")
+		if !exists {
+			utils.Logger.Errorf("RelationMiddleware: Failed to get email from context")
+			c.JSON(http.StatusUnauthorized, utils.CreateErrorResponse("Unauthorized", nil))
+			c.Abort()
+			return
+		}
+
+		collection := database.MongoClient.Database("mdmdb").Collection("users")
+		var user models.User
+		err := collection.FindOne(c.Request.Context(), bson.M{"email": email}).Decode(&user)
+		if err != nil {
+			utils.Logger.Errorf("RelationMiddleware: Error fetching user: %v", err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching user", nil))
+			c.Abort()
+			return
+		}
+
+		subject := "user:" + user.ID.Hex()
+		object := objectType + ":" + c.Param(param)
+		if strings.HasPrefix(objectType, ":") {
+			object = c.Param(objectType[1:]) + ":" + c.Param(param)
+		}
+		allowed, err := authz.Check(c.Request.Context(), subject, relation, object)
+		if err == authz.ErrNoSchema {
+			utils.Logger.Errorf("RelationMiddleware: %v", err)
+			c.JSON(http.StatusConflict, utils.CreateErrorResponse("No relation schema has been defined", nil))
+			c.Abort()
+			return
+		}
+		if authz.IsRelationInputError(err) {
+			utils.Logger.Errorf("RelationMiddleware: Invalid object: %v", err)
+			c.JSON(http.StatusBadRequest, utils.CreateErrorResponse("Validation error", map[string]string{param: err.Error()}))
+			c.Abort()
+			return
+		}
+		if err != nil {
+			utils.Logger.Errorf("RelationMiddleware: Error checking %s on %s for %s: %v", relation, object, subject, err)
+			c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error checking relation", nil))
+			c.Abort()
+			return
+		}
+		if !allowed {
+			utils.Logger.Warnf("RelationMiddleware: User %s does not have %s on %s", email, relation, object)
+			c.JSON(http.StatusForbidden, utils.CreateErrorResponse("Forbidden", nil))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"unified-go-backend/config"
+	"unified-go-backend/models"
+	"unified-go-backend/tenant"
+	"unified-go-backend/utils"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// OrgHeader selects the organization of a request by ID or slug when the
+// token is not bound to one.
+const OrgHeader = "X-Org"
+
+// resolveTenant determines the organization the request runs in from the
+// token's org claim, the X-Org header or the subdomain, in that order, and
+// checks that the user belongs to it. Requests naming no organization run
+// in the global context. It writes the error response and returns false
+// when the organization cannot be used.
+func resolveTenant(c *gin.Context, cfg *config.Config, claims jwt.MapClaims, user models.User) bool {
+	claimed, _ := claims["org"].(string)
+	requested := c.GetHeader(OrgHeader)
+	if requested == "" {
+		requested = subdomain(c.Request.Host, cfg.TenantBaseDomain)
+	}
+
+	ref := claimed
+	if ref == "" {
+		ref = requested
+	}
+	if ref == "" {
+		return true
+	}
+
+	org, err := tenant.FindOrganization(c.Request.Context(), ref)
+	if err == mongo.ErrNoDocuments {
+		utils.Logger.Errorf("AuthMiddleware: Organization not found: %s", ref)
+		c.JSON(http.StatusNotFound, utils.CreateErrorResponse("Organization not found", nil))
+		return false
+	}
+	if err != nil {
+		utils.Logger.Errorf("AuthMiddleware: Error fetching organization: %v", err)
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Error fetching organization", nil))
+		return false
+	}
+
+	// A token bound to an organization cannot be used for another one
+	if claimed != "" && requested != "" && requested != org.ID.Hex() && requested != org.Slug {
+		utils.Logger.Warnf("AuthMiddleware: Token of %s is bound to organization %s, not %s", user.Email, org.Slug, requested)
+		c.JSON(http.StatusForbidden, utils.CreateErrorResponse("Forbidden", nil))
+		return false
+	}
+
+	if _, member := tenant.Membership(user, org.ID); !member {
+		utils.Logger.Warnf("AuthMiddleware: User %s is not a member of organization %s", user.Email, org.Slug)
+		c.JSON(http.StatusForbidden, utils.CreateErrorResponse("Forbidden", nil))
+		return false
+	}
+
+	tenant.Set(c, org.ID)
+	return true
+}
+
+// subdomain returns the first label of host when it is a subdomain of base.
+func subdomain(host, base string) string {
+	if base == "" {
+		return ""
+	}
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	label := strings.TrimSuffix(host, "."+base)
+	if label == host || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
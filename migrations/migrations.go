@@ -0,0 +1,243 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"unified-go-backend/authz"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migration is a named, one-off change to the stored data.
+type migration struct {
+	name string
+	up   func(ctx context.Context, db *mongo.Database) error
+}
+
+// migrations are applied in order. Append new entries to the end and never
+// rename or remove an entry that may already have run.
+var migrations = []migration{
+	{name: "0001_user_access_groups", up: migrateUserAccessGroups},
+	{name: "0002_namespaced_permissions", up: migrateNamespacedPermissions},
+	{name: "0003_organization_indexes", up: createOrganizationIndexes},
+	{name: "0004_access_group_ids", up: migrateAccessGroupIDs},
+}
+
+// Run applies every migration that has not been recorded in the migrations
+// collection yet.
+func Run(ctx context.Context) error {
+	db := database.MongoClient.Database("mdmdb")
+	applied := db.Collection("migrations")
+
+	for _, m := range migrations {
+		err := applied.FindOne(ctx, bson.M{"name": m.name}).Err()
+		if err == nil {
+			continue
+		}
+		if err != mongo.ErrNoDocuments {
+			return err
+		}
+
+		utils.Logger.Infof("Applying migration %s", m.name)
+		if err := m.up(ctx, db); err != nil {
+			return err
+		}
+		if _, err := applied.InsertOne(ctx, bson.M{"name": m.name, "applied_at": time.Now()}); err != nil {
+			return err
+		}
+		authz.InvalidateAll(ctx)
+	}
+	return nil
+}
+
+// migrateUserAccessGroups moves the single access group stored on users into
+// the access_groups list.
+func migrateUserAccessGroups(ctx context.Context, db *mongo.Database) error {
+	filter := bson.M{"accessgroup": bson.M{"$exists": true}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"access_groups": bson.M{"$cond": bson.A{
+				bson.M{"$in": bson.A{"$accessgroup", bson.A{"", nil}}},
+				bson.M{"$ifNull": bson.A{"$access_groups", bson.A{}}},
+				bson.M{"$setUnion": bson.A{bson.M{"$ifNull": bson.A{"$access_groups", bson.A{}}}, bson.A{"$accessgroup"}}},
+			}},
+		}}},
+		{{Key: "$unset", Value: "accessgroup"}},
+	}
+	_, err := db.Collection("users").UpdateMany(ctx, filter, update)
+	return err
+}
+
+// migrateNamespacedPermissions rewrites the legacy flat permission names
+// stored in roles, access groups and the permissions collection to their
+// namespaced equivalents.
+func migrateNamespacedPermissions(ctx context.Context, db *mongo.Database) error {
+	for legacy, name := range authz.Aliases() {
+		for _, collection := range []string{"roles", "access_groups"} {
+			// Add the new name before pulling the legacy one
+			filter := bson.M{"permissions": legacy}
+			if _, err := db.Collection(collection).UpdateMany(ctx, filter, bson.M{"$addToSet": bson.M{"permissions": name}}); err != nil {
+				return err
+			}
+			if _, err := db.Collection(collection).UpdateMany(ctx, filter, bson.M{"$pull": bson.M{"permissions": legacy}}); err != nil {
+				return err
+			}
+		}
+
+		permissions := db.Collection("permissions")
+		count, err := permissions.CountDocuments(ctx, bson.M{"name": name})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			_, err = permissions.DeleteMany(ctx, bson.M{"name": legacy})
+		} else {
+			_, err = permissions.UpdateMany(ctx, bson.M{"name": legacy}, bson.M{"$set": bson.M{"name": name}})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createOrganizationIndexes makes organization slugs unique and indexes the
+// fields used to scope users, roles and access groups to an organization.
+func createOrganizationIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("organizations").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "slug", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "orgs.org_id", Value: 1}}}); err != nil {
+		return err
+	}
+	for _, name := range []string{"roles", "access_groups"} {
+		index := mongo.IndexModel{Keys: bson.D{{Key: "org_id", Value: 1}, {Key: "name", Value: 1}}}
+		if _, err := db.Collection(name).Indexes().CreateOne(ctx, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateAccessGroupIDs replaces the access group names stored on users,
+// organization memberships, access review items and access policies with
+// the groups' IDs. Names of groups that no longer exist are dropped.
+func migrateAccessGroupIDs(ctx context.Context, db *mongo.Database) error {
+	// Group IDs by owner and name
+	ids := make(map[primitive.ObjectID]map[string]primitive.ObjectID)
+	cursor, err := db.Collection("access_groups").Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	for cursor.Next(ctx) {
+		var group models.AccessGroup
+		if err := cursor.Decode(&group); err != nil {
+			cursor.Close(ctx)
+			return err
+		}
+		if ids[group.OrgID] == nil {
+			ids[group.OrgID] = make(map[string]primitive.ObjectID)
+		}
+		ids[group.OrgID][group.Name] = group.ID
+	}
+	cursor.Close(ctx)
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	resolve := func(owner primitive.ObjectID, value interface{}, userID primitive.ObjectID) bson.A {
+		resolved := bson.A{}
+		list, _ := value.(bson.A)
+		for _, item := range list {
+			switch v := item.(type) {
+			case primitive.ObjectID:
+				resolved = append(resolved, v)
+			case string:
+				if id, exists := ids[owner][v]; exists {
+					resolved = append(resolved, id)
+				} else {
+					utils.Logger.Warnf("Dropping unknown access group %s of user %s", v, userID.Hex())
+				}
+			}
+		}
+		return resolved
+	}
+
+	users := db.Collection("users")
+	filter := bson.M{"$or": []bson.M{
+		{"access_groups": bson.M{"$type": "string"}},
+		{"orgs.access_groups": bson.M{"$type": "string"}},
+	}}
+	cursor, err = users.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var user struct {
+			ID           primitive.ObjectID `bson:"_id"`
+			AccessGroups interface{}        `bson:"access_groups"`
+			Orgs         []bson.M           `bson:"orgs"`
+		}
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+		set := bson.M{"access_groups": resolve(primitive.NilObjectID, user.AccessGroups, user.ID)}
+		for i, membership := range user.Orgs {
+			org, _ := membership["org_id"].(primitive.ObjectID)
+			set[fmt.Sprintf("orgs.%d.access_groups", i)] = resolve(org, membership["access_groups"], user.ID)
+		}
+		if _, err := users.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	// Access reviews only cover global access groups
+	items := db.Collection("access_review_items")
+	for name, id := range ids[primitive.NilObjectID] {
+		itemFilter := bson.M{"kind": "access_group", "name": name, "access_group_id": bson.M{"$exists": false}}
+		if _, err := items.UpdateMany(ctx, itemFilter, bson.M{"$set": bson.M{"access_group_id": id}}); err != nil {
+			return err
+		}
+	}
+
+	// Policies compare subject.access_groups, which now holds hex IDs, with
+	// either a single name or a list of names
+	policies := db.Collection("policies")
+	for name, id := range ids[primitive.NilObjectID] {
+		policyFilter := bson.M{"conditions": bson.M{"$elemMatch": bson.M{"attribute": "subject.access_groups", "value": name}}}
+		updates := []struct {
+			path         string
+			arrayFilters []interface{}
+		}{
+			{"conditions.$[condition].value", []interface{}{
+				bson.M{"condition.attribute": "subject.access_groups", "condition.value": bson.M{"$eq": name, "$not": bson.M{"$type": "array"}}},
+			}},
+			{"conditions.$[condition].value.$[item]", []interface{}{
+				bson.M{"condition.attribute": "subject.access_groups", "condition.value": bson.M{"$type": "array"}},
+				bson.M{"item": name},
+			}},
+		}
+		for _, update := range updates {
+			opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: update.arrayFilters})
+			if _, err := policies.UpdateMany(ctx, policyFilter, bson.M{"$set": bson.M{update.path: id.Hex()}}, opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -5,8 +5,18 @@ import (
 )
 
 type AccessGroup struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	// OrgID is the organization owning the group. Global groups have none
+	// and only apply outside organizations.
+	OrgID       primitive.ObjectID `bson:"org_id,omitempty" json:"org_id,omitempty"`
 	Name        string             `json:"name" validate:"required"`
 	Roles       []string           `json:"roles"`
 	Permissions []string           `json:"permissions"`
+	// Deny lists permissions refused to every member of the group. Deny
+	// entries override grants from any role or access group.
+	Deny []string `bson:"deny,omitempty" json:"deny"`
+}
+
+type AccessGroupMembersRequest struct {
+	UserIDs []string `json:"user_ids" validate:"required,min=1"`
 }
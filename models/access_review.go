@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Access review campaign statuses.
+const (
+	AccessReviewActive    = "active"
+	AccessReviewCompleted = "completed"
+)
+
+// Access review item kinds and decisions.
+const (
+	AccessReviewKindRole        = "role"
+	AccessReviewKindAccessGroup = "access_group"
+
+	AccessReviewPending  = "pending"
+	AccessReviewApproved = "approved"
+	AccessReviewRevoked  = "revoked"
+)
+
+// AccessReview is a certification campaign. When it starts every role and
+// access group held by the users in scope becomes an item for a reviewer to
+// approve or revoke. Items still pending when the campaign ends are revoked.
+type AccessReview struct {
+	ID           primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Name         string               `bson:"name" json:"name"`
+	Description  string               `bson:"description,omitempty" json:"description,omitempty"`
+	Roles        []string             `bson:"roles,omitempty" json:"roles,omitempty"`
+	AccessGroups []string             `bson:"access_groups,omitempty" json:"access_groups,omitempty"`
+	UserIDs      []primitive.ObjectID `bson:"user_ids,omitempty" json:"user_ids,omitempty"`
+	Reviewers    []string             `bson:"reviewers" json:"reviewers"`
+	Status       string               `bson:"status" json:"status"`
+	CreatedBy    string               `bson:"created_by" json:"created_by"`
+	CreatedAt    time.Time            `bson:"created_at" json:"created_at"`
+	EndsAt       time.Time            `bson:"ends_at" json:"ends_at"`
+	CompletedAt  time.Time            `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+// AccessReviewItem is a single role or access group held by a user under
+// review in a campaign.
+type AccessReviewItem struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CampaignID primitive.ObjectID `bson:"campaign_id" json:"campaign_id"`
+	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Email      string             `bson:"email" json:"email"`
+	Kind       string             `bson:"kind" json:"kind"`
+	Name       string             `bson:"name" json:"name"`
+	// AccessGroupID identifies the reviewed access group; Name keeps the
+	// group's name at the time the campaign started.
+	AccessGroupID primitive.ObjectID `bson:"access_group_id,omitempty" json:"access_group_id,omitempty"`
+	Reviewer      string             `bson:"reviewer" json:"reviewer"`
+	Decision      string             `bson:"decision" json:"decision"`
+	DecidedBy     string             `bson:"decided_by,omitempty" json:"decided_by,omitempty"`
+	DecidedAt     time.Time          `bson:"decided_at,omitempty" json:"decided_at,omitempty"`
+	Note          string             `bson:"note,omitempty" json:"note,omitempty"`
+}
+
+// AccessReviewSummary counts a campaign's items by decision.
+type AccessReviewSummary struct {
+	AccessReview
+	Pending  int `json:"pending"`
+	Approved int `json:"approved"`
+	Revoked  int `json:"revoked"`
+}
+
+// NewAccessReview starts a campaign. Leaving Roles, AccessGroups and UserIDs
+// empty reviews every role and access group of every user.
+type NewAccessReview struct {
+	Name         string    `json:"name" validate:"required"`
+	Description  string    `json:"description"`
+	Roles        []string  `json:"roles"`
+	AccessGroups []string  `json:"access_groups"`
+	UserIDs      []string  `json:"user_ids"`
+	Reviewers    []string  `json:"reviewers" validate:"required,min=1,dive,email"`
+	EndsAt       time.Time `json:"ends_at" validate:"required"`
+}
+
+type AccessReviewDecision struct {
+	Decision string `json:"decision" validate:"required,oneof=approved revoked"`
+	Note     string `json:"note" validate:"max=500"`
+}
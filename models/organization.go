@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Organization is a tenant. Users join organizations through memberships,
+// and roles and access groups may belong to a single organization.
+type Organization struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name      string             `bson:"name" json:"name" validate:"required"`
+	Slug      string             `bson:"slug" json:"slug" validate:"required,min=2,max=63,hostname_rfc1123" example:"acme"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// OrgMembership lists the roles and the IDs of the access groups a user
+// holds inside an organization.
+type OrgMembership struct {
+	OrgID        primitive.ObjectID   `bson:"org_id" json:"org_id"`
+	Roles        []string             `bson:"roles" json:"roles"`
+	AccessGroups []primitive.ObjectID `bson:"access_groups" json:"access_groups"`
+}
+
+// OrgMemberRequest names the membership's access groups; they are stored
+// by ID.
+type OrgMemberRequest struct {
+	UserID       string   `json:"user_id" validate:"required"`
+	Roles        []string `json:"roles"`
+	AccessGroups []string `json:"access_groups"`
+}
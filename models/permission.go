@@ -1,5 +1,6 @@
 package models
 
 type Permission struct {
-	Name string `json:"name" validate:"required"`
+	Name        string `json:"name" validate:"required"`
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
 }
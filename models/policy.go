@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Policy is an attribute-based rule evaluated on top of role permissions.
+// It applies to the actions (permission names or patterns) it lists and
+// holds when all of its conditions hold.
+type Policy struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name        string             `bson:"name" json:"name" validate:"required"`
+	Description string             `bson:"description,omitempty" json:"description"`
+	Effect      string             `bson:"effect" json:"effect" validate:"required,oneof=allow deny"`
+	Actions     []string           `bson:"actions" json:"actions" validate:"required,min=1"`
+	Conditions  []Condition        `bson:"conditions" json:"conditions" validate:"dive"`
+	Enabled     bool               `bson:"enabled" json:"enabled"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Condition compares an attribute of the subject, resource or environment,
+// e.g. "subject.access_groups" or "env.hour", with either a literal value
+// or another attribute named by ValueFrom.
+type Condition struct {
+	Attribute string      `bson:"attribute" json:"attribute" validate:"required"`
+	Operator  string      `bson:"operator" json:"operator" validate:"required,oneof=eq ne in not_in contains not_contains intersects gt gte lt lte between cidr"`
+	Value     interface{} `bson:"value,omitempty" json:"value,omitempty"`
+	ValueFrom string      `bson:"value_from,omitempty" json:"value_from,omitempty"`
+}
+
+// AuthzCheckRequest asks which of several actions the caller may perform.
+type AuthzCheckRequest struct {
+	Items []AuthzCheckItem `json:"items" validate:"required,min=1,max=100,dive"`
+}
+
+// AuthzCheckItem is a permission, optionally on a specific resource so that
+// resource-dependent policies are evaluated too.
+type AuthzCheckItem struct {
+	Permission   string `json:"permission" validate:"required"`
+	ResourceType string `json:"resource_type,omitempty" validate:"omitempty,oneof=user access_group role"`
+	ResourceID   string `json:"resource_id,omitempty" validate:"required_with=ResourceType"`
+}
+
+// AuthzCheckResult is the decision for one AuthzCheckItem.
+type AuthzCheckResult struct {
+	Permission   string `json:"permission"`
+	ResourceType string `json:"resource_type,omitempty"`
+	ResourceID   string `json:"resource_id,omitempty"`
+	Allowed      bool   `json:"allowed"`
+	Reason       string `json:"reason"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Data export statuses.
+const (
+	DataExportPending = "pending"
+	DataExportRunning = "running"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// DataExport is a user's request for an archive of the data held about
+// them. Once ready the archive can be downloaded until ExpiresAt.
+type DataExport struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Status      string             `bson:"status" json:"status"`
+	RequestedAt time.Time          `bson:"requested_at" json:"requested_at"`
+	StartedAt   time.Time          `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	CompletedAt time.Time          `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+	ExpiresAt   time.Time          `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	// FileID identifies the archive in the data_exports GridFS bucket.
+	FileID primitive.ObjectID `bson:"file_id,omitempty" json:"-"`
+	Size   int64              `bson:"size,omitempty" json:"size,omitempty"`
+	Error  string             `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// AccountDeletionRequest confirms an account deletion request with the
+// user's password.
+type AccountDeletionRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// AccountDeletionResponse tells when the account will be erased.
+type AccountDeletionResponse struct {
+	ScheduledAt time.Time `json:"scheduled_at"`
+}
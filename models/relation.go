@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RelationTuple states that Subject has Relation on Object. Objects are
+// written as "type:id" (e.g. "document:42"); subjects are either an object
+// ("user:64b...") or a userset ("group:eng#member").
+type RelationTuple struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Object     string             `bson:"object" json:"object" validate:"required"`
+	ObjectType string             `bson:"object_type" json:"-"`
+	Relation   string             `bson:"relation" json:"relation" validate:"required"`
+	Subject    string             `bson:"subject" json:"subject" validate:"required"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// RelationCheckRequest asks whether Subject has Relation on Object.
+type RelationCheckRequest struct {
+	Subject  string `json:"subject" validate:"required"`
+	Relation string `json:"relation" validate:"required"`
+	Object   string `json:"object" validate:"required"`
+}
+
+// RelationSchema is the stored source of the relation schema.
+type RelationSchema struct {
+	Source    string    `bson:"source" json:"source" validate:"required"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
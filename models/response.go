@@ -2,11 +2,16 @@ package models
 
 type LoginResponse struct {
 	Token string `json:"token"`
+	// PasswordChangeRequired tells that the token only allows changing the
+	// temporary password.
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
 }
 
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=6"`
+	// Org optionally binds the token to an organization, by ID or slug.
+	Org string `json:"org"`
 }
 
 type RegisterRequest struct {
@@ -15,6 +20,13 @@ type RegisterRequest struct {
 	Password string `json:"password" validate:"required,min=6"`
 }
 
+// SetPasswordRequest sets the password of an invited user with the token
+// of the invitation.
+type SetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
 type VerifyEmailRequest struct {
 	Email string `json:"email" validate:"required,email"`
 	Code  string `json:"code" validate:"required"`
@@ -5,7 +5,19 @@ import (
 )
 
 type Role struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	// OrgID is the organization owning the role. Global roles have none;
+	// the memberships, teams and access groups of an organization only
+	// hold its own roles.
+	OrgID       primitive.ObjectID `bson:"org_id,omitempty" json:"org_id,omitempty"`
 	Name        string             `json:"name" validate:"required"`
 	Permissions []string           `json:"permissions" validate:"required"`
+	// Deny lists permissions this role explicitly refuses. Deny entries
+	// override grants from any role or access group.
+	Deny []string `bson:"deny,omitempty" json:"deny"`
+	// Parents lists the roles whose permissions this role inherits.
+	Parents []string `bson:"parents,omitempty" json:"parents"`
+	// ApproverPermission is the permission needed to approve temporary
+	// grants of this role. Requests fall back to role_requests:approve.
+	ApproverPermission string `bson:"approver_permission,omitempty" json:"approver_permission,omitempty"`
 }
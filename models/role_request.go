@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Role request statuses.
+const (
+	RoleRequestPending  = "pending"
+	RoleRequestApproved = "approved"
+	RoleRequestDenied   = "denied"
+	RoleRequestExpired  = "expired"
+)
+
+// RoleGrant is a role held by a user until ExpiresAt. Expired grants are
+// ignored when resolving permissions and removed by the worker.
+type RoleGrant struct {
+	Role      string             `bson:"role" json:"role"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+	GrantedBy string             `bson:"granted_by" json:"granted_by"`
+	RequestID primitive.ObjectID `bson:"request_id,omitempty" json:"request_id,omitempty"`
+}
+
+// RoleRequest is a user's request for a temporary role. Once approved the
+// role is granted for Duration starting at the approval.
+type RoleRequest struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Email     string             `bson:"email" json:"email"`
+	Role      string             `bson:"role" json:"role"`
+	Reason    string             `bson:"reason" json:"reason"`
+	Duration  string             `bson:"duration" json:"duration"`
+	Status    string             `bson:"status" json:"status"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	DecidedBy string             `bson:"decided_by,omitempty" json:"decided_by,omitempty"`
+	DecidedAt time.Time          `bson:"decided_at,omitempty" json:"decided_at,omitempty"`
+	Note      string             `bson:"note,omitempty" json:"note,omitempty"`
+	ExpiresAt time.Time          `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+}
+
+type NewRoleRequest struct {
+	Role     string `json:"role" validate:"required"`
+	Reason   string `json:"reason" validate:"required,max=500"`
+	Duration string `json:"duration" validate:"required" example:"4h"`
+}
+
+type RoleRequestDecision struct {
+	Note string `json:"note" validate:"max=500"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Team is a group of users inside an organization. Teams nest through
+// ParentID: members of a team also receive the roles of its ancestors, and
+// admins of a team administer its descendants too.
+type Team struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OrgID    primitive.ObjectID `bson:"org_id,omitempty" json:"org_id,omitempty"`
+	Name     string             `bson:"name" json:"name" validate:"required"`
+	ParentID primitive.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+	// Roles are granted to every member of the team and its descendants.
+	Roles []string `bson:"roles" json:"roles"`
+	// AssignableRoles are the roles team admins may hand out to individual
+	// members. A child team can only assign roles its parent can assign.
+	AssignableRoles []string  `bson:"assignable_roles" json:"assignable_roles"`
+	CreatedAt       time.Time `bson:"created_at" json:"created_at"`
+}
+
+// TeamMembership is a user's membership of a team together with the roles
+// a team admin assigned to them.
+type TeamMembership struct {
+	TeamID primitive.ObjectID `bson:"team_id" json:"team_id"`
+	Roles  []string           `bson:"roles" json:"roles"`
+	Admin  bool               `bson:"admin" json:"admin"`
+}
+
+type TeamRequest struct {
+	Name            string   `json:"name" validate:"required"`
+	ParentID        string   `json:"parent_id"`
+	Roles           []string `json:"roles"`
+	AssignableRoles []string `json:"assignable_roles"`
+}
+
+type TeamMemberRequest struct {
+	Roles []string `json:"roles"`
+	Admin bool     `json:"admin"`
+}
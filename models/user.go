@@ -6,16 +6,112 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// User is a stored user. It is never returned as is; responses use one of
+// the views in user_view.go.
 type User struct {
-	ID             primitive.ObjectID `bson:"_id,omitempty"`
-	Username       string             `json:"username" validate:"required,min=3,max=32"`
-	Password       string             `json:"password" validate:"required,min=6"`
-	Email          string             `bson:"email" validate:"required,email"`
-	Verified       bool               `bson:"verified"`
-	VerifiedAt     time.Time          `bson:"verified_at,omitempty"`
-	LastLogin      time.Time          `bson:"last_login,omitempty"`
-	LastLoginIP    string             `bson:"last_login_ip,omitempty"`
-	LastLoginAgent string             `bson:"last_login_agent,omitempty"`
-	Roles          []string           `json:"roles"`
-	AccessGroup    string             `json:"access_group"`
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Username string             `bson:"username" json:"username" validate:"required,min=3,max=32"`
+	// Password is the bcrypt hash of the user's password.
+	Password       string    `bson:"password" json:"-" validate:"required,min=6"`
+	Email          string    `bson:"email" json:"email" validate:"required,email"`
+	Verified       bool      `bson:"verified" json:"verified"`
+	VerifiedAt     time.Time `bson:"verified_at,omitempty" json:"verified_at,omitempty"`
+	LastLogin      time.Time `bson:"last_login,omitempty" json:"last_login,omitempty"`
+	LastLoginIP    string    `bson:"last_login_ip,omitempty" json:"last_login_ip,omitempty"`
+	LastLoginAgent string    `bson:"last_login_agent,omitempty" json:"last_login_agent,omitempty"`
+	Roles          []string  `bson:"roles" json:"roles"`
+	// AccessGroups holds the IDs of the user's global access groups.
+	AccessGroups []primitive.ObjectID `bson:"access_groups" json:"access_groups"`
+	// RoleGrants are roles held only until their expiry.
+	RoleGrants []RoleGrant `bson:"role_grants,omitempty" json:"role_grants,omitempty"`
+	// Orgs are the organizations the user belongs to.
+	Orgs []OrgMembership `bson:"orgs,omitempty" json:"orgs,omitempty"`
+	// Teams are the teams the user belongs to.
+	Teams []TeamMembership `bson:"teams,omitempty" json:"teams,omitempty"`
+	// DeletedAt is set when the user is deleted. Deleted users cannot log
+	// in and are hidden until restored or purged after the retention
+	// period.
+	DeletedAt time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	DeletedBy string    `bson:"deleted_by,omitempty" json:"deleted_by,omitempty"`
+	// DeletionScheduledAt is when the account will be erased, as the user
+	// requested. The request can be cancelled until then.
+	DeletionScheduledAt time.Time `bson:"deletion_scheduled_at,omitempty" json:"deletion_scheduled_at,omitempty"`
+	// ErasedAt is set once the user's personal data was anonymised. Erased
+	// users are deleted and cannot be restored.
+	ErasedAt time.Time `bson:"erased_at,omitempty" json:"erased_at,omitempty"`
+	// PasswordChangeRequired is set for users created with a temporary
+	// password; they must change it before using the API.
+	PasswordChangeRequired bool `bson:"password_change_required,omitempty" json:"password_change_required,omitempty"`
+	// Status blocks the account while suspended or banned; users without
+	// one are active.
+	Status UserStatus `bson:"status,omitempty" json:"status"`
+}
+
+// User states.
+const (
+	UserActive    = "active"
+	UserSuspended = "suspended"
+	UserBanned    = "banned"
+)
+
+// UserStatus is the state of an account with who set it and why. A
+// suspension may expire; a ban lasts until lifted.
+type UserStatus struct {
+	State     string    `bson:"state,omitempty" json:"state"`
+	Reason    string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	By        string    `bson:"by,omitempty" json:"by,omitempty"`
+	Since     time.Time `bson:"since,omitempty" json:"since,omitempty"`
+	ExpiresAt time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+}
+
+// Blocked reports whether the account is suspended or banned at now. A
+// suspension stops blocking as soon as it expires, before the status is
+// reset.
+func (s UserStatus) Blocked(now time.Time) bool {
+	switch s.State {
+	case UserBanned:
+		return true
+	case UserSuspended:
+		return s.ExpiresAt.IsZero() || s.ExpiresAt.After(now)
+	}
+	return false
+}
+
+// SuspendUserRequest suspends or bans a user. Duration limits a
+// suspension; without it the suspension lasts until lifted.
+type SuspendUserRequest struct {
+	State    string `json:"state" validate:"required,oneof=suspended banned"`
+	Reason   string `json:"reason" validate:"required,max=500"`
+	Duration string `json:"duration,omitempty" example:"72h"`
+}
+
+// CreateUserRequest creates a user on behalf of an administrator. With a
+// temporary password the user must change it on first login; without one
+// the user is invited by email to set a password.
+type CreateUserRequest struct {
+	Email        string   `json:"email" validate:"required,email"`
+	Username     string   `json:"username" validate:"required,min=3,max=32"`
+	Roles        []string `json:"roles"`
+	AccessGroups []string `json:"access_groups"`
+	// Verified skips the email verification.
+	Verified          bool   `json:"verified"`
+	TemporaryPassword string `json:"temporary_password,omitempty" validate:"omitempty,min=6"`
+}
+
+// CreateUserResponse identifies the created user and tells whether an
+// invitation was sent.
+type CreateUserResponse struct {
+	ID      string `json:"id"`
+	Invited bool   `json:"invited"`
+}
+
+// UpdateUserRequest replaces a user's username. Passwords are changed with
+// a ChangePasswordRequest.
+type UpdateUserRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=32"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=6,nefield=CurrentPassword"`
 }
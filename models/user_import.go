@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// User import job statuses.
+const (
+	UserImportRunning   = "running"
+	UserImportCompleted = "completed"
+	UserImportFailed    = "failed"
+)
+
+// UserImportOptions controls a bulk user import. Roles and AccessGroups
+// are assigned to the rows that name none of their own.
+type UserImportOptions struct {
+	Format string `bson:"format" json:"format"`
+	// DryRun validates every row without writing anything.
+	DryRun bool `bson:"dry_run" json:"dry_run"`
+	// Upsert updates the users that already exist instead of reporting them.
+	Upsert       bool     `bson:"upsert" json:"upsert"`
+	Verified     bool     `bson:"verified" json:"verified"`
+	Roles        []string `bson:"roles,omitempty" json:"roles,omitempty"`
+	AccessGroups []string `bson:"access_groups,omitempty" json:"access_groups,omitempty"`
+}
+
+// UserImportReport counts the rows of an import by outcome and lists the
+// errors of the rows that failed. In a dry run the counts are those the
+// import would reach.
+type UserImportReport struct {
+	Total   int               `bson:"total" json:"total"`
+	Created int               `bson:"created" json:"created"`
+	Updated int               `bson:"updated" json:"updated"`
+	Failed  int               `bson:"failed" json:"failed"`
+	Errors  []UserImportError `bson:"errors" json:"errors"`
+}
+
+// UserImportError reports why a row was not imported, keyed by field.
+type UserImportError struct {
+	Line   int               `bson:"line" json:"line"`
+	Email  string            `bson:"email,omitempty" json:"email,omitempty"`
+	Errors map[string]string `bson:"errors" json:"errors"`
+}
+
+// UserImportJob is a bulk user import running in the background.
+// Processed counts the rows handled so far; the report is complete once
+// the job is.
+type UserImportJob struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OrgID      primitive.ObjectID `bson:"org_id,omitempty" json:"org_id,omitempty"`
+	Status     string             `bson:"status" json:"status"`
+	Options    UserImportOptions  `bson:"options" json:"options"`
+	Processed  int                `bson:"processed" json:"processed"`
+	Report     UserImportReport   `bson:"report" json:"report"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedBy  string             `bson:"created_by" json:"created_by"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	FinishedAt time.Time          `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
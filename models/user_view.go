@@ -0,0 +1,196 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Users are never returned as stored: the views below choose the fields
+// each audience may see, and never include the password hash. Unset
+// dates are left out.
+
+// UserListItem is the list view of a user, shown in user and member
+// listings. Inside an organization the roles and access groups are those
+// of the user's membership.
+type UserListItem struct {
+	ID           primitive.ObjectID   `json:"id"`
+	Username     string               `json:"username"`
+	Email        string               `json:"email"`
+	Verified     bool                 `json:"verified"`
+	State        string               `json:"state" enums:"active,suspended,banned"`
+	Roles        []string             `json:"roles"`
+	AccessGroups []primitive.ObjectID `json:"access_groups"`
+	CreatedAt    time.Time            `json:"created_at"`
+	LastLogin    *time.Time           `json:"last_login,omitempty"`
+	DeletedAt    *time.Time           `json:"deleted_at,omitempty"`
+}
+
+// UserProfile is the self view of a user, shown to the user themselves.
+// Who set the account's status is left out.
+type UserProfile struct {
+	UserListItem
+	VerifiedAt             *time.Time       `json:"verified_at,omitempty"`
+	RoleGrants             []RoleGrant      `json:"role_grants"`
+	Orgs                   []OrgMembership  `json:"orgs"`
+	Teams                  []TeamMembership `json:"teams"`
+	Status                 *UserStatus      `json:"status,omitempty"`
+	PasswordChangeRequired bool             `json:"password_change_required"`
+	DeletionScheduledAt    *time.Time       `json:"deletion_scheduled_at,omitempty"`
+}
+
+// UserAdminView is the admin view of a user, shown in listings to callers
+// allowed to see sensitive fields: where the user last logged in from, and
+// who deleted or suspended them. Inside an organization the memberships of
+// other organizations are left out.
+type UserAdminView struct {
+	UserProfile
+	LastLoginIP    string `json:"last_login_ip,omitempty"`
+	LastLoginAgent string `json:"last_login_agent,omitempty"`
+	DeletedBy      string `json:"deleted_by,omitempty"`
+}
+
+// NewUserListItem returns the list view of the user inside org, or
+// globally when org is zero.
+func NewUserListItem(user User, org primitive.ObjectID) UserListItem {
+	item := UserListItem{
+		ID:           user.ID,
+		Username:     user.Username,
+		Email:        user.Email,
+		Verified:     user.Verified,
+		State:        UserActive,
+		Roles:        nonNil(user.Roles),
+		AccessGroups: nonNil(user.AccessGroups),
+		CreatedAt:    user.ID.Timestamp(),
+		LastLogin:    optionalTime(user.LastLogin),
+		DeletedAt:    optionalTime(user.DeletedAt),
+	}
+	if user.Status.Blocked(time.Now()) {
+		item.State = user.Status.State
+	}
+	if !org.IsZero() {
+		item.Roles, item.AccessGroups = []string{}, []primitive.ObjectID{}
+		for _, membership := range user.Orgs {
+			if membership.OrgID == org {
+				item.Roles, item.AccessGroups = nonNil(membership.Roles), nonNil(membership.AccessGroups)
+			}
+		}
+	}
+	return item
+}
+
+// NewUserProfile returns the self view of the user.
+func NewUserProfile(user User) UserProfile {
+	profile := newUserProfile(user, primitive.NilObjectID)
+	if profile.Status != nil {
+		profile.Status.By = ""
+	}
+	return profile
+}
+
+// NewUserAdminView returns the admin view of the user inside org, or
+// globally when org is zero.
+func NewUserAdminView(user User, org primitive.ObjectID) UserAdminView {
+	return UserAdminView{
+		UserProfile:    newUserProfile(user, org),
+		LastLoginIP:    user.LastLoginIP,
+		LastLoginAgent: user.LastLoginAgent,
+		DeletedBy:      user.DeletedBy,
+	}
+}
+
+func newUserProfile(user User, org primitive.ObjectID) UserProfile {
+	profile := UserProfile{
+		UserListItem:           NewUserListItem(user, org),
+		VerifiedAt:             optionalTime(user.VerifiedAt),
+		RoleGrants:             nonNil(user.RoleGrants),
+		Orgs:                   nonNil(user.Orgs),
+		Teams:                  nonNil(user.Teams),
+		PasswordChangeRequired: user.PasswordChangeRequired,
+		DeletionScheduledAt:    optionalTime(user.DeletionScheduledAt),
+	}
+	if user.Status.State != "" {
+		status := user.Status
+		profile.Status = &status
+	}
+	if !org.IsZero() {
+		profile.Orgs = []OrgMembership{}
+		for _, membership := range user.Orgs {
+			if membership.OrgID == org {
+				profile.Orgs = append(profile.Orgs, membership)
+			}
+		}
+	}
+	return profile
+}
+
+// SelectFields returns the views as JSON objects keeping only their id and
+// the named fields, those left out of a view being left out too. It fails
+// with the names the views do not have.
+func SelectFields[T any](views []T, names []string) ([]map[string]json.RawMessage, []string, error) {
+	known := make(map[string]bool)
+	jsonNames(reflect.TypeOf((*T)(nil)).Elem(), known)
+	var unknown []string
+	for _, name := range names {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, unknown, nil
+	}
+
+	selected := make([]map[string]json.RawMessage, 0, len(views))
+	for _, view := range views {
+		encoded, err := json.Marshal(view)
+		if err != nil {
+			return nil, nil, err
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(encoded, &fields); err != nil {
+			return nil, nil, err
+		}
+		kept := map[string]json.RawMessage{"id": fields["id"]}
+		for _, name := range names {
+			if value, exists := fields[name]; exists {
+				kept[name] = value
+			}
+		}
+		selected = append(selected, kept)
+	}
+	return selected, nil, nil
+}
+
+// jsonNames adds to names the JSON names of the fields of the struct type,
+// those of embedded structs included.
+func jsonNames(t reflect.Type, names map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" {
+			jsonNames(field.Type, names)
+			continue
+		}
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// nonNil returns an empty slice for nil, so that lists are never null.
+func nonNil[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSelectFields(t *testing.T) {
+	user := User{
+		ID:       primitive.NewObjectID(),
+		Username: "bob",
+		Email:    "bob@example.com",
+		Roles:    []string{"user"},
+		Status:   UserStatus{State: UserBanned},
+	}
+	list := []UserListItem{NewUserListItem(user, primitive.NilObjectID)}
+	admin := []UserAdminView{NewUserAdminView(user, primitive.NilObjectID)}
+
+	tests := []struct {
+		name  string
+		views interface{}
+		names []string
+		// want is the expected JSON of the views, empty when the names
+		// are not all known
+		want    string
+		unknown string
+	}{
+		{name: "list view", views: list, names: []string{"email", "roles"}, want: `[{"email":"bob@example.com","id":"` + user.ID.Hex() + `","roles":["user"]}]`},
+		{name: "state left out", views: list, names: []string{"email"}, want: `[{"email":"bob@example.com","id":"` + user.ID.Hex() + `"}]`},
+		{name: "unset field left out", views: list, names: []string{"last_login"}, want: `[{"id":"` + user.ID.Hex() + `"}]`},
+		{name: "embedded fields", views: admin, names: []string{"username", "teams"}, want: `[{"id":"` + user.ID.Hex() + `","teams":[],"username":"bob"}]`},
+		{name: "admin field of list view", views: list, names: []string{"email", "status", "orgs"}, unknown: "status, orgs"},
+		{name: "password", views: admin, names: []string{"password"}, unknown: "password"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var selected []map[string]json.RawMessage
+			var unknown []string
+			var err error
+			switch views := test.views.(type) {
+			case []UserListItem:
+				selected, unknown, err = SelectFields(views, test.names)
+			case []UserAdminView:
+				selected, unknown, err = SelectFields(views, test.names)
+			}
+			if err != nil {
+				t.Fatalf("SelectFields() error = %v", err)
+			}
+			if got := strings.Join(unknown, ", "); got != test.unknown {
+				t.Fatalf("SelectFields() unknown = %q, want %q", got, test.unknown)
+			}
+			if test.want == "" {
+				return
+			}
+			encoded, err := json.Marshal(selected)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if string(encoded) != test.want {
+				t.Errorf("SelectFields() = %s, want %s", encoded, test.want)
+			}
+		})
+	}
+}
+
+func TestNewUserListItemState(t *testing.T) {
+	user := User{ID: primitive.NewObjectID(), Status: UserStatus{State: UserSuspended, ExpiresAt: time.Now().Add(-time.Hour)}}
+	if state := NewUserListItem(user, primitive.NilObjectID).State; state != UserActive {
+		t.Errorf("state of an expired suspension = %q, want %q", state, UserActive)
+	}
+}
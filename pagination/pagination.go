@@ -0,0 +1,306 @@
+// Package pagination pages through collections by keyset: each page starts
+// right after the sort key of the previous page's last document, so pages
+// stay fast and consistent however deep they go and however the
+// collection changes in between. Cursors are opaque to clients.
+package pagination
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Ways of counting the documents matching the filter.
+const (
+	CountExact    = "exact"
+	CountEstimate = "estimate"
+	CountNone     = "none"
+)
+
+const (
+	DefaultLimit = 10
+	MaxLimit     = 100
+	// estimateCap bounds the count of a filtered estimate.
+	estimateCap = 10000
+)
+
+// ErrInvalidCursor is returned for cursors that were not issued for the
+// requested sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Request is a parsed page request.
+type Request struct {
+	Cursor string
+	Limit  int
+	Count  string
+}
+
+// Page is one page of documents. Next and Prev are empty when there is no
+// page in that direction; TotalCount is nil when not counted.
+type Page[T any] struct {
+	Items      []T
+	Next       string
+	Prev       string
+	TotalCount *int64
+	Estimated  bool
+}
+
+// Requested reports whether the query asks for cursor pagination, which it
+// does by carrying a cursor parameter, empty for the first page.
+func Requested(values url.Values) bool {
+	_, requested := values["cursor"]
+	return requested
+}
+
+// Parse reads the cursor, limit and count parameters. Invalid parameters
+// are reported keyed by parameter name.
+func Parse(values url.Values) (Request, map[string]string) {
+	request := Request{Cursor: values.Get("cursor"), Limit: DefaultLimit, Count: CountNone}
+	validationErrors := make(map[string]string)
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			validationErrors["limit"] = "must be between 1 and " + strconv.Itoa(MaxLimit)
+		}
+		request.Limit = limit
+	}
+	if value := values.Get("count"); value != "" {
+		if value != CountExact && value != CountEstimate && value != CountNone {
+			validationErrors["count"] = "must be exact, estimate or none"
+		}
+		request.Count = value
+	}
+	if _, err := decode(request.Cursor); request.Cursor != "" && err != nil {
+		validationErrors["cursor"] = "is not a cursor returned by this listing"
+	}
+
+	if len(validationErrors) > 0 {
+		return request, validationErrors
+	}
+	return request, nil
+}
+
+// cursor is the decoded form of a cursor: the sort key of the document to
+// continue from, and the sort order it belongs to.
+type cursor struct {
+	Order    string `bson:"o"`
+	Values   bson.A `bson:"v"`
+	Backward bool   `bson:"b"`
+}
+
+func encode(c cursor) string {
+	data, err := bson.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decode(value string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := bson.Unmarshal(data, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// orderKey identifies a sort order, so that a cursor is not reused with
+// another.
+func orderKey(order bson.D) string {
+	parts := make([]string, 0, len(order))
+	for _, field := range order {
+		parts = append(parts, field.Key+":"+strconv.Itoa(direction(field)))
+	}
+	return strings.Join(parts, ",")
+}
+
+func direction(field bson.E) int {
+	if value, ok := field.Value.(int); ok && value < 0 {
+		return -1
+	}
+	return 1
+}
+
+// Find returns the page of documents matching filter in the given order,
+// which must end with a unique field such as _id. A non-nil projection is
+// extended with the sort fields.
+func Find[T any](ctx context.Context, collection *mongo.Collection, filter bson.M, order bson.D, projection bson.M, request Request) (Page[T], error) {
+	var page Page[T]
+
+	var from cursor
+	if request.Cursor != "" {
+		var err error
+		from, err = decode(request.Cursor)
+		if err != nil || from.Order != orderKey(order) || len(from.Values) != len(order) {
+			return page, ErrInvalidCursor
+		}
+	}
+
+	// Going backward reads the order reversed, then restores it
+	query := order
+	if from.Backward {
+		query = make(bson.D, len(order))
+		for i, field := range order {
+			query[i] = bson.E{Key: field.Key, Value: -direction(field)}
+		}
+	}
+	find := filter
+	if request.Cursor != "" {
+		find = bson.M{"$and": []bson.M{filter, after(query, from.Values)}}
+	}
+
+	findOptions := options.Find().SetSort(query).SetLimit(int64(request.Limit) + 1)
+	if projection != nil {
+		extended := bson.M{}
+		for key, value := range projection {
+			extended[key] = value
+		}
+		for _, field := range order {
+			extended[field.Key] = 1
+		}
+		findOptions.SetProjection(extended)
+	}
+
+	results, err := collection.Find(ctx, find, findOptions)
+	if err != nil {
+		return page, err
+	}
+	defer results.Close(ctx)
+
+	var keys []bson.A
+	for results.Next(ctx) {
+		var item T
+		if err := results.Decode(&item); err != nil {
+			return page, err
+		}
+		key, err := sortKey(results.Current, order)
+		if err != nil {
+			return page, err
+		}
+		page.Items = append(page.Items, item)
+		keys = append(keys, key)
+	}
+	if err := results.Err(); err != nil {
+		return page, err
+	}
+
+	more := len(page.Items) > request.Limit
+	if more {
+		page.Items = page.Items[:request.Limit]
+		keys = keys[:request.Limit]
+	}
+	if from.Backward {
+		reverse(page.Items)
+		reverse(keys)
+	}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+
+	// Going forward there is a previous page when we came from one, and a
+	// next one when more documents were found; and the other way around
+	if len(keys) > 0 {
+		first, last := keys[0], keys[len(keys)-1]
+		hasPrev, hasNext := request.Cursor != "", more
+		if from.Backward {
+			hasPrev, hasNext = more, true
+		}
+		if hasPrev {
+			page.Prev = encode(cursor{Order: orderKey(order), Values: first, Backward: true})
+		}
+		if hasNext {
+			page.Next = encode(cursor{Order: orderKey(order), Values: last})
+		}
+	}
+
+	page.TotalCount, page.Estimated, err = count(ctx, collection, filter, request.Count)
+	return page, err
+}
+
+// after matches the documents following values in order: those greater
+// on the first field, or equal on it and greater on the next, and so on.
+// Missing and null values sort before any other.
+func after(order bson.D, values bson.A) bson.M {
+	var branches []bson.M
+	equal := bson.M{}
+	for i, field := range order {
+		value := values[i]
+		var beyond bson.M
+		switch {
+		case direction(field) > 0 && value == nil:
+			beyond = bson.M{field.Key: bson.M{"$ne": nil}}
+		case direction(field) > 0:
+			beyond = bson.M{field.Key: bson.M{"$gt": value}}
+		case value != nil:
+			beyond = bson.M{"$or": []bson.M{{field.Key: bson.M{"$lt": value}}, {field.Key: nil}}}
+		}
+		if beyond != nil {
+			branch := bson.M{}
+			for key, value := range equal {
+				branch[key] = value
+			}
+			branches = append(branches, bson.M{"$and": []bson.M{branch, beyond}})
+		}
+		equal[field.Key] = value
+	}
+	if len(branches) == 0 {
+		// Nothing sorts after the last possible key
+		return bson.M{"_id": bson.M{"$exists": false}}
+	}
+	return bson.M{"$or": branches}
+}
+
+// sortKey reads the values of the sort fields from a document.
+func sortKey(document bson.Raw, order bson.D) (bson.A, error) {
+	key := make(bson.A, 0, len(order))
+	for _, field := range order {
+		raw, err := document.LookupErr(strings.Split(field.Key, ".")...)
+		if err != nil {
+			key = append(key, nil)
+			continue
+		}
+		var value interface{}
+		if err := raw.Unmarshal(&value); err != nil {
+			return nil, err
+		}
+		key = append(key, value)
+	}
+	return key, nil
+}
+
+// count counts the documents matching filter according to mode, and
+// reports whether the count is an estimate. Estimates of filtered listings
+// stop counting at estimateCap, the count being exact below it.
+func count(ctx context.Context, collection *mongo.Collection, filter bson.M, mode string) (*int64, bool, error) {
+	switch mode {
+	case CountExact:
+		total, err := collection.CountDocuments(ctx, filter)
+		return &total, false, err
+	case CountEstimate:
+		if len(filter) == 0 {
+			total, err := collection.EstimatedDocumentCount(ctx)
+			return &total, true, err
+		}
+		total, err := collection.CountDocuments(ctx, filter, options.Count().SetLimit(estimateCap))
+		return &total, total >= estimateCap, err
+	}
+	return nil, false, nil
+}
+
+func reverse[T any](items []T) {
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+}
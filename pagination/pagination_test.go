@@ -0,0 +1,234 @@
+package pagination
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParse(t *testing.T) {
+	valid := encode(cursor{Order: "_id:1", Values: bson.A{int32(1)}})
+
+	tests := []struct {
+		query string
+		want  Request
+		// errors are the parameters expected to be invalid
+		errors []string
+	}{
+		{query: "cursor=", want: Request{Limit: DefaultLimit, Count: CountNone}},
+		{query: "cursor=" + valid + "&limit=50&count=estimate", want: Request{Cursor: valid, Limit: 50, Count: CountEstimate}},
+		{query: "cursor=&limit=0", errors: []string{"limit"}},
+		{query: "cursor=&limit=101&count=all", errors: []string{"limit", "count"}},
+		{query: "cursor=not+a+cursor", errors: []string{"cursor"}},
+		{query: "cursor=bm90IGJzb24", errors: []string{"cursor"}},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			values, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatalf("url.ParseQuery() error = %v", err)
+			}
+			if !Requested(values) {
+				t.Errorf("Requested() = false")
+			}
+			request, errors := Parse(values)
+			if test.errors != nil {
+				if len(errors) != len(test.errors) {
+					t.Fatalf("Parse() errors = %v, want errors for %v", errors, test.errors)
+				}
+				for _, name := range test.errors {
+					if _, exists := errors[name]; !exists {
+						t.Errorf("Parse() errors = %v, want an error for %s", errors, name)
+					}
+				}
+				return
+			}
+			if errors != nil {
+				t.Fatalf("Parse() errors = %v", errors)
+			}
+			if request != test.want {
+				t.Errorf("Parse() = %+v, want %+v", request, test.want)
+			}
+		})
+	}
+
+	if Requested(url.Values{"page": {"2"}}) {
+		t.Error("Requested() = true without a cursor parameter")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	want := cursor{Order: "last_login:-1,_id:1", Values: bson.A{nil, "abc"}, Backward: true}
+	got, err := decode(encode(want))
+	if err != nil {
+		t.Fatalf("decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decode(encode(%+v)) = %+v", want, got)
+	}
+
+	for _, value := range []string{"%%%", "YWJj", ""} {
+		if _, err := decode(value); err != ErrInvalidCursor {
+			t.Errorf("decode(%q) error = %v, want ErrInvalidCursor", value, err)
+		}
+	}
+}
+
+func TestOrderKey(t *testing.T) {
+	order := bson.D{{Key: "last_login", Value: -1}, {Key: "username", Value: 1}, {Key: "_id", Value: 1}}
+	if got, want := orderKey(order), "last_login:-1,username:1,_id:1"; got != want {
+		t.Errorf("orderKey() = %q, want %q", got, want)
+	}
+}
+
+func TestSortKey(t *testing.T) {
+	document, err := bson.Marshal(bson.M{"_id": int32(7), "status": bson.M{"state": "banned"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := bson.D{{Key: "status.state", Value: 1}, {Key: "last_login", Value: -1}, {Key: "_id", Value: 1}}
+	key, err := sortKey(document, order)
+	if err != nil {
+		t.Fatalf("sortKey() error = %v", err)
+	}
+	if want := (bson.A{"banned", nil, int32(7)}); !reflect.DeepEqual(key, want) {
+		t.Errorf("sortKey() = %v, want %v", key, want)
+	}
+}
+
+// TestAfter checks that, from every document of a listing sorted in some
+// order, after matches exactly the documents listed after it.
+func TestAfter(t *testing.T) {
+	documents := []bson.M{
+		{"_id": 1, "name": "b", "login": 3},
+		{"_id": 2, "name": "a"},
+		{"_id": 3, "name": "b", "login": nil},
+		{"_id": 4, "name": "a", "login": 5},
+		{"_id": 5, "name": "c", "login": 3},
+		{"_id": 6, "login": 1},
+	}
+
+	orders := []bson.D{
+		{{Key: "_id", Value: 1}},
+		{{Key: "_id", Value: -1}},
+		{{Key: "name", Value: 1}, {Key: "_id", Value: 1}},
+		{{Key: "login", Value: -1}, {Key: "_id", Value: 1}},
+		{{Key: "name", Value: -1}, {Key: "login", Value: 1}, {Key: "_id", Value: -1}},
+	}
+	for _, order := range orders {
+		t.Run(orderKey(order), func(t *testing.T) {
+			sorted := append([]bson.M{}, documents...)
+			sort.Slice(sorted, func(i, j int) bool { return compareKeys(sorted[i], sorted[j], order) < 0 })
+
+			for i, from := range sorted {
+				values := make(bson.A, len(order))
+				for j, field := range order {
+					values[j] = from[field.Key]
+				}
+				filter := after(order, values)
+
+				var got, want []interface{}
+				for _, document := range sorted {
+					if matches(document, filter) {
+						got = append(got, document["_id"])
+					}
+				}
+				for _, document := range sorted[i+1:] {
+					want = append(want, document["_id"])
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("after(%v) matches %v, want %v", values, got, want)
+				}
+			}
+		})
+	}
+}
+
+// compareKeys compares two documents in order. Missing and null values
+// sort first, as in Mongo.
+func compareKeys(a, b bson.M, order bson.D) int {
+	for _, field := range order {
+		if c := compare(a[field.Key], b[field.Key]) * direction(field); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compare(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	switch a := a.(type) {
+	case int:
+		return a - b.(int)
+	case string:
+		switch {
+		case a < b.(string):
+			return -1
+		case a > b.(string):
+			return 1
+		}
+		return 0
+	}
+	panic(fmt.Sprintf("cannot compare %T", a))
+}
+
+// matches evaluates the subset of Mongo filters after produces.
+func matches(document bson.M, filter bson.M) bool {
+	for key, condition := range filter {
+		switch key {
+		case "$or":
+			any := false
+			for _, branch := range condition.([]bson.M) {
+				any = any || matches(document, branch)
+			}
+			if !any {
+				return false
+			}
+		case "$and":
+			for _, branch := range condition.([]bson.M) {
+				if !matches(document, branch) {
+					return false
+				}
+			}
+		default:
+			value, exists := document[key]
+			operators, isOperator := condition.(bson.M)
+			if !isOperator {
+				if compare(value, condition) != 0 {
+					return false
+				}
+				continue
+			}
+			for operator, operand := range operators {
+				var ok bool
+				switch operator {
+				case "$gt":
+					ok = value != nil && compare(value, operand) > 0
+				case "$lt":
+					ok = value != nil && compare(value, operand) < 0
+				case "$ne":
+					ok = compare(value, operand) != 0
+				case "$exists":
+					ok = exists == operand.(bool)
+				default:
+					panic("unsupported operator " + operator)
+				}
+				if !ok {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
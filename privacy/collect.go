@@ -0,0 +1,124 @@
+package privacy
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// section is a file of a data export archive.
+type section struct {
+	name string
+	data interface{}
+}
+
+// source is a collection holding data about users, with the filter
+// selecting a user's documents and the fields left out of exports.
+type source struct {
+	name       string
+	collection string
+	filter     func(user primitive.ObjectID, email string) bson.M
+	omit       []string
+}
+
+// sources lists what an export collects besides the profile. Logins are
+// recorded on the profile; tokens are not stored.
+var sources = []source{
+	{
+		name:       "role_requests",
+		collection: "role_requests",
+		filter: func(user primitive.ObjectID, _ string) bson.M {
+			return bson.M{"user_id": user}
+		},
+	},
+	{
+		name:       "access_reviews",
+		collection: "access_review_items",
+		filter: func(user primitive.ObjectID, _ string) bson.M {
+			return bson.M{"user_id": user}
+		},
+	},
+	{
+		name:       "relations",
+		collection: "relation_tuples",
+		filter: func(user primitive.ObjectID, _ string) bson.M {
+			ref := "user:" + user.Hex()
+			return bson.M{"$or": []bson.M{{"object": ref}, {"subject": ref}}}
+		},
+	},
+	{
+		name:       "user_imports",
+		collection: "user_imports",
+		filter: func(_ primitive.ObjectID, email string) bson.M {
+			return bson.M{"created_by": email}
+		},
+		omit: []string{"report.errors"},
+	},
+	{
+		name:       "data_exports",
+		collection: "data_exports",
+		filter: func(user primitive.ObjectID, _ string) bson.M {
+			return bson.M{"user_id": user}
+		},
+	},
+}
+
+// collect reads everything held about the user, the password hash
+// excepted. Organizations and teams are included for the names of the
+// user's memberships.
+func collect(ctx context.Context, userID primitive.ObjectID) ([]section, error) {
+	var profile bson.M
+	projection := options.FindOne().SetProjection(bson.M{"password": 0})
+	if err := db().Collection("users").FindOne(ctx, bson.M{"_id": userID}, projection).Decode(&profile); err != nil {
+		return nil, err
+	}
+	email, _ := profile["email"].(string)
+	sections := []section{{name: "profile", data: profile}}
+
+	var orgIDs, teamIDs []interface{}
+	if orgs, ok := profile["orgs"].(bson.A); ok {
+		for _, membership := range orgs {
+			if membership, ok := membership.(bson.M); ok {
+				orgIDs = append(orgIDs, membership["org_id"])
+			}
+		}
+	}
+	if teams, ok := profile["teams"].(bson.A); ok {
+		for _, membership := range teams {
+			if membership, ok := membership.(bson.M); ok {
+				teamIDs = append(teamIDs, membership["team_id"])
+			}
+		}
+	}
+	memberships := []source{
+		{name: "organizations", collection: "organizations", filter: func(primitive.ObjectID, string) bson.M {
+			return bson.M{"_id": bson.M{"$in": append(bson.A{}, orgIDs...)}}
+		}},
+		{name: "teams", collection: "teams", filter: func(primitive.ObjectID, string) bson.M {
+			return bson.M{"_id": bson.M{"$in": append(bson.A{}, teamIDs...)}}
+		}},
+	}
+
+	for _, source := range append(memberships, sources...) {
+		findOptions := options.Find()
+		if len(source.omit) > 0 {
+			omitted := bson.M{}
+			for _, field := range source.omit {
+				omitted[field] = 0
+			}
+			findOptions.SetProjection(omitted)
+		}
+		cursor, err := db().Collection(source.collection).Find(ctx, source.filter(userID, email), findOptions)
+		if err != nil {
+			return nil, err
+		}
+		documents := []bson.M{}
+		if err := cursor.All(ctx, &documents); err != nil {
+			return nil, err
+		}
+		sections = append(sections, section{name: source.name, data: documents})
+	}
+	return sections, nil
+}
@@ -0,0 +1,178 @@
+package privacy
+
+import (
+	"context"
+	"time"
+	"unified-go-backend/authz"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// reference is a field holding the email address of a user, who may be
+// the subject of the record or have acted on it.
+type reference struct {
+	collection string
+	// match is the path of the address in queries
+	match string
+	// set is the path of the address in updates; inside an array the
+	// element is identified by "e", matched by element
+	set     string
+	element string
+}
+
+// references lists the records kept when an account is erased, with the
+// user's address replaced by a pseudonym so that they still tell apart the
+// actions of different users.
+var references = []reference{
+	{collection: "users", match: "deleted_by", set: "deleted_by"},
+	{collection: "users", match: "status.by", set: "status.by"},
+	{collection: "users", match: "role_grants.granted_by", set: "role_grants.$[e].granted_by", element: "e.granted_by"},
+	{collection: "role_requests", match: "email", set: "email"},
+	{collection: "role_requests", match: "decided_by", set: "decided_by"},
+	{collection: "access_reviews", match: "created_by", set: "created_by"},
+	{collection: "access_reviews", match: "reviewers", set: "reviewers.$[e]", element: "e"},
+	{collection: "access_review_items", match: "email", set: "email"},
+	{collection: "access_review_items", match: "reviewer", set: "reviewer"},
+	{collection: "access_review_items", match: "decided_by", set: "decided_by"},
+	{collection: "user_imports", match: "created_by", set: "created_by"},
+	{collection: "user_imports", match: "report.errors.email", set: "report.errors.$[e].email", element: "e.email"},
+}
+
+// Pseudonym is the address replacing the user's once erased.
+func Pseudonym(user primitive.ObjectID) string {
+	return "erased-" + user.Hex() + "@users.invalid"
+}
+
+// RequestDeletion schedules the erasure of the user's account after the
+// cooling-off period, and returns when it will happen. A pending request is
+// left unchanged.
+func RequestDeletion(ctx context.Context, user models.User, coolingOff time.Duration) (time.Time, error) {
+	if !user.DeletionScheduledAt.IsZero() {
+		return user.DeletionScheduledAt, nil
+	}
+	scheduledAt := time.Now().Add(coolingOff)
+	_, err := db().Collection("users").UpdateOne(ctx,
+		bson.M{"_id": user.ID, "deletion_scheduled_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"deletion_scheduled_at": scheduledAt}},
+	)
+	return scheduledAt, err
+}
+
+// CancelDeletion cancels the user's pending deletion request. It reports
+// whether there was one.
+func CancelDeletion(ctx context.Context, user primitive.ObjectID) (bool, error) {
+	result, err := db().Collection("users").UpdateOne(ctx,
+		bson.M{"_id": user, "deletion_scheduled_at": bson.M{"$exists": true}, "erased_at": bson.M{"$exists": false}},
+		bson.M{"$unset": bson.M{"deletion_scheduled_at": ""}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// EraseDueAccounts erases the accounts whose cooling-off period is over,
+// and returns how many were erased.
+func EraseDueAccounts(ctx context.Context) (int, error) {
+	due := bson.M{"deletion_scheduled_at": bson.M{"$lte": time.Now()}, "erased_at": bson.M{"$exists": false}}
+	cursor, err := db().Collection("users").Find(ctx, due)
+	if err != nil {
+		return 0, err
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return 0, err
+	}
+	for i, user := range users {
+		if err := Erase(ctx, user); err != nil {
+			return i, err
+		}
+	}
+	return len(users), nil
+}
+
+// Erase anonymises the user: the account keeps its ID but loses its
+// personal data and access and is deleted, the user's address is replaced
+// by a pseudonym wherever records refer to it, and the user's relation
+// tuples and data exports are removed. The account itself is marked erased
+// last, so that an interrupted erasure is completed by the next one.
+func Erase(ctx context.Context, user models.User) error {
+	pseudonym := Pseudonym(user.ID)
+
+	for _, ref := range references {
+		updateOptions := options.Update()
+		if ref.element != "" {
+			updateOptions.SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{ref.element: user.Email}}})
+		}
+		_, err := db().Collection(ref.collection).UpdateMany(ctx,
+			bson.M{ref.match: user.Email},
+			bson.M{"$set": bson.M{ref.set: pseudonym}},
+			updateOptions,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Free text written by or about the user may identify them
+	if _, err := db().Collection("role_requests").UpdateMany(ctx,
+		bson.M{"user_id": user.ID},
+		bson.M{"$set": bson.M{"reason": "", "note": ""}},
+	); err != nil {
+		return err
+	}
+
+	if _, err := authz.DeleteTuplesOf(ctx, "user:"+user.ID.Hex()); err != nil {
+		return err
+	}
+	if _, err := deleteExports(ctx, bson.M{"user_id": user.ID}); err != nil {
+		return err
+	}
+	if database.RedisClient != nil {
+		if err := database.RedisClient.Del(ctx, user.Email).Err(); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	deletedAt := user.DeletedAt
+	if deletedAt.IsZero() {
+		deletedAt = now
+	}
+	_, err := db().Collection("users").UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$set": bson.M{
+			"email":         pseudonym,
+			"username":      "erased-" + user.ID.Hex(),
+			"password":      "",
+			"verified":      false,
+			"roles":         []string{},
+			"access_groups": []primitive.ObjectID{},
+			"deleted_at":    deletedAt,
+			"deleted_by":    pseudonym,
+			"erased_at":     now,
+		},
+		"$unset": bson.M{
+			"verified_at":              "",
+			"last_login":               "",
+			"last_login_ip":            "",
+			"last_login_agent":         "",
+			"role_grants":              "",
+			"orgs":                     "",
+			"teams":                    "",
+			"status":                   "",
+			"password_change_required": "",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	authz.InvalidateUsers(ctx, user.ID)
+
+	utils.Logger.Infof("Erased user %s", user.ID.Hex())
+	return nil
+}
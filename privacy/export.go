@@ -0,0 +1,208 @@
+// Package privacy honours data subject requests: it builds archives of
+// everything held about a user, and erases the personal data of accounts
+// whose deletion was requested. Records kept for accountability, such as
+// role requests and access reviews, are preserved with the user replaced
+// by a pseudonym.
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// staleAfter is how long an export can run before it is considered
+// abandoned by a stopped process and started again.
+const staleAfter = time.Hour
+
+// ErrExportNotReady is returned when downloading an archive that is not
+// ready, or no longer available.
+var ErrExportNotReady = errors.New("data export not ready")
+
+func db() *mongo.Database {
+	return database.MongoClient.Database("mdmdb")
+}
+
+func exports() *mongo.Collection {
+	return db().Collection("data_exports")
+}
+
+func archives() (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(db(), options.GridFSBucket().SetName("data_exports"))
+}
+
+// EnsureIndexes creates the indexes used to find a user's exports and the
+// exports to build or expire.
+func EnsureIndexes(ctx context.Context) error {
+	_, err := exports().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "requested_at", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}},
+	})
+	return err
+}
+
+// RequestExport queues an export of the user's data, unless one is
+// already queued or running, in which case that one is returned.
+func RequestExport(ctx context.Context, user models.User) (models.DataExport, error) {
+	export := models.DataExport{
+		ID:          primitive.NewObjectID(),
+		UserID:      user.ID,
+		Status:      models.DataExportPending,
+		RequestedAt: time.Now(),
+	}
+	filter := bson.M{"user_id": user.ID, "status": bson.M{"$in": []string{models.DataExportPending, models.DataExportRunning}}}
+	err := exports().FindOneAndUpdate(ctx, filter,
+		bson.M{"$setOnInsert": export},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&export)
+	return export, err
+}
+
+// FindExport fetches the user's export with the given ID.
+func FindExport(ctx context.Context, id, user primitive.ObjectID) (models.DataExport, error) {
+	var export models.DataExport
+	err := exports().FindOne(ctx, bson.M{"_id": id, "user_id": user}).Decode(&export)
+	return export, err
+}
+
+// OpenArchive opens the archive of a ready export.
+func OpenArchive(export models.DataExport) (io.ReadCloser, error) {
+	if export.Status != models.DataExportReady || !export.ExpiresAt.After(time.Now()) {
+		return nil, ErrExportNotReady
+	}
+	bucket, err := archives()
+	if err != nil {
+		return nil, err
+	}
+	return bucket.OpenDownloadStream(export.FileID)
+}
+
+// BuildExports builds the archives of the queued exports one at a time,
+// each available for ttl once built. Replicas can run it concurrently;
+// each export is claimed by one of them.
+func BuildExports(ctx context.Context, ttl time.Duration) error {
+	for {
+		var export models.DataExport
+		claim := bson.M{"$or": []bson.M{
+			{"status": models.DataExportPending},
+			{"status": models.DataExportRunning, "started_at": bson.M{"$lt": time.Now().Add(-staleAfter)}},
+		}}
+		err := exports().FindOneAndUpdate(ctx, claim,
+			bson.M{"$set": bson.M{"status": models.DataExportRunning, "started_at": time.Now()}},
+			options.FindOneAndUpdate().SetSort(bson.M{"requested_at": 1}).SetReturnDocument(options.After),
+		).Decode(&export)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Failed exports expire too, to be cleaned up
+		update := bson.M{"status": models.DataExportReady, "completed_at": time.Now(), "expires_at": time.Now().Add(ttl)}
+		fileID, size, err := buildArchive(ctx, export)
+		if err != nil {
+			update["status"], update["error"] = models.DataExportFailed, err.Error()
+		} else {
+			update["file_id"], update["size"] = fileID, size
+		}
+		if _, err := exports().UpdateByID(ctx, export.ID, bson.M{"$set": update}); err != nil {
+			return err
+		}
+	}
+}
+
+// DeleteExpiredExports deletes the exports past their expiry together with
+// their archives, and returns how many were deleted.
+func DeleteExpiredExports(ctx context.Context) (int, error) {
+	return deleteExports(ctx, bson.M{"expires_at": bson.M{"$lte": time.Now()}})
+}
+
+func deleteExports(ctx context.Context, filter bson.M) (int, error) {
+	cursor, err := exports().Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	var expired []models.DataExport
+	if err := cursor.All(ctx, &expired); err != nil {
+		return 0, err
+	}
+	bucket, err := archives()
+	if err != nil {
+		return 0, err
+	}
+	for _, export := range expired {
+		if !export.FileID.IsZero() {
+			if err := bucket.DeleteContext(ctx, export.FileID); err != nil && err != gridfs.ErrFileNotFound {
+				return 0, err
+			}
+		}
+		if _, err := exports().DeleteOne(ctx, bson.M{"_id": export.ID}); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
+
+// buildArchive collects the user's data into a zip archive stored in
+// GridFS, and returns its ID and size.
+func buildArchive(ctx context.Context, export models.DataExport) (primitive.ObjectID, int64, error) {
+	sections, err := collect(ctx, export.UserID)
+	if err != nil {
+		return primitive.NilObjectID, 0, err
+	}
+
+	bucket, err := archives()
+	if err != nil {
+		return primitive.NilObjectID, 0, err
+	}
+	upload, err := bucket.OpenUploadStream("data-export-" + export.ID.Hex() + ".zip")
+	if err != nil {
+		return primitive.NilObjectID, 0, err
+	}
+	counter := &countingWriter{w: upload}
+	archive := zip.NewWriter(counter)
+	for _, section := range sections {
+		file, err := archive.Create(section.name + ".json")
+		if err == nil {
+			encoder := json.NewEncoder(file)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(section.data)
+		}
+		if err != nil {
+			upload.Abort()
+			return primitive.NilObjectID, 0, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		upload.Abort()
+		return primitive.NilObjectID, 0, err
+	}
+	if err := upload.Close(); err != nil {
+		return primitive.NilObjectID, 0, err
+	}
+	return upload.FileID.(primitive.ObjectID), counter.n, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
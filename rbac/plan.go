@@ -0,0 +1,448 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"unified-go-backend/authz"
+	"unified-go-backend/database"
+	"unified-go-backend/integrity"
+	"unified-go-backend/models"
+	"unified-go-backend/tenant"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Change kinds and actions.
+const (
+	KindPermission  = "permission"
+	KindRole        = "role"
+	KindAccessGroup = "access_group"
+
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Change is a single difference between a file and the database. Fields
+// lists the fields an update changes.
+type Change struct {
+	Kind   string   `json:"kind"`
+	Name   string   `json:"name"`
+	Action string   `json:"action"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+func (c Change) String() string {
+	if len(c.Fields) > 0 {
+		return fmt.Sprintf("%s %s %s (%s)", c.Action, c.Kind, c.Name, strings.Join(c.Fields, ", "))
+	}
+	return fmt.Sprintf("%s %s %s", c.Action, c.Kind, c.Name)
+}
+
+// Plan lists the changes needed to make the database match a file, in the
+// order they are applied: creations and updates of permissions, roles and
+// access groups first, then deletions in the reverse order.
+type Plan struct {
+	Changes []Change `json:"changes"`
+	desired File
+}
+
+func mdmdb() *mongo.Database {
+	return database.MongoClient.Database("mdmdb")
+}
+
+// Export reads the global permissions, roles and access groups.
+func Export(ctx context.Context) (File, error) {
+	file := File{Permissions: []Permission{}, Roles: []Role{}, AccessGroups: []AccessGroup{}}
+	db := mdmdb()
+
+	var permissions []models.Permission
+	if err := findAll(ctx, db.Collection("permissions"), bson.M{}, &permissions); err != nil {
+		return file, err
+	}
+	for _, permission := range permissions {
+		file.Permissions = append(file.Permissions, Permission{Name: permission.Name, Description: permission.Description})
+	}
+
+	var roles []models.Role
+	if err := findAll(ctx, db.Collection("roles"), tenant.OwnedBy(primitive.NilObjectID), &roles); err != nil {
+		return file, err
+	}
+	for _, role := range roles {
+		file.Roles = append(file.Roles, Role{
+			Name:               role.Name,
+			Permissions:        role.Permissions,
+			Deny:               role.Deny,
+			Parents:            role.Parents,
+			ApproverPermission: role.ApproverPermission,
+		})
+	}
+
+	var groups []models.AccessGroup
+	if err := findAll(ctx, db.Collection("access_groups"), tenant.OwnedBy(primitive.NilObjectID), &groups); err != nil {
+		return file, err
+	}
+	for _, group := range groups {
+		file.AccessGroups = append(file.AccessGroups, AccessGroup{
+			Name:        group.Name,
+			Roles:       group.Roles,
+			Permissions: group.Permissions,
+			Deny:        group.Deny,
+		})
+	}
+	return normalize(file), nil
+}
+
+func findAll(ctx context.Context, collection *mongo.Collection, filter interface{}, results interface{}) error {
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
+
+// Validate checks a file against itself and, unless prune is set, the
+// entries of current it does not mention. It returns errors keyed by entry,
+// or nil when the file is valid.
+func Validate(file, current File, prune bool) map[string]string {
+	errors := make(map[string]string)
+
+	permissions := make(map[string]bool)
+	roles := make(map[string]models.Role)
+	groups := make(map[string]bool)
+	for _, permission := range file.Permissions {
+		name := authz.Canonical(permission.Name)
+		if name == "" {
+			errors["permissions"] = "every permission needs a name"
+		} else if permissions[name] {
+			errors["permissions."+name] = "declared more than once"
+		}
+		permissions[name] = true
+	}
+	for _, role := range file.Roles {
+		if role.Name == "" {
+			errors["roles"] = "every role needs a name"
+		} else if _, exists := roles[role.Name]; exists {
+			errors["roles."+role.Name] = "declared more than once"
+		}
+		roles[role.Name] = models.Role{Name: role.Name, Parents: role.Parents}
+	}
+	for _, group := range file.AccessGroups {
+		if group.Name == "" {
+			errors["access_groups"] = "every access group needs a name"
+		} else if groups[group.Name] {
+			errors["access_groups."+group.Name] = "declared more than once"
+		}
+		groups[group.Name] = true
+	}
+
+	// Entries the file leaves out stay in place unless pruned, and the
+	// permissions required by routes always stay
+	for _, permission := range authz.Catalog() {
+		permissions[permission.Name] = true
+	}
+	if !prune {
+		for _, permission := range current.Permissions {
+			permissions[authz.Canonical(permission.Name)] = true
+		}
+		for _, role := range current.Roles {
+			if _, exists := roles[role.Name]; !exists {
+				roles[role.Name] = models.Role{Name: role.Name, Parents: role.Parents}
+			}
+		}
+	}
+	known := make([]string, 0, len(permissions))
+	for name := range permissions {
+		known = append(known, name)
+	}
+
+	checkPermissions := func(key string, names []string) {
+		var missing []string
+		for _, name := range names {
+			if !covers(authz.Canonical(name), known) {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			errors[key] = "unknown permissions: " + strings.Join(missing, ", ")
+		}
+	}
+	checkRoles := func(key string, names []string) {
+		var missing []string
+		for _, name := range names {
+			if _, exists := roles[name]; !exists {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			errors[key] = "unknown roles: " + strings.Join(missing, ", ")
+		}
+	}
+
+	for _, role := range file.Roles {
+		referenced := append(append([]string{}, role.Permissions...), role.Deny...)
+		if role.ApproverPermission != "" {
+			referenced = append(referenced, role.ApproverPermission)
+		}
+		checkPermissions("roles."+role.Name+".permissions", referenced)
+		checkRoles("roles."+role.Name+".parents", role.Parents)
+		if cycle := authz.FindCycle(roles, role.Name, role.Parents); cycle != nil {
+			errors["roles."+role.Name+".parents"] = "inheritance cycle: " + strings.Join(cycle, " -> ")
+		}
+	}
+	for _, group := range file.AccessGroups {
+		checkPermissions("access_groups."+group.Name+".permissions", append(append([]string{}, group.Permissions...), group.Deny...))
+		checkRoles("access_groups."+group.Name+".roles", group.Roles)
+	}
+
+	if len(errors) == 0 {
+		return nil
+	}
+	return errors
+}
+
+func covers(name string, known []string) bool {
+	if name == "*" {
+		return true
+	}
+	for _, perm := range known {
+		if authz.Matches(name, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff computes the plan turning current into file. Without prune, entries
+// missing from the file are left alone; with prune they are deleted, except
+// for permissions required by routes.
+func Diff(file, current File, prune bool) Plan {
+	file = canonical(normalize(file))
+	current = canonical(normalize(current))
+	plan := Plan{Changes: []Change{}, desired: file}
+
+	currentPermissions := make(map[string]Permission)
+	for _, permission := range current.Permissions {
+		currentPermissions[permission.Name] = permission
+	}
+	desiredPermissions := make(map[string]bool)
+	for _, permission := range file.Permissions {
+		desiredPermissions[permission.Name] = true
+		existing, exists := currentPermissions[permission.Name]
+		switch {
+		case !exists:
+			plan.add(KindPermission, permission.Name, ActionCreate, nil)
+		case existing.Description != permission.Description:
+			plan.add(KindPermission, permission.Name, ActionUpdate, []string{"description"})
+		}
+	}
+
+	currentRoles := make(map[string]Role)
+	for _, role := range current.Roles {
+		currentRoles[role.Name] = role
+	}
+	desiredRoles := make(map[string]bool)
+	for _, role := range file.Roles {
+		desiredRoles[role.Name] = true
+		existing, exists := currentRoles[role.Name]
+		if !exists {
+			plan.add(KindRole, role.Name, ActionCreate, nil)
+		} else if fields := changedFields(existing, role); len(fields) > 0 {
+			plan.add(KindRole, role.Name, ActionUpdate, fields)
+		}
+	}
+
+	currentGroups := make(map[string]AccessGroup)
+	for _, group := range current.AccessGroups {
+		currentGroups[group.Name] = group
+	}
+	desiredGroups := make(map[string]bool)
+	for _, group := range file.AccessGroups {
+		desiredGroups[group.Name] = true
+		existing, exists := currentGroups[group.Name]
+		if !exists {
+			plan.add(KindAccessGroup, group.Name, ActionCreate, nil)
+		} else if fields := changedFields(existing, group); len(fields) > 0 {
+			plan.add(KindAccessGroup, group.Name, ActionUpdate, fields)
+		}
+	}
+
+	if !prune {
+		return plan
+	}
+	for _, group := range current.AccessGroups {
+		if !desiredGroups[group.Name] {
+			plan.add(KindAccessGroup, group.Name, ActionDelete, nil)
+		}
+	}
+	for _, role := range current.Roles {
+		if !desiredRoles[role.Name] {
+			plan.add(KindRole, role.Name, ActionDelete, nil)
+		}
+	}
+	required := make(map[string]bool)
+	for _, permission := range authz.Catalog() {
+		required[permission.Name] = true
+	}
+	for _, permission := range current.Permissions {
+		if !desiredPermissions[permission.Name] && !required[permission.Name] {
+			plan.add(KindPermission, permission.Name, ActionDelete, nil)
+		}
+	}
+	return plan
+}
+
+func (p *Plan) add(kind, name, action string, fields []string) {
+	p.Changes = append(p.Changes, Change{Kind: kind, Name: name, Action: action, Fields: fields})
+}
+
+// canonical rewrites the permission names of a normalized file, which owns
+// its entries, to their canonical form.
+func canonical(file File) File {
+	for i := range file.Permissions {
+		file.Permissions[i].Name = authz.Canonical(file.Permissions[i].Name)
+	}
+	for i := range file.Roles {
+		role := &file.Roles[i]
+		role.Permissions = sortedList(authz.CanonicalList(role.Permissions))
+		role.Deny = sortedList(authz.CanonicalList(role.Deny))
+		role.ApproverPermission = authz.Canonical(role.ApproverPermission)
+	}
+	for i := range file.AccessGroups {
+		group := &file.AccessGroups[i]
+		group.Permissions = sortedList(authz.CanonicalList(group.Permissions))
+		group.Deny = sortedList(authz.CanonicalList(group.Deny))
+	}
+	return file
+}
+
+// changedFields lists the json names of the fields that differ between two
+// entries of the same type.
+func changedFields(current, desired interface{}) []string {
+	a := reflect.ValueOf(current)
+	b := reflect.ValueOf(desired)
+	var fields []string
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		if field.Name == "Name" {
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			fields = append(fields, strings.Split(field.Tag.Get("json"), ",")[0])
+		}
+	}
+	return fields
+}
+
+// Apply makes the database match the file the plan was computed from.
+// Deleting a role or access group that is still referenced fails, leaving
+// the changes before it applied; applying the plan again resumes.
+func Apply(ctx context.Context, plan Plan) error {
+	db := mdmdb()
+	permissions := make(map[string]Permission)
+	for _, permission := range plan.desired.Permissions {
+		permissions[permission.Name] = permission
+	}
+	roles := make(map[string]Role)
+	for _, role := range plan.desired.Roles {
+		roles[role.Name] = role
+	}
+	groups := make(map[string]AccessGroup)
+	for _, group := range plan.desired.AccessGroups {
+		groups[group.Name] = group
+	}
+
+	if len(plan.Changes) > 0 {
+		defer authz.InvalidateAll(ctx)
+	}
+
+	upsert := options.Update().SetUpsert(true)
+	global := tenant.OwnedBy(primitive.NilObjectID)
+	for _, change := range plan.Changes {
+		var err error
+		switch {
+		case change.Kind == KindPermission && change.Action == ActionDelete:
+			_, err = db.Collection("permissions").DeleteOne(ctx, bson.M{"name": change.Name})
+		case change.Kind == KindPermission:
+			permission := permissions[change.Name]
+			set := bson.M{"name": permission.Name, "description": permission.Description}
+			_, err = db.Collection("permissions").UpdateOne(ctx, bson.M{"name": change.Name}, bson.M{"$set": set}, upsert)
+
+		case change.Kind == KindRole && change.Action == ActionDelete:
+			err = deleteRole(ctx, db, change.Name)
+		case change.Kind == KindRole:
+			role := roles[change.Name]
+			set := bson.M{
+				"name":                role.Name,
+				"permissions":         role.Permissions,
+				"deny":                role.Deny,
+				"parents":             role.Parents,
+				"approver_permission": role.ApproverPermission,
+			}
+			_, err = db.Collection("roles").UpdateOne(ctx, tenant.With(global, bson.M{"name": change.Name}), bson.M{"$set": set}, upsert)
+
+		case change.Kind == KindAccessGroup && change.Action == ActionDelete:
+			err = deleteAccessGroup(ctx, db, change.Name)
+		case change.Kind == KindAccessGroup:
+			group := groups[change.Name]
+			set := bson.M{
+				"name":        group.Name,
+				"roles":       group.Roles,
+				"permissions": group.Permissions,
+				"deny":        group.Deny,
+			}
+			_, err = db.Collection("access_groups").UpdateOne(ctx, tenant.With(global, bson.M{"name": change.Name}), bson.M{"$set": set}, upsert)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", change, err)
+		}
+	}
+	return nil
+}
+
+func deleteRole(ctx context.Context, db *mongo.Database, name string) error {
+	var role models.Role
+	err := db.Collection("roles").FindOne(ctx, tenant.With(tenant.OwnedBy(primitive.NilObjectID), bson.M{"name": name})).Decode(&role)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return integrity.DeleteRole(ctx, role, integrity.CascadeBlock, "")
+}
+
+func deleteAccessGroup(ctx context.Context, db *mongo.Database, name string) error {
+	var group models.AccessGroup
+	err := db.Collection("access_groups").FindOne(ctx, tenant.With(tenant.OwnedBy(primitive.NilObjectID), bson.M{"name": name})).Decode(&group)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return integrity.DeleteAccessGroup(ctx, group, integrity.CascadeBlock, primitive.NilObjectID)
+}
+
+// Import validates a file, diffs it against the database and, unless
+// dryRun is set, applies the plan. Validation errors are returned keyed by
+// entry together with a nil error.
+func Import(ctx context.Context, file File, prune, dryRun bool) (Plan, map[string]string, error) {
+	current, err := Export(ctx)
+	if err != nil {
+		return Plan{}, nil, err
+	}
+	if validationErrors := Validate(file, current, prune); validationErrors != nil {
+		return Plan{}, validationErrors, nil
+	}
+	plan := Diff(file, current, prune)
+	if dryRun {
+		return plan, nil, nil
+	}
+	return plan, nil, Apply(ctx, plan)
+}
@@ -0,0 +1,178 @@
+package rbac
+
+import (
+	"strings"
+	"testing"
+	"unified-go-backend/authz"
+)
+
+func init() {
+	// A permission required by a route, which pruning keeps
+	authz.Require("users:read")
+}
+
+func TestDiff(t *testing.T) {
+	current := File{
+		Permissions: []Permission{
+			{Name: "users:read", Description: "Read users"},
+			{Name: "users:update", Description: "Update users"},
+			{Name: "reports:view"},
+		},
+		Roles: []Role{
+			{Name: "user", Permissions: []string{"users:read"}},
+			{Name: "admin", Permissions: []string{"users:update", "users:read"}, Parents: []string{"user"}},
+			{Name: "legacy", Permissions: []string{"reports:view"}},
+		},
+		AccessGroups: []AccessGroup{
+			{Name: "admins", Roles: []string{"admin"}},
+			{Name: "old", Roles: []string{"legacy"}},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		file  File
+		prune bool
+		// changes are the expected changes as their String, in order
+		changes []string
+	}{
+		{name: "unchanged", file: current},
+		{
+			name: "order and legacy names",
+			file: File{
+				Permissions: []Permission{{Name: "update_user", Description: "Update users"}, {Name: "read_user", Description: "Read users"}},
+				Roles:       []Role{{Name: "admin", Permissions: []string{"read_user", "update_user"}, Parents: []string{"user"}}},
+			},
+		},
+		{
+			name: "create and update",
+			file: File{
+				Permissions: []Permission{{Name: "users:read", Description: "List and read users"}, {Name: "users:delete"}},
+				Roles: []Role{
+					{Name: "admin", Permissions: []string{"users:*"}, Parents: []string{"user"}, ApproverPermission: "roles:approve"},
+					{Name: "support", Permissions: []string{"users:read"}},
+				},
+				AccessGroups: []AccessGroup{{Name: "admins", Roles: []string{"admin"}, Deny: []string{"users:delete"}}},
+			},
+			changes: []string{
+				"create permission users:delete",
+				"update permission users:read (description)",
+				"update role admin (permissions, approver_permission)",
+				"create role support",
+				"update access_group admins (deny)",
+			},
+		},
+		{
+			name:  "prune",
+			file:  File{Permissions: []Permission{{Name: "users:update", Description: "Update users"}}, Roles: current.Roles[:2], AccessGroups: current.AccessGroups[:1]},
+			prune: true,
+			changes: []string{
+				"delete access_group old",
+				"delete role legacy",
+				"delete permission reports:view",
+			},
+		},
+		{
+			name:    "prune nothing given",
+			file:    File{},
+			prune:   true,
+			changes: []string{"delete access_group admins", "delete access_group old", "delete role admin", "delete role legacy", "delete role user", "delete permission reports:view", "delete permission users:update"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan := Diff(test.file, current, test.prune)
+			var changes []string
+			for _, change := range plan.Changes {
+				changes = append(changes, change.String())
+			}
+			if got, want := strings.Join(changes, "\n"), strings.Join(test.changes, "\n"); got != want {
+				t.Errorf("Diff() changes:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestDiffLeavesFilesUnchanged(t *testing.T) {
+	file := File{Roles: []Role{{Name: "b", Permissions: []string{"update_user", "read_user"}}, {Name: "a"}}}
+	Diff(file, File{}, false)
+	if file.Roles[0].Name != "b" || file.Roles[0].Permissions[0] != "update_user" {
+		t.Errorf("Diff() changed its input: %+v", file.Roles)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	current := File{
+		Permissions: []Permission{{Name: "reports:view"}},
+		Roles:       []Role{{Name: "user", Permissions: []string{"users:read"}}},
+	}
+
+	tests := []struct {
+		name  string
+		file  File
+		prune bool
+		// errors are the expected errors as "key: message", sorted by key
+		errors []string
+	}{
+		{name: "valid", file: File{Roles: []Role{{Name: "admin", Permissions: []string{"users:*", "reports:view"}, Parents: []string{"user"}}}}},
+		{name: "route permission", file: File{AccessGroups: []AccessGroup{{Name: "readers", Permissions: []string{"read_user"}}}}},
+		{name: "global wildcard", file: File{Roles: []Role{{Name: "root", Permissions: []string{"*"}}}}},
+		{
+			name:   "pruned references",
+			file:   File{Roles: []Role{{Name: "admin", Permissions: []string{"reports:view"}, Parents: []string{"user"}}}},
+			prune:  true,
+			errors: []string{"roles.admin.parents: unknown roles: user", "roles.admin.permissions: unknown permissions: reports:view"},
+		},
+		{
+			name:   "duplicates and missing names",
+			file:   File{Permissions: []Permission{{Name: "a:b"}, {Name: "a:b"}, {}}, Roles: []Role{{Name: "x"}, {Name: "x"}}, AccessGroups: []AccessGroup{{}}},
+			errors: []string{"access_groups: every access group needs a name", "permissions: every permission needs a name", "permissions.a:b: declared more than once", "roles.x: declared more than once"},
+		},
+		{
+			name:   "unknown references",
+			file:   File{AccessGroups: []AccessGroup{{Name: "ops", Roles: []string{"ghost"}, Deny: []string{"billing:refund"}}}},
+			errors: []string{"access_groups.ops.permissions: unknown permissions: billing:refund", "access_groups.ops.roles: unknown roles: ghost"},
+		},
+		{
+			name:   "cycle",
+			file:   File{Roles: []Role{{Name: "user", Parents: []string{"admin"}}, {Name: "admin", Parents: []string{"user"}}}},
+			errors: []string{"roles.admin.parents: inheritance cycle: admin -> user -> admin", "roles.user.parents: inheritance cycle: user -> admin -> user"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validationErrors := Validate(test.file, current, test.prune)
+			if test.errors == nil {
+				if validationErrors != nil {
+					t.Fatalf("Validate() = %v, want nil", validationErrors)
+				}
+				return
+			}
+			if len(validationErrors) != len(test.errors) {
+				t.Fatalf("Validate() = %v, want %v", validationErrors, test.errors)
+			}
+			for _, want := range test.errors {
+				key, message, _ := strings.Cut(want, ": ")
+				if validationErrors[key] != message {
+					t.Errorf("Validate()[%q] = %q, want %q", key, validationErrors[key], message)
+				}
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	file, err := Parse([]byte("permissions:\n  - name: users:read\nroles:\n  - name: user\n    permissions: [users:read]\n"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(file.Roles) != 1 || file.Roles[0].Permissions[0] != "users:read" {
+		t.Errorf("Parse() = %+v", file)
+	}
+
+	if _, err := Parse([]byte(`{"roles": [{"name": "user", "permission": ["users:read"]}]}`)); err == nil {
+		t.Error("Parse() accepted an unknown field")
+	}
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"unified-go-backend/authz"
 	"unified-go-backend/config"
 	"unified-go-backend/controllers"
 	"unified-go-backend/middleware"
@@ -11,12 +12,22 @@ import (
 func AccessGroupRoutes(router *gin.Engine, cfg *config.Config) {
 	accessGroupController := controllers.NewAccessGroupController()
 
+	authz.Register("access_groups:create", "Create access groups")
+	authz.Register("access_groups:list", "List all access groups")
+	authz.Register("access_groups:update", "Update an access group's name, roles and permissions")
+	authz.Register("access_groups:delete", "Delete access groups")
+	authz.Register("access_groups:read", "View access group members")
+	authz.Register("access_groups:manage_members", "Add users to and remove users from access groups")
+
 	v1 := router.Group("/api/v1")
 	v1.Use(middleware.AuthMiddleware(cfg))
 	{
-		v1.POST("/access_groups", middleware.AuthorizationMiddleware("create_access_group"), accessGroupController.CreateAccessGroup)
-		v1.GET("/access_groups", middleware.AuthorizationMiddleware("list_access_groups"), accessGroupController.ListAccessGroups)
-		v1.PUT("/access_groups/:id", middleware.AuthorizationMiddleware("update_access_group"), accessGroupController.UpdateAccessGroup)
-		v1.DELETE("/access_groups/:id", middleware.AuthorizationMiddleware("delete_access_group"), accessGroupController.DeleteAccessGroup)
+		v1.POST("/access_groups", middleware.AuthorizationMiddleware("access_groups:create"), accessGroupController.CreateAccessGroup)
+		v1.GET("/access_groups", middleware.AuthorizationMiddleware("access_groups:list"), accessGroupController.ListAccessGroups)
+		v1.PUT("/access_groups/:id", middleware.AuthorizationMiddleware("access_groups:update"), accessGroupController.UpdateAccessGroup)
+		v1.DELETE("/access_groups/:id", middleware.AuthorizationMiddleware("access_groups:delete"), accessGroupController.DeleteAccessGroup)
+		v1.GET("/access_groups/:id/members", middleware.AuthorizationAnyMiddleware("access_groups:read", "access_groups:manage_members"), accessGroupController.ListAccessGroupMembers)
+		v1.POST("/access_groups/:id/members", middleware.AuthorizationMiddleware("access_groups:manage_members"), accessGroupController.AddAccessGroupMembers)
+		v1.DELETE("/access_groups/:id/members", middleware.AuthorizationMiddleware("access_groups:manage_members"), accessGroupController.RemoveAccessGroupMembers)
 	}
 }
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"unified-go-backend/authz"
+	"unified-go-backend/config"
+	"unified-go-backend/controllers"
+	"unified-go-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func AccessReviewRoutes(router *gin.Engine, cfg *config.Config) {
+	accessReviewController := controllers.NewAccessReviewController()
+
+	authz.Register("access_reviews:create", "Start access review campaigns")
+	authz.Register("access_reviews:list", "List access review campaigns")
+	authz.Register("access_reviews:read", "View access review campaigns and every item under review")
+	authz.Register("access_reviews:complete", "End access review campaigns early, revoking unreviewed access")
+	authz.Register("access_reviews:export", "Export access review results as CSV")
+
+	v1 := router.Group("/api/v1")
+	v1.Use(middleware.AuthMiddleware(cfg))
+	{
+		v1.POST("/access_reviews", middleware.AuthorizationMiddleware("access_reviews:create"), accessReviewController.CreateAccessReview)
+		v1.GET("/access_reviews", middleware.AuthorizationMiddleware("access_reviews:list"), accessReviewController.ListAccessReviews)
+		v1.GET("/access_reviews/:id", middleware.AuthorizationMiddleware("access_reviews:read"), accessReviewController.GetAccessReview)
+		v1.GET("/access_reviews/:id/items", accessReviewController.ListAccessReviewItems)
+		v1.POST("/access_reviews/:id/items/:item_id", accessReviewController.DecideAccessReviewItem)
+		v1.POST("/access_reviews/:id/complete", middleware.AuthorizationMiddleware("access_reviews:complete"), accessReviewController.CompleteAccessReview)
+		v1.GET("/access_reviews/:id/export", middleware.AuthorizationMiddleware("access_reviews:export"), accessReviewController.ExportAccessReview)
+	}
+}
@@ -15,5 +15,6 @@ func AuthRoutes(router *gin.Engine, cfg *config.Config) {
 		v1.POST("/register", authController.Register)
 		v1.POST("/login", authController.Login)
 		v1.POST("/verify-email", authController.VerifyEmail)
+		v1.POST("/set-password", authController.SetPassword)
 	}
 }
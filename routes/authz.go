@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"unified-go-backend/authz"
+	"unified-go-backend/config"
+	"unified-go-backend/controllers"
+	"unified-go-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func AuthzRoutes(router *gin.Engine, cfg *config.Config) {
+	authzController := controllers.NewAuthzController()
+
+	authz.Register("authz:explain", "Explain which rules allow or deny permissions for any user")
+
+	v1 := router.Group("/api/v1")
+	v1.Use(middleware.AuthMiddleware(cfg))
+	{
+		v1.POST("/authz/check", authzController.Check)
+		v1.GET("/authz/explain", middleware.AuthorizationMiddleware("authz:explain"), authzController.Explain)
+	}
+}
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"unified-go-backend/authz"
+	"unified-go-backend/config"
+	"unified-go-backend/controllers"
+	"unified-go-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func OrganizationRoutes(router *gin.Engine, cfg *config.Config) {
+	organizationController := controllers.NewOrganizationController()
+
+	authz.Register("orgs:create", "Create organizations")
+	authz.Register("orgs:list", "List organizations")
+	authz.Register("orgs:read", "View an organization and its members")
+	authz.Register("orgs:update", "Rename organizations")
+	authz.Register("orgs:delete", "Delete organizations without members")
+	authz.Register("orgs:manage_members", "Add and remove organization members and set their roles and access groups")
+
+	v1 := router.Group("/api/v1")
+	v1.Use(middleware.AuthMiddleware(cfg))
+	{
+		v1.POST("/orgs", middleware.AuthorizationMiddleware("orgs:create"), organizationController.CreateOrganization)
+		v1.GET("/orgs", middleware.AuthorizationMiddleware("orgs:list"), organizationController.ListOrganizations)
+		v1.GET("/user/orgs", organizationController.ListMyOrganizations)
+		v1.GET("/orgs/:id", middleware.AuthorizationMiddleware("orgs:read"), organizationController.GetOrganization)
+		v1.PUT("/orgs/:id", middleware.AuthorizationMiddleware("orgs:update"), organizationController.UpdateOrganization)
+		v1.DELETE("/orgs/:id", middleware.AuthorizationMiddleware("orgs:delete"), organizationController.DeleteOrganization)
+		v1.GET("/orgs/:id/members", middleware.AuthorizationMiddleware("orgs:read"), organizationController.ListOrganizationMembers)
+		v1.PUT("/orgs/:id/members", middleware.AuthorizationMiddleware("orgs:manage_members"), organizationController.SetOrganizationMember)
+		v1.DELETE("/orgs/:id/members/:user_id", middleware.AuthorizationMiddleware("orgs:manage_members"), organizationController.RemoveOrganizationMember)
+	}
+}
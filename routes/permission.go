@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"unified-go-backend/authz"
+	"unified-go-backend/config"
+	"unified-go-backend/controllers"
+	"unified-go-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func PermissionRoutes(router *gin.Engine, cfg *config.Config) {
+	permissionController := controllers.NewPermissionController()
+
+	authz.Register("permissions:list", "List all permissions and their descriptions")
+
+	v1 := router.Group("/api/v1")
+	v1.Use(middleware.AuthMiddleware(cfg))
+	{
+		v1.GET("/permissions", middleware.AuthorizationMiddleware("permissions:list"), permissionController.ListPermissions)
+	}
+}
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"unified-go-backend/authz"
+	"unified-go-backend/config"
+	"unified-go-backend/controllers"
+	"unified-go-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func PolicyRoutes(router *gin.Engine, cfg *config.Config) {
+	policyController := controllers.NewPolicyController()
+
+	authz.Register("policies:create", "Create attribute-based access policies")
+	authz.Register("policies:list", "List all access policies")
+	authz.Register("policies:read", "View a single access policy")
+	authz.Register("policies:update", "Update access policies")
+	authz.Register("policies:delete", "Delete access policies")
+
+	v1 := router.Group("/api/v1")
+	v1.Use(middleware.AuthMiddleware(cfg))
+	{
+		v1.POST("/policies", middleware.AuthorizationMiddleware("policies:create"), policyController.CreatePolicy)
+		v1.GET("/policies", middleware.AuthorizationMiddleware("policies:list"), policyController.ListPolicies)
+		v1.GET("/policies/:id", middleware.AuthorizationMiddleware("policies:read"), policyController.GetPolicy)
+		v1.PUT("/policies/:id", middleware.AuthorizationMiddleware("policies:update"), policyController.UpdatePolicy)
+		v1.DELETE("/policies/:id", middleware.AuthorizationMiddleware("policies:delete"), policyController.DeletePolicy)
+	}
+}
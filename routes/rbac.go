@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"unified-go-backend/authz"
+	"unified-go-backend/config"
+	"unified-go-backend/controllers"
+	"unified-go-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RBACRoutes(router *gin.Engine, cfg *config.Config) {
+	rbacController := controllers.NewRBACController()
+
+	authz.Register("rbac:export", "Export the global permissions, roles and access groups as a policy file")
+	authz.Register("rbac:import", "Plan and apply policy files to the global permissions, roles and access groups")
+
+	v1 := router.Group("/api/v1")
+	v1.Use(middleware.AuthMiddleware(cfg))
+	{
+		v1.GET("/rbac", middleware.AuthorizationMiddleware("rbac:export"), rbacController.ExportRBAC)
+		v1.POST("/rbac/plan", middleware.AuthorizationMiddleware("rbac:import"), rbacController.PlanRBAC)
+		v1.POST("/rbac/import", middleware.AuthorizationMiddleware("rbac:import"), rbacController.ImportRBAC)
+	}
+}
@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"unified-go-backend/authz"
+	"unified-go-backend/config"
+	"unified-go-backend/controllers"
+	"unified-go-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RelationRoutes(router *gin.Engine, cfg *config.Config) {
+	relationController := controllers.NewRelationController()
+
+	authz.Register("relations:read", "Read the relation schema, tuples and expansions")
+	authz.Register("relations:write", "Write and delete relation tuples")
+	authz.Register("relations:check", "Check relations and list accessible objects for any subject")
+	authz.Register("relations:schema", "Replace the relation schema")
+
+	v1 := router.Group("/api/v1")
+	v1.Use(middleware.AuthMiddleware(cfg))
+	{
+		v1.GET("/relations/schema", middleware.AuthorizationMiddleware("relations:read"), relationController.GetSchema)
+		v1.PUT("/relations/schema", middleware.AuthorizationMiddleware("relations:schema"), relationController.UpdateSchema)
+		v1.GET("/relations", middleware.AuthorizationMiddleware("relations:read"), relationController.ListTuples)
+		v1.POST("/relations", middleware.AuthorizationMiddleware("relations:write"), relationController.WriteTuple)
+		v1.DELETE("/relations", middleware.AuthorizationMiddleware("relations:write"), relationController.DeleteTuple)
+		v1.POST("/relations/check", middleware.AuthorizationMiddleware("relations:check"), relationController.Check)
+		v1.GET("/relations/expand", middleware.AuthorizationMiddleware("relations:read"), relationController.Expand)
+		v1.GET("/relations/objects", middleware.AuthorizationMiddleware("relations:check"), relationController.ListObjects)
+		v1.GET("/objects/:type/:id/relations", middleware.RelationMiddleware(":type", "view", "id"), relationController.ListObjectTuples)
+	}
+}
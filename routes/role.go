@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"unified-go-backend/authz"
+	"unified-go-backend/config"
+	"unified-go-backend/controllers"
+	"unified-go-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RoleRoutes(router *gin.Engine, cfg *config.Config) {
+	roleController := controllers.NewRoleController()
+
+	authz.Register("roles:create", "Create roles")
+	authz.Register("roles:list", "List all roles")
+	authz.Register("roles:read", "View a single role")
+	authz.Register("roles:update", "Update a role's name, permissions and parent roles")
+	authz.Register("roles:delete", "Delete roles that are no longer assigned")
+
+	v1 := router.Group("/api/v1")
+	v1.Use(middleware.AuthMiddleware(cfg))
+	{
+		v1.POST("/roles", middleware.AuthorizationMiddleware("roles:create"), roleController.CreateRole)
+		v1.GET("/roles", middleware.AuthorizationMiddleware("roles:list"), roleController.ListRoles)
+		v1.GET("/roles/:id", middleware.AuthorizationMiddleware("roles:read"), roleController.GetRole)
+		v1.GET("/roles/:id/tree", middleware.AuthorizationMiddleware("roles:read"), roleController.GetRoleTree)
+		v1.PUT("/roles/:id", middleware.AuthorizationMiddleware("roles:update"), roleController.UpdateRole)
+		v1.DELETE("/roles/:id", middleware.AuthorizationMiddleware("roles:delete"), roleController.DeleteRole)
+	}
+}
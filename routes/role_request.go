@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"unified-go-backend/authz"
+	"unified-go-backend/config"
+	"unified-go-backend/controllers"
+	"unified-go-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RoleRequestRoutes(router *gin.Engine, cfg *config.Config) {
+	roleRequestController := controllers.NewRoleRequestController(cfg)
+
+	authz.Register("role_requests:list", "List every temporary role request")
+	authz.Register(controllers.DefaultApproverPermission, "Approve or deny temporary role requests for roles without their own approver permission")
+	// Approving is checked by the controller against the requested role
+	authz.Require(controllers.DefaultApproverPermission)
+
+	v1 := router.Group("/api/v1")
+	v1.Use(middleware.AuthMiddleware(cfg))
+	{
+		v1.POST("/role_requests", roleRequestController.CreateRoleRequest)
+		v1.GET("/role_requests", middleware.AuthorizationMiddleware("role_requests:list"), roleRequestController.ListRoleRequests)
+		v1.GET("/user/role_requests", roleRequestController.ListMyRoleRequests)
+		v1.POST("/role_requests/:id/approve", roleRequestController.ApproveRoleRequest)
+		v1.POST("/role_requests/:id/deny", roleRequestController.DenyRoleRequest)
+	}
+}
@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"unified-go-backend/authz"
+	"unified-go-backend/config"
+	"unified-go-backend/controllers"
+	"unified-go-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TeamRoutes(router *gin.Engine, cfg *config.Config) {
+	teamController := controllers.NewTeamController()
+
+	authz.Register("teams:create", "Create teams")
+	authz.Register("teams:list", "List teams")
+	authz.Register("teams:read", "View any team and its members")
+	authz.Register("teams:update", "Change a team's parent, roles and assignable roles")
+	authz.Register("teams:delete", "Delete teams without child teams")
+	authz.Register("teams:manage_members", "Manage the members of any team, as a team admin would")
+
+	v1 := router.Group("/api/v1")
+	v1.Use(middleware.AuthMiddleware(cfg))
+	{
+		v1.POST("/teams", middleware.AuthorizationMiddleware("teams:create"), teamController.CreateTeam)
+		v1.GET("/teams", middleware.AuthorizationMiddleware("teams:list"), teamController.ListTeams)
+		v1.GET("/user/teams", teamController.ListMyTeams)
+		v1.GET("/teams/:id", middleware.AuthorizationMiddleware("teams:read"), teamController.GetTeam)
+		v1.PUT("/teams/:id", middleware.AuthorizationMiddleware("teams:update"), teamController.UpdateTeam)
+		v1.DELETE("/teams/:id", middleware.AuthorizationMiddleware("teams:delete"), teamController.DeleteTeam)
+		// Team admins are authorized by the controller
+		v1.GET("/teams/:id/members", teamController.ListTeamMembers)
+		v1.PUT("/teams/:id/members/:user_id", teamController.SetTeamMember)
+		v1.DELETE("/teams/:id/members/:user_id", teamController.RemoveTeamMember)
+	}
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"unified-go-backend/authz"
 	"unified-go-backend/config"
 	"unified-go-backend/controllers"
 	"unified-go-backend/middleware"
@@ -10,14 +11,40 @@ import (
 
 func UserRoutes(router *gin.Engine, cfg *config.Config) {
 	userController := controllers.NewUserController(cfg)
+	userImportController := controllers.NewUserImportController(cfg)
+	privacyController := controllers.NewPrivacyController(cfg)
+
+	authz.Register("users:create", "Create users and invite them")
+	authz.Register("users:update", "Update any user's details")
+	authz.Register("users:delete", "Delete any user")
+	authz.Register("users:restore", "Restore a deleted user")
+	authz.Register("users:suspend", "Suspend, ban and unsuspend users")
+	authz.Register("users:list", "List all users")
+	authz.Register("users:import", "Import users in bulk")
+	authz.Register("users:export", "Export users")
+	authz.Register(controllers.SensitiveUserFieldsPermission, "See users' last login addresses and agents and who deleted or suspended them")
 
 	v1 := router.Group("/api/v1")
 	v1.Use(middleware.AuthMiddleware(cfg))
 	{
 		v1.GET("/user/profile", userController.Profile)
 		v1.PUT("/user/profile", userController.UpdateProfile)
-		v1.PUT("/user/:id", middleware.AuthorizationMiddleware("update_user"), userController.UpdateUser)
-		v1.DELETE("/user/:id", middleware.AuthorizationMiddleware("delete_user"), userController.DeleteUser)
-		v1.GET("/users", middleware.AuthorizationMiddleware("list_users"), userController.ListUsers)
+		v1.PUT("/user/password", userController.ChangePassword)
+		v1.GET("/user/permissions", userController.Permissions)
+		v1.POST("/user/data-export", privacyController.RequestDataExport)
+		v1.GET("/user/data-export/:id", privacyController.GetDataExport)
+		v1.GET("/user/data-export/:id/download", privacyController.DownloadDataExport)
+		v1.POST("/user/deletion-request", privacyController.RequestAccountDeletion)
+		v1.DELETE("/user/deletion-request", privacyController.CancelAccountDeletion)
+		v1.PUT("/user/:id", middleware.AuthorizationMiddleware("users:update"), userController.UpdateUser)
+		v1.DELETE("/user/:id", middleware.AuthorizationMiddleware("users:delete"), userController.DeleteUser)
+		v1.POST("/user/:id/restore", middleware.AuthorizationMiddleware("users:restore"), userController.RestoreUser)
+		v1.POST("/user/:id/suspend", middleware.AuthorizationMiddleware("users:suspend"), userController.SuspendUser)
+		v1.POST("/user/:id/unsuspend", middleware.AuthorizationMiddleware("users:suspend"), userController.UnsuspendUser)
+		v1.GET("/users", middleware.AuthorizationMiddleware("users:list"), userController.ListUsers)
+		v1.POST("/users", middleware.AuthorizationMiddleware("users:create"), userController.CreateUser)
+		v1.GET("/users/export", middleware.AuthorizationMiddleware("users:export"), userController.ExportUsers)
+		v1.POST("/users/import", middleware.AuthorizationMiddleware("users:import"), userImportController.ImportUsers)
+		v1.GET("/users/import/:id", middleware.AuthorizationMiddleware("users:import"), userImportController.GetUserImport)
 	}
 }
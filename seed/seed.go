@@ -2,106 +2,54 @@ package seed
 
 import (
 	"context"
+	_ "embed"
 	"fmt"
 	"log"
+	"unified-go-backend/authz"
 	"unified-go-backend/config"
+	"unified-go-backend/database"
 	"unified-go-backend/models"
+	"unified-go-backend/rbac"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func SeedData(cfg *config.Config) {
-	// Connect to MongoDB
-	clientOptions := options.Client().ApplyURI(cfg.MongoURI).SetWriteConcern(writeconcern.New(writeconcern.WMajority()))
-	mongoClient, err := mongo.Connect(context.TODO(), clientOptions)
-	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
-	}
-	defer mongoClient.Disconnect(context.TODO())
+// defaultRBAC is the default set of permissions, roles and access groups.
+//
+//go:embed rbac.yaml
+var defaultRBAC []byte
 
-	// Get collections
-	usersCollection := mongoClient.Database("mdmdb").Collection("users")
-	rolesCollection := mongoClient.Database("mdmdb").Collection("roles")
-	permissionsCollection := mongoClient.Database("mdmdb").Collection("permissions")
-	accessGroupsCollection := mongoClient.Database("mdmdb").Collection("access_groups")
+// SeedData applies the default RBAC configuration and creates the dummy
+// users. Running it again leaves existing entries and users alone.
+func SeedData(cfg *config.Config) {
+	database.ConnectDB(cfg)
+	defer database.DisconnectDB()
 
-	// Create permissions
-	permissions := []models.Permission{
-		{Name: "create_user"},
-		{Name: "read_user"},
-		{Name: "update_user"},
-		{Name: "delete_user"},
-		{Name: "list_users"},
-		{Name: "create_access_group"},
-		{Name: "read_access_group"},
-		{Name: "update_access_group"},
-		{Name: "delete_access_group"},
+	file, err := rbac.Parse(defaultRBAC)
+	if err != nil {
+		log.Fatalf("Failed to parse default RBAC configuration: %v", err)
 	}
-
-	for _, permission := range permissions {
-		_, err := permissionsCollection.InsertOne(context.TODO(), permission)
-		if err != nil {
-			log.Fatalf("Failed to insert permission %s: %v", permission.Name, err)
-		}
+	plan, validationErrors, err := rbac.Import(context.TODO(), file, false, false)
+	if validationErrors != nil {
+		log.Fatalf("Invalid default RBAC configuration: %v", validationErrors)
 	}
-
-	// Create roles
-	roles := []models.Role{
-		{
-			ID:          primitive.NewObjectID(),
-			Name:        "admin",
-			Permissions: []string{"create_user", "read_user", "update_user", "delete_user", "list_users", "create_access_group", "read_access_group", "update_access_group", "delete_access_group"},
-		},
-		{
-			ID:          primitive.NewObjectID(),
-			Name:        "operator",
-			Permissions: []string{"read_user", "update_user", "list_users"},
-		},
-		{
-			ID:          primitive.NewObjectID(),
-			Name:        "user",
-			Permissions: []string{"read_user"},
-		},
+	if err != nil {
+		log.Fatalf("Failed to apply default RBAC configuration: %v", err)
 	}
-
-	for _, role := range roles {
-		_, err := rolesCollection.InsertOne(context.TODO(), role)
-		if err != nil {
-			log.Fatalf("Failed to insert role %s: %v", role.Name, err)
-		}
+	for _, change := range plan.Changes {
+		fmt.Println(change)
 	}
 
-	// Create access groups
-	accessGroups := []models.AccessGroup{
-		{
-			ID:          primitive.NewObjectID(),
-			Name:        "admin_group",
-			Roles:       []string{"admin"},
-			Permissions: []string{},
-		},
-		{
-			ID:          primitive.NewObjectID(),
-			Name:        "operator_group",
-			Roles:       []string{"operator"},
-			Permissions: []string{},
-		},
-		{
-			ID:          primitive.NewObjectID(),
-			Name:        "user_group",
-			Roles:       []string{"user"},
-			Permissions: []string{},
-		},
+	groups := make(map[string]primitive.ObjectID)
+	found, err := authz.FindAccessGroups(context.TODO(), []string{"admin_group", "operator_group", "user_group"}, primitive.NilObjectID)
+	if err != nil {
+		log.Fatalf("Failed to fetch access groups: %v", err)
 	}
-
-	for _, group := range accessGroups {
-		_, err := accessGroupsCollection.InsertOne(context.TODO(), group)
-		if err != nil {
-			log.Fatalf("Failed to insert access group %s: %v", group.Name, err)
-		}
+	for _, group := range found {
+		groups[group.Name] = group.ID
 	}
 
 	// Create hashed password for dummy users
@@ -113,36 +61,38 @@ func SeedData(cfg *config.Config) {
 	// Create users
 	users := []models.User{
 		{
-			ID:          primitive.NewObjectID(),
-			Email:       "admin@example.com",
-			Username:    "admin",
-			Password:    string(hashedPassword),
-			Verified:    true,
-			Roles:       []string{"admin"},
-			AccessGroup: "admin_group",
+			Email:        "admin@example.com",
+			Username:     "admin",
+			Password:     string(hashedPassword),
+			Verified:     true,
+			Roles:        []string{"admin"},
+			AccessGroups: []primitive.ObjectID{groups["admin_group"]},
 		},
 		{
-			ID:          primitive.NewObjectID(),
-			Email:       "operator@example.com",
-			Username:    "operator",
-			Password:    string(hashedPassword),
-			Verified:    true,
-			Roles:       []string{"operator"},
-			AccessGroup: "operator_group",
+			Email:        "operator@example.com",
+			Username:     "operator",
+			Password:     string(hashedPassword),
+			Verified:     true,
+			Roles:        []string{"operator"},
+			AccessGroups: []primitive.ObjectID{groups["operator_group"]},
 		},
 		{
-			ID:          primitive.NewObjectID(),
-			Email:       "user@example.com",
-			Username:    "user",
-			Password:    string(hashedPassword),
-			Verified:    true,
-			Roles:       []string{"user"},
-			AccessGroup: "user_group",
+			Email:        "user@example.com",
+			Username:     "user",
+			Password:     string(hashedPassword),
+			Verified:     true,
+			Roles:        []string{"user"},
+			AccessGroups: []primitive.ObjectID{groups["user_group"]},
 		},
 	}
 
+	usersCollection := database.MongoClient.Database("mdmdb").Collection("users")
 	for _, user := range users {
-		_, err := usersCollection.InsertOne(context.TODO(), user)
+		_, err := usersCollection.UpdateOne(context.TODO(),
+			bson.M{"email": user.Email},
+			bson.M{"$setOnInsert": user},
+			options.Update().SetUpsert(true),
+		)
 		if err != nil {
 			log.Fatalf("Failed to insert user %s: %v", user.Username, err)
 		}
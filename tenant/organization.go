@@ -0,0 +1,22 @@
+package tenant
+
+import (
+	"context"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FindOrganization looks an organization up by ID or slug.
+func FindOrganization(ctx context.Context, ref string) (models.Organization, error) {
+	filter := bson.M{"slug": ref}
+	if objectId, err := primitive.ObjectIDFromHex(ref); err == nil {
+		filter = bson.M{"$or": []bson.M{{"_id": objectId}, {"slug": ref}}}
+	}
+
+	var org models.Organization
+	err := database.MongoClient.Database("mdmdb").Collection("organizations").FindOne(ctx, filter).Decode(&org)
+	return org, err
+}
@@ -0,0 +1,94 @@
+// Package tenant tracks the organization a request runs in and builds the
+// filters that keep one organization's data out of another's queries.
+//
+// Requests without an organization run in the global context, which only
+// sees global roles and access groups and is meant for platform
+// administration.
+package tenant
+
+import (
+	"unified-go-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const contextKey = "org_id"
+
+// Set records the organization the request runs in.
+func Set(c *gin.Context, org primitive.ObjectID) {
+	c.Set(contextKey, org)
+}
+
+// ID returns the organization the request runs in, or primitive.NilObjectID
+// in the global context.
+func ID(c *gin.Context) primitive.ObjectID {
+	if value, exists := c.Get(contextKey); exists {
+		if org, ok := value.(primitive.ObjectID); ok {
+			return org
+		}
+	}
+	return primitive.NilObjectID
+}
+
+// Scoped reports whether the request runs inside an organization.
+func Scoped(c *gin.Context) bool {
+	return !ID(c).IsZero()
+}
+
+// OwnedBy matches the access groups or roles owned by org, or the global
+// ones for primitive.NilObjectID.
+func OwnedBy(org primitive.ObjectID) bson.M {
+	if org.IsZero() {
+		return bson.M{"org_id": bson.M{"$exists": false}}
+	}
+	return bson.M{"org_id": org}
+}
+
+// Filter matches the access groups or roles owned by the request's
+// organization.
+func Filter(c *gin.Context) bson.M {
+	return OwnedBy(ID(c))
+}
+
+// VisibleRoles matches the roles usable in the request's organization: its
+// own and the global ones.
+func VisibleRoles(c *gin.Context) bson.M {
+	org := ID(c)
+	if org.IsZero() {
+		return OwnedBy(org)
+	}
+	return bson.M{"$or": []bson.M{OwnedBy(primitive.NilObjectID), OwnedBy(org)}}
+}
+
+// Users matches the users visible in the request's organization: its
+// members, or every user in the global context.
+func Users(c *gin.Context) bson.M {
+	org := ID(c)
+	if org.IsZero() {
+		return bson.M{}
+	}
+	return bson.M{"orgs.org_id": org}
+}
+
+// Membership returns the user's membership of org.
+func Membership(user models.User, org primitive.ObjectID) (models.OrgMembership, bool) {
+	for _, membership := range user.Orgs {
+		if membership.OrgID == org {
+			return membership, true
+		}
+	}
+	return models.OrgMembership{}, false
+}
+
+// With adds the conditions of filter to the tenant filter.
+func With(tenantFilter bson.M, filter bson.M) bson.M {
+	if len(tenantFilter) == 0 {
+		return filter
+	}
+	if len(filter) == 0 {
+		return tenantFilter
+	}
+	return bson.M{"$and": []bson.M{tenantFilter, filter}}
+}
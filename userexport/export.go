@@ -0,0 +1,265 @@
+// Package userexport writes users as CSV, NDJSON or XLSX one at a time, so
+// that exports of any size stream without being loaded in memory. Password
+// hashes are never exported.
+package userexport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unified-go-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Export formats.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatXLSX   = "xlsx"
+)
+
+var contentTypes = map[string]string{
+	FormatCSV:    "text/csv; charset=utf-8",
+	FormatNDJSON: "application/x-ndjson",
+	FormatXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// Column is an exported user field. Inside an organization the roles and
+// access groups are those of the user's membership.
+type Column struct {
+	Name string
+	// fields are the stored fields the value is read from
+	fields []string
+	value  func(user models.User, org primitive.ObjectID) interface{}
+}
+
+// columns lists the exportable columns in their default order.
+var columns = []Column{
+	{Name: "id", fields: []string{"_id"}, value: func(user models.User, _ primitive.ObjectID) interface{} {
+		return user.ID.Hex()
+	}},
+	{Name: "username", fields: []string{"username"}, value: func(user models.User, _ primitive.ObjectID) interface{} {
+		return user.Username
+	}},
+	{Name: "email", fields: []string{"email"}, value: func(user models.User, _ primitive.ObjectID) interface{} {
+		return user.Email
+	}},
+	{Name: "verified", fields: []string{"verified"}, value: func(user models.User, _ primitive.ObjectID) interface{} {
+		return user.Verified
+	}},
+	{Name: "verified_at", fields: []string{"verified_at"}, value: func(user models.User, _ primitive.ObjectID) interface{} {
+		return user.VerifiedAt
+	}},
+	{Name: "status", fields: []string{"status"}, value: func(user models.User, _ primitive.ObjectID) interface{} {
+		if user.Status.Blocked(time.Now()) {
+			return user.Status.State
+		}
+		return models.UserActive
+	}},
+	{Name: "status_reason", fields: []string{"status"}, value: func(user models.User, _ primitive.ObjectID) interface{} {
+		return user.Status.Reason
+	}},
+	{Name: "roles", fields: []string{"roles", "orgs"}, value: func(user models.User, org primitive.ObjectID) interface{} {
+		if org.IsZero() {
+			return user.Roles
+		}
+		return membership(user, org).Roles
+	}},
+	{Name: "access_groups", fields: []string{"access_groups", "orgs"}, value: func(user models.User, org primitive.ObjectID) interface{} {
+		groups := user.AccessGroups
+		if !org.IsZero() {
+			groups = membership(user, org).AccessGroups
+		}
+		ids := make([]string, 0, len(groups))
+		for _, id := range groups {
+			ids = append(ids, id.Hex())
+		}
+		return ids
+	}},
+	{Name: "created", fields: []string{"_id"}, value: func(user models.User, _ primitive.ObjectID) interface{} {
+		return user.ID.Timestamp()
+	}},
+	{Name: "last_login", fields: []string{"last_login"}, value: func(user models.User, _ primitive.ObjectID) interface{} {
+		return user.LastLogin
+	}},
+	{Name: "deleted_at", fields: []string{"deleted_at"}, value: func(user models.User, _ primitive.ObjectID) interface{} {
+		return user.DeletedAt
+	}},
+}
+
+// DefaultColumns are exported when no columns are chosen.
+var DefaultColumns = []string{"id", "username", "email", "verified", "status", "roles", "access_groups", "created", "last_login"}
+
+// ColumnNames lists every exportable column.
+func ColumnNames() []string {
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, column.Name)
+	}
+	return names
+}
+
+// Columns returns the named columns, in the given order.
+func Columns(names []string) ([]Column, error) {
+	selected := make([]Column, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, column := range columns {
+			if column.Name == name {
+				selected = append(selected, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+	return selected, nil
+}
+
+// Projection returns the projection reading the stored fields of columns.
+func Projection(columns []Column) bson.M {
+	projection := bson.M{"_id": 1}
+	for _, column := range columns {
+		for _, field := range column.fields {
+			projection[field] = 1
+		}
+	}
+	return projection
+}
+
+// ContentType returns the MIME type of format, or "" for an unknown format.
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// Writer writes users in an export format. Close must be called once the
+// last user is written.
+type Writer interface {
+	Write(user models.User) error
+	Close() error
+}
+
+// NewWriter returns a Writer of format writing the columns to w. Users are
+// exported as seen from org, or globally for primitive.NilObjectID.
+func NewWriter(w io.Writer, format string, columns []Column, org primitive.ObjectID) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns, org)
+	case FormatNDJSON:
+		return &ndjsonWriter{w: w, columns: columns, org: org}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w, columns, org)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []Column
+	org     primitive.ObjectID
+	record  []string
+}
+
+func newCSVWriter(w io.Writer, columns []Column, org primitive.ObjectID) (*csvWriter, error) {
+	writer := &csvWriter{w: csv.NewWriter(w), columns: columns, org: org, record: make([]string, len(columns))}
+	for i, column := range columns {
+		writer.record[i] = column.Name
+	}
+	return writer, writer.w.Write(writer.record)
+}
+
+func (cw *csvWriter) Write(user models.User) error {
+	for i, column := range cw.columns {
+		cw.record[i] = neutralize(cell(column.value(user, cw.org)))
+	}
+	return cw.w.Write(cw.record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type ndjsonWriter struct {
+	w       io.Writer
+	columns []Column
+	org     primitive.ObjectID
+	buffer  bytes.Buffer
+}
+
+// Write writes the user as a JSON object with the keys in column order.
+// Unset dates are null.
+func (nw *ndjsonWriter) Write(user models.User) error {
+	nw.buffer.Reset()
+	nw.buffer.WriteByte('{')
+	for i, column := range nw.columns {
+		if i > 0 {
+			nw.buffer.WriteByte(',')
+		}
+		value := column.value(user, nw.org)
+		if date, ok := value.(time.Time); ok && date.IsZero() {
+			value = nil
+		}
+		key, _ := json.Marshal(column.Name)
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		nw.buffer.Write(key)
+		nw.buffer.WriteByte(':')
+		nw.buffer.Write(encoded)
+	}
+	nw.buffer.WriteString("}\n")
+	_, err := nw.w.Write(nw.buffer.Bytes())
+	return err
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
+
+func membership(user models.User, org primitive.ObjectID) models.OrgMembership {
+	for _, membership := range user.Orgs {
+		if membership.OrgID == org {
+			return membership
+		}
+	}
+	return models.OrgMembership{}
+}
+
+// cell formats a value for the cells of CSV and XLSX files. Lists are
+// separated by semicolons, as in import files.
+func cell(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case bool:
+		return strconv.FormatBool(value)
+	case time.Time:
+		if value.IsZero() {
+			return ""
+		}
+		return value.UTC().Format(time.RFC3339)
+	case []string:
+		return strings.Join(value, ";")
+	}
+	return fmt.Sprint(value)
+}
+
+// neutralize keeps spreadsheets from evaluating user-provided values
+// opening a CSV file as formulas.
+func neutralize(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
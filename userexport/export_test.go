@@ -0,0 +1,195 @@
+package userexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"unified-go-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	exportOrg   = primitive.NewObjectID()
+	exportGroup = primitive.NewObjectID()
+	exportUser  = models.User{
+		ID:        primitive.NewObjectID(),
+		Username:  "=cmd|' /C calc'!A0",
+		Email:     "bob@example.com",
+		Password:  "$2a$10$hash",
+		Verified:  true,
+		Roles:     []string{"user", "support"},
+		LastLogin: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Status:    models.UserStatus{State: models.UserBanned, Reason: "spam & abuse"},
+		Orgs:      []models.OrgMembership{{OrgID: exportOrg, Roles: []string{"member"}, AccessGroups: []primitive.ObjectID{exportGroup}}},
+	}
+)
+
+// export writes the users with the named columns and returns the output.
+func export(t *testing.T, format string, names []string, org primitive.ObjectID, users ...models.User) []byte {
+	t.Helper()
+	selected, err := Columns(names)
+	if err != nil {
+		t.Fatalf("Columns() error = %v", err)
+	}
+	var output bytes.Buffer
+	writer, err := NewWriter(&output, format, selected, org)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	for _, user := range users {
+		if err := writer.Write(user); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return output.Bytes()
+}
+
+func TestCSVWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		org     primitive.ObjectID
+		want    string
+	}{
+		{
+			name:    "global",
+			columns: []string{"username", "email", "verified", "status", "status_reason", "roles", "verified_at", "last_login"},
+			want:    "username,email,verified,status,status_reason,roles,verified_at,last_login\n'=cmd|' /C calc'!A0,bob@example.com,true,banned,spam & abuse,user;support,,2024-03-01T12:00:00Z\n",
+		},
+		{
+			name:    "organization",
+			columns: []string{"email", "roles", "access_groups"},
+			org:     exportOrg,
+			want:    "email,roles,access_groups\nbob@example.com,member," + exportGroup.Hex() + "\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(export(t, FormatCSV, test.columns, test.org, exportUser)); got != test.want {
+				t.Errorf("CSV export = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	output := export(t, FormatNDJSON, []string{"id", "verified", "roles", "verified_at", "last_login", "access_groups"}, primitive.NilObjectID, exportUser, models.User{ID: exportUser.ID})
+	lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("NDJSON export has %d lines, want 2: %q", len(lines), output)
+	}
+
+	want := `{"id":"` + exportUser.ID.Hex() + `","verified":true,"roles":["user","support"],"verified_at":null,"last_login":"2024-03-01T12:00:00Z","access_groups":[]}`
+	if lines[0] != want {
+		t.Errorf("NDJSON line = %s, want %s", lines[0], want)
+	}
+	var empty map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &empty); err != nil {
+		t.Fatalf("NDJSON line %s: %v", lines[1], err)
+	}
+	if empty["roles"] != nil || empty["last_login"] != nil {
+		t.Errorf("NDJSON line of an empty user = %s", lines[1])
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	output := export(t, FormatXLSX, []string{"username", "verified", "status_reason"}, primitive.NilObjectID, exportUser)
+	archive, err := zip.NewReader(bytes.NewReader(output), int64(len(output)))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+
+	var sheet []byte
+	for _, file := range archive.File {
+		if file.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sheet, err = io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(archive.File) != len(xlsxParts)+1 || sheet == nil {
+		t.Fatalf("XLSX archive holds %d parts, want the worksheet and %d others", len(archive.File), len(xlsxParts))
+	}
+
+	var worksheet struct {
+		Rows []struct {
+			Cells []struct {
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(sheet, &worksheet); err != nil {
+		t.Fatalf("worksheet is not valid XML: %v", err)
+	}
+	if len(worksheet.Rows) != 2 {
+		t.Fatalf("worksheet has %d rows, want 2", len(worksheet.Rows))
+	}
+	row := worksheet.Rows[1].Cells
+	// Cells hold the text as is: spreadsheets do not evaluate inline strings
+	if len(row) != 3 || row[0].Inline != exportUser.Username || row[1].Type != "b" || row[1].Value != "1" || row[2].Inline != "spam & abuse" {
+		t.Errorf("worksheet row = %+v", row)
+	}
+}
+
+func TestColumns(t *testing.T) {
+	if _, err := Columns([]string{"email", "password"}); err == nil {
+		t.Error("Columns() accepted the password")
+	}
+	for _, name := range DefaultColumns {
+		if _, err := Columns([]string{name}); err != nil {
+			t.Errorf("default column %s: %v", name, err)
+		}
+	}
+
+	selected, err := Columns([]string{"created", "roles", "status_reason"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bson.M{"_id": 1, "roles": 1, "orgs": 1, "status": 1}
+	projection := Projection(selected)
+	if len(projection) != len(want) {
+		t.Fatalf("Projection() = %v, want %v", projection, want)
+	}
+	for field := range want {
+		if _, exists := projection[field]; !exists {
+			t.Errorf("Projection() = %v, want %v", projection, want)
+		}
+	}
+}
+
+func TestNeutralize(t *testing.T) {
+	tests := map[string]string{
+		"":            "",
+		"bob":         "bob",
+		"=1+1":        "'=1+1",
+		"+33 1 23":    "'+33 1 23",
+		"-2":          "'-2",
+		"@SUM(A1)":    "'@SUM(A1)",
+		"\tcmd":       "'\tcmd",
+		"a=b":         "a=b",
+		"bob@example": "bob@example",
+	}
+	for value, want := range tests {
+		if got := neutralize(value); got != want {
+			t.Errorf("neutralize(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
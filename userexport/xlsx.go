@@ -0,0 +1,104 @@
+package userexport
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"unified-go-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// An XLSX file is a zip archive of XML parts. The parts describing the
+// workbook are fixed; the single worksheet is written row by row with its
+// strings inline, so nothing has to be kept until the end.
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Users" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+const (
+	sheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	sheetEnd = `</sheetData></worksheet>`
+)
+
+type xlsxWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	columns []Column
+	org     primitive.ObjectID
+}
+
+func newXLSXWriter(w io.Writer, columns []Column, org primitive.ObjectID) (*xlsxWriter, error) {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return nil, err
+		}
+	}
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &xlsxWriter{archive: archive, sheet: bufio.NewWriter(sheet), columns: columns, org: org}
+	writer.sheet.WriteString(sheetStart)
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	return writer, writer.row(header)
+}
+
+func (xw *xlsxWriter) Write(user models.User) error {
+	values := make([]interface{}, len(xw.columns))
+	for i, column := range xw.columns {
+		values[i] = column.value(user, xw.org)
+	}
+	return xw.row(values)
+}
+
+// row writes a row of cells: booleans as such, anything else as a string.
+func (xw *xlsxWriter) row(values []interface{}) error {
+	xw.sheet.WriteString("<row>")
+	for _, value := range values {
+		if flag, ok := value.(bool); ok {
+			if flag {
+				xw.sheet.WriteString(`<c t="b"><v>1</v></c>`)
+			} else {
+				xw.sheet.WriteString(`<c t="b"><v>0</v></c>`)
+			}
+			continue
+		}
+		xw.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(xw.sheet, []byte(cell(value))); err != nil {
+			return err
+		}
+		xw.sheet.WriteString(`</t></is></c>`)
+	}
+	_, err := xw.sheet.WriteString("</row>")
+	return err
+}
+
+func (xw *xlsxWriter) Close() error {
+	xw.sheet.WriteString(sheetEnd)
+	if err := xw.sheet.Flush(); err != nil {
+		return err
+	}
+	return xw.archive.Close()
+}
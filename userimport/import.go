@@ -0,0 +1,382 @@
+// Package userimport imports users in bulk from CSV or NDJSON files. Every
+// row is validated like a registration, and rows that fail are reported
+// one by one without stopping the import.
+package userimport
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+	"unified-go-backend/authz"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// lookupBatchSize bounds the number of emails looked up at once.
+	lookupBatchSize = 1000
+	// progressInterval is how many rows are processed between progress
+	// updates of a job.
+	progressInterval = 100
+)
+
+func users() *mongo.Collection {
+	return database.MongoClient.Database("mdmdb").Collection("users")
+}
+
+func jobs() *mongo.Collection {
+	return database.MongoClient.Database("mdmdb").Collection("user_imports")
+}
+
+// Caller is the user running an import from the API, with their grants in
+// the import's scope. Rows may only hand out roles and permissions the
+// caller holds, and may not change the caller's own account. Imports run
+// from the command line have no caller.
+type Caller struct {
+	ID     primitive.ObjectID
+	Grants *authz.Grants
+}
+
+// Start stores a new job importing rows into org, or as global users for
+// primitive.NilObjectID, on behalf of caller and runs it in the
+// background. The job is not resumed if the process stops before it
+// completes.
+func Start(ctx context.Context, job *models.UserImportJob, rows []Row, caller *Caller) error {
+	job.ID = primitive.NewObjectID()
+	job.Status = models.UserImportRunning
+	job.Report = models.UserImportReport{Total: len(rows), Errors: []models.UserImportError{}}
+	job.CreatedAt = time.Now()
+	if _, err := jobs().InsertOne(ctx, job); err != nil {
+		return err
+	}
+
+	go func(job models.UserImportJob) {
+		ctx := context.Background()
+		report, err := Run(ctx, rows, job.OrgID, job.Options, caller, func(processed int) {
+			if _, err := jobs().UpdateByID(ctx, job.ID, bson.M{"$set": bson.M{"processed": processed}}); err != nil {
+				utils.Logger.Errorf("Failed to record progress of user import %s: %v", job.ID.Hex(), err)
+			}
+		})
+		update := bson.M{"status": models.UserImportCompleted, "processed": len(rows), "report": report, "finished_at": time.Now()}
+		if err != nil {
+			utils.Logger.Errorf("User import %s failed: %v", job.ID.Hex(), err)
+			update["status"], update["error"] = models.UserImportFailed, err.Error()
+		}
+		if _, err := jobs().UpdateByID(ctx, job.ID, bson.M{"$set": update}); err != nil {
+			utils.Logger.Errorf("Failed to record the end of user import %s: %v", job.ID.Hex(), err)
+		}
+		utils.Logger.Infof("User import %s by %s: %d created, %d updated, %d failed",
+			job.ID.Hex(), job.CreatedBy, report.Created, report.Updated, report.Failed)
+	}(*job)
+	return nil
+}
+
+// FindJob fetches the job with the given ID started in org, or globally
+// for primitive.NilObjectID.
+func FindJob(ctx context.Context, id, org primitive.ObjectID) (models.UserImportJob, error) {
+	var job models.UserImportJob
+	filter := bson.M{"_id": id, "org_id": bson.M{"$exists": false}}
+	if !org.IsZero() {
+		filter["org_id"] = org
+	}
+	err := jobs().FindOne(ctx, filter).Decode(&job)
+	return job, err
+}
+
+// importer holds what rows are checked against.
+type importer struct {
+	org     primitive.ObjectID
+	options models.UserImportOptions
+	caller  *Caller
+	roles   map[string]models.Role
+	groups  map[string]models.AccessGroup
+	// existing holds the users with the emails of the rows, deleted ones
+	// included
+	existing map[string]models.User
+	seen     map[string]int
+}
+
+// Run imports the rows into org, or as global users for
+// primitive.NilObjectID, on behalf of caller, nil from the command line,
+// calling progress every few rows. Inside an organization roles and access
+// groups are those of the users' membership and only users belonging to it
+// alone can be updated. The passwords of existing users are left
+// unchanged. The report holds the rows processed when an error interrupts
+// the import.
+func Run(ctx context.Context, rows []Row, org primitive.ObjectID, options models.UserImportOptions, caller *Caller, progress func(processed int)) (models.UserImportReport, error) {
+	report := models.UserImportReport{Total: len(rows), Errors: []models.UserImportError{}}
+
+	imp, err := load(ctx, rows, org, options, caller)
+	if err != nil {
+		return report, err
+	}
+
+	var updated []primitive.ObjectID
+	defer func() {
+		authz.InvalidateUsers(ctx, updated...)
+	}()
+
+	for i, row := range rows {
+		if i > 0 && i%progressInterval == 0 && progress != nil {
+			progress(i)
+		}
+
+		membership, existing, rowErrors := imp.check(row)
+		if rowErrors != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, models.UserImportError{Line: row.Line, Email: row.Email, Errors: rowErrors})
+			continue
+		}
+		if options.DryRun {
+			if existing != nil {
+				report.Updated++
+			} else {
+				report.Created++
+			}
+			continue
+		}
+
+		if existing != nil {
+			if err := imp.update(ctx, *existing, row, membership); err != nil {
+				return report, err
+			}
+			updated = append(updated, existing.ID)
+			report.Updated++
+			continue
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(row.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return report, err
+		}
+		if err := imp.create(ctx, row, string(hashedPassword), membership); err != nil {
+			return report, err
+		}
+		report.Created++
+	}
+	return report, nil
+}
+
+// load fetches the roles and access groups the rows may name, and the
+// users already holding their emails.
+func load(ctx context.Context, rows []Row, org primitive.ObjectID, options models.UserImportOptions, caller *Caller) (*importer, error) {
+	imp := &importer{
+		org:      org,
+		options:  options,
+		caller:   caller,
+		groups:   make(map[string]models.AccessGroup),
+		existing: make(map[string]models.User),
+		seen:     make(map[string]int),
+	}
+
+	roles, err := authz.LoadRoles(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	imp.roles = authz.OwnRoles(roles, org)
+
+	names := map[string]bool{"user_group": true}
+	for _, name := range options.AccessGroups {
+		names[name] = true
+	}
+	for _, row := range rows {
+		for _, name := range row.AccessGroups {
+			names[name] = true
+		}
+	}
+	groupNames := make([]string, 0, len(names))
+	for name := range names {
+		groupNames = append(groupNames, name)
+	}
+	groups, err := authz.FindAccessGroups(ctx, groupNames, org)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		imp.groups[group.Name] = group
+	}
+
+	for start := 0; start < len(rows); start += lookupBatchSize {
+		end := start + lookupBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		emails := make([]string, 0, end-start)
+		for _, row := range rows[start:end] {
+			emails = append(emails, row.Email)
+		}
+		cursor, err := users().Find(ctx, bson.M{"email": bson.M{"$in": emails}})
+		if err != nil {
+			return nil, err
+		}
+		var found []models.User
+		if err := cursor.All(ctx, &found); err != nil {
+			return nil, err
+		}
+		for _, user := range found {
+			imp.existing[user.Email] = user
+		}
+	}
+	return imp, nil
+}
+
+// check validates the row and resolves its roles and access groups,
+// returned as a membership of the import's organization. It also returns
+// the user the row updates, if any.
+func (imp *importer) check(row Row) (models.OrgMembership, *models.User, map[string]string) {
+	membership := models.OrgMembership{OrgID: imp.org, Roles: []string{}, AccessGroups: []primitive.ObjectID{}}
+	if row.invalid != "" {
+		return membership, nil, map[string]string{"row": row.invalid}
+	}
+
+	rowErrors := make(map[string]string)
+	request := models.RegisterRequest{Email: row.Email, Username: row.Username, Password: row.Password}
+	if err := utils.ValidateStruct(request); err != nil {
+		rowErrors = utils.FormatValidationError(err)
+	}
+	if line, duplicate := imp.seen[row.Email]; duplicate && row.Email != "" {
+		rowErrors["email"] = "duplicates the row on line " + strconv.Itoa(line)
+	} else {
+		imp.seen[row.Email] = row.Line
+	}
+
+	// Global users get the defaults of self-registered ones
+	roles, groupNames := row.Roles, row.AccessGroups
+	if len(roles) == 0 {
+		roles = imp.options.Roles
+	}
+	if len(roles) == 0 && imp.org.IsZero() {
+		roles = []string{"user"}
+	}
+	if len(groupNames) == 0 {
+		groupNames = imp.options.AccessGroups
+	}
+	if _, exists := imp.groups["user_group"]; exists && len(groupNames) == 0 && imp.org.IsZero() {
+		groupNames = []string{"user_group"}
+	}
+
+	var missing []string
+	for _, name := range roles {
+		if _, exists := imp.roles[name]; !exists {
+			missing = append(missing, name)
+		}
+		membership.Roles = append(membership.Roles, name)
+	}
+	if len(missing) > 0 {
+		rowErrors["roles"] = "unknown roles: " + strings.Join(missing, ", ")
+	}
+	if _, failed := rowErrors["roles"]; !failed {
+		if withheld := imp.withheld(authz.RolePermissions(imp.roles, roles)); len(withheld) > 0 {
+			rowErrors["roles"] = "grant permissions you do not hold: " + strings.Join(withheld, ", ")
+		}
+	}
+	missing = nil
+	var groups []models.AccessGroup
+	for _, name := range groupNames {
+		group, exists := imp.groups[name]
+		if !exists {
+			missing = append(missing, name)
+			continue
+		}
+		membership.AccessGroups = append(membership.AccessGroups, group.ID)
+		groups = append(groups, group)
+	}
+	if len(missing) > 0 {
+		rowErrors["access_groups"] = "unknown access groups: " + strings.Join(missing, ", ")
+	} else if withheld := imp.withheld(authz.GroupPermissions(imp.roles, groups)); len(withheld) > 0 {
+		rowErrors["access_groups"] = "grant permissions you do not hold: " + strings.Join(withheld, ", ")
+	}
+
+	var existing *models.User
+	if user, exists := imp.existing[row.Email]; exists {
+		switch {
+		case !user.DeletedAt.IsZero():
+			rowErrors["email"] = "belongs to a deleted user"
+		case !imp.options.Upsert:
+			rowErrors["email"] = "already exists"
+		case !imp.ownsAccount(user):
+			rowErrors["email"] = "belongs to a user of other organizations"
+		case imp.caller != nil && user.ID == imp.caller.ID:
+			rowErrors["email"] = "is your own account"
+		default:
+			// Updated users keep their password, so rows need none
+			existing = &user
+			delete(rowErrors, "password")
+		}
+	}
+
+	if len(rowErrors) > 0 {
+		return membership, nil, rowErrors
+	}
+	return membership, existing, nil
+}
+
+// withheld lists the granted permissions the caller does not hold, in
+// order. Nothing is withheld from imports without a caller.
+func (imp *importer) withheld(granted authz.PermissionSet) []string {
+	if imp.caller == nil {
+		return nil
+	}
+	return imp.caller.Grants.Withheld(granted)
+}
+
+// ownsAccount reports whether the import may change the user's account:
+// any user globally, and inside an organization only its members that
+// belong to no other one.
+func (imp *importer) ownsAccount(user models.User) bool {
+	if imp.org.IsZero() {
+		return true
+	}
+	member := false
+	for _, membership := range user.Orgs {
+		if membership.OrgID != imp.org {
+			return false
+		}
+		member = true
+	}
+	return member
+}
+
+func (imp *importer) create(ctx context.Context, row Row, password string, membership models.OrgMembership) error {
+	user := models.User{
+		ID:           primitive.NewObjectID(),
+		Email:        row.Email,
+		Username:     row.Username,
+		Password:     password,
+		Verified:     imp.options.Verified,
+		Roles:        []string{},
+		AccessGroups: []primitive.ObjectID{},
+	}
+	if user.Verified {
+		user.VerifiedAt = time.Now()
+	}
+	if imp.org.IsZero() {
+		user.Roles, user.AccessGroups = membership.Roles, membership.AccessGroups
+	} else {
+		user.Orgs = []models.OrgMembership{membership}
+	}
+	_, err := users().InsertOne(ctx, user)
+	return err
+}
+
+func (imp *importer) update(ctx context.Context, user models.User, row Row, membership models.OrgMembership) error {
+	set := bson.M{"username": row.Username}
+	filter := bson.M{"_id": user.ID}
+	if imp.org.IsZero() {
+		set["roles"], set["access_groups"] = membership.Roles, membership.AccessGroups
+	} else {
+		filter["orgs.org_id"] = imp.org
+		set["orgs.$"] = membership
+	}
+	if imp.options.Verified && !user.Verified {
+		set["verified"], set["verified_at"] = true, time.Now()
+	}
+	_, err := users().UpdateOne(ctx, filter, bson.M{"$set": set})
+	return err
+}
@@ -0,0 +1,80 @@
+package userimport
+
+import (
+	"strings"
+	"testing"
+	"unified-go-backend/authz"
+	"unified-go-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestImporterCheck(t *testing.T) {
+	caller := models.User{ID: primitive.NewObjectID(), Email: "admin@example.com"}
+	existing := models.User{ID: primitive.NewObjectID(), Email: "bob@example.com"}
+	newImporter := func(options models.UserImportOptions) *importer {
+		return &importer{
+			options: options,
+			caller: &Caller{ID: caller.ID, Grants: &authz.Grants{Allow: []authz.Rule{
+				{Permission: "users:*", Effect: "allow"},
+				{Permission: "roles:read", Effect: "allow"},
+			}}},
+			roles: map[string]models.Role{
+				"user":    {Name: "user", Permissions: []string{"users:read"}},
+				"support": {Name: "support", Parents: []string{"user"}, Permissions: []string{"read_role"}},
+				"admin":   {Name: "admin", Parents: []string{"support"}, Permissions: []string{"roles:*"}},
+			},
+			groups: map[string]models.AccessGroup{
+				"readers": {ID: primitive.NewObjectID(), Name: "readers", Roles: []string{"support"}},
+				"owners":  {ID: primitive.NewObjectID(), Name: "owners", Permissions: []string{"delete_role"}},
+			},
+			existing: map[string]models.User{caller.Email: caller, existing.Email: existing},
+			seen:     make(map[string]int),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		upsert  bool
+		row     Row
+		updates bool
+		// errors maps the fields expected to fail to the start of their
+		// message
+		errors map[string]string
+	}{
+		{name: "new user", row: Row{Email: "alice@example.com", Username: "alice", Password: "secret1", Roles: []string{"support"}, AccessGroups: []string{"readers"}}},
+		{name: "new user without password", row: Row{Email: "alice@example.com", Username: "alice"}, errors: map[string]string{"password": ""}},
+		{name: "role beyond caller", row: Row{Email: "alice@example.com", Username: "alice", Password: "secret1", Roles: []string{"admin"}}, errors: map[string]string{"roles": "grant permissions you do not hold: roles:*"}},
+		{name: "access group beyond caller", row: Row{Email: "alice@example.com", Username: "alice", Password: "secret1", AccessGroups: []string{"owners"}}, errors: map[string]string{"access_groups": "grant permissions you do not hold: roles:delete"}},
+		{name: "unknown role", row: Row{Email: "alice@example.com", Username: "alice", Password: "secret1", Roles: []string{"ghost"}}, errors: map[string]string{"roles": "unknown roles: ghost"}},
+		{name: "existing without upsert", row: Row{Email: existing.Email, Username: "bob", Password: "secret1"}, errors: map[string]string{"email": "already exists"}},
+		{name: "existing without password", upsert: true, row: Row{Email: existing.Email, Username: "bob"}, updates: true},
+		{name: "caller's own account", upsert: true, row: Row{Email: caller.Email, Username: "admin", Password: "secret1", Roles: []string{"support"}}, errors: map[string]string{"email": "is your own account"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			imp := newImporter(models.UserImportOptions{Upsert: test.upsert})
+			_, user, rowErrors := imp.check(test.row)
+			if len(rowErrors) != len(test.errors) {
+				t.Fatalf("check() errors = %v, want %v", rowErrors, test.errors)
+			}
+			for field, prefix := range test.errors {
+				message, failed := rowErrors[field]
+				if !failed || !strings.HasPrefix(message, prefix) {
+					t.Errorf("check() errors[%q] = %q, want prefix %q", field, message, prefix)
+				}
+			}
+			if (user != nil) != test.updates {
+				t.Errorf("check() updates %v, want %v", user != nil, test.updates)
+			}
+		})
+	}
+
+	// Imports from the command line may grant anything
+	imp := newImporter(models.UserImportOptions{})
+	imp.caller = nil
+	if _, _, rowErrors := imp.check(Row{Email: "alice@example.com", Username: "alice", Password: "secret1", Roles: []string{"admin"}, AccessGroups: []string{"owners"}}); rowErrors != nil {
+		t.Errorf("check() without caller errors = %v", rowErrors)
+	}
+}
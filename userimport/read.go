@@ -0,0 +1,156 @@
+package userimport
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Import file formats.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// csvColumns are the columns a CSV file may have. Roles and access groups
+// are separated by semicolons within their cell.
+var csvColumns = map[string]bool{
+	"email":         true,
+	"username":      true,
+	"password":      true,
+	"roles":         true,
+	"access_groups": true,
+}
+
+// Row is a user read from an import file, with the line it starts on.
+type Row struct {
+	Line         int      `json:"-"`
+	Email        string   `json:"email"`
+	Username     string   `json:"username"`
+	Password     string   `json:"password"`
+	Roles        []string `json:"roles"`
+	AccessGroups []string `json:"access_groups"`
+	// invalid tells why the row could not be read
+	invalid string
+}
+
+// FormatOf guesses the format of a file from its name or content type, and
+// returns "" when it cannot tell.
+func FormatOf(name string) string {
+	switch strings.ToLower(strings.TrimSpace(strings.Split(name, ";")[0])) {
+	case "text/csv":
+		return FormatCSV
+	case "application/x-ndjson", "application/jsonl":
+		return FormatNDJSON
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return FormatCSV
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON
+	}
+	return ""
+}
+
+// Read reads the rows of an import file. Rows that cannot be decoded are
+// returned too and reported when imported; a file that cannot be read at
+// all is an error.
+func Read(r io.Reader, format string) ([]Row, error) {
+	switch format {
+	case FormatCSV:
+		return readCSV(r)
+	case FormatNDJSON:
+		return readNDJSON(r)
+	}
+	return nil, fmt.Errorf("unknown format %q, must be %s or %s", format, FormatCSV, FormatNDJSON)
+}
+
+func readCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !csvColumns[name] {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		header[i] = name
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		row := Row{Line: line}
+		if len(record) != len(header) {
+			row.invalid = fmt.Sprintf("has %d fields instead of %d", len(record), len(header))
+			rows = append(rows, row)
+			continue
+		}
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			switch header[i] {
+			case "email":
+				row.Email = value
+			case "username":
+				row.Username = value
+			case "password":
+				row.Password = value
+			case "roles":
+				row.Roles = splitList(value)
+			case "access_groups":
+				row.AccessGroups = splitList(value)
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+func readNDJSON(r io.Reader) ([]Row, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var rows []Row
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		row := Row{}
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			row = Row{invalid: "is not a JSON object: " + err.Error()}
+		}
+		row.Line = line
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+func splitList(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ";") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
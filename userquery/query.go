@@ -0,0 +1,367 @@
+// Package userquery parses the search, filter, sort and projection
+// parameters of user listings into Mongo queries.
+package userquery
+
+import (
+	"context"
+	"encoding/binary"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// sortFields maps the names accepted by the sort parameter to stored
+// fields. Users have no creation date of their own; the ID embeds it.
+var sortFields = map[string]string{
+	"username":   "username",
+	"email":      "email",
+	"verified":   "verified",
+	"last_login": "last_login",
+	"created":    "_id",
+}
+
+// projectionFields maps the names accepted by the fields parameter, those
+// of the views of users, to stored fields. The password hash can never be
+// selected.
+var projectionFields = map[string]string{
+	"username":      "username",
+	"email":         "email",
+	"verified":      "verified",
+	"verified_at":   "verified_at",
+	"last_login":    "last_login",
+	"roles":         "roles",
+	"access_groups": "access_groups",
+	"role_grants":   "role_grants",
+	"orgs":          "orgs",
+	"teams":         "teams",
+	"deleted_at":    "deleted_at",
+	"status":        "status",
+}
+
+// Query is a parsed user listing request. Zero values do not filter.
+type Query struct {
+	Search        string
+	Verified      *bool
+	Role          string
+	Status        string
+	AccessGroup   primitive.ObjectID
+	CreatedFrom   time.Time
+	CreatedTo     time.Time
+	LastLoginFrom time.Time
+	LastLoginTo   time.Time
+	// Deleted lists the deleted users instead of the others.
+	Deleted bool
+	// Sort lists the stored fields to sort by, in order, each prefixed with
+	// "-" when descending.
+	Sort []string
+	// Fields lists the stored fields to return; empty returns every field.
+	Fields []string
+	// Names lists the selected fields as the views of users name them.
+	Names []string
+}
+
+// Parse reads the query parameters:
+//
+//	search            substring of the username or email, case-insensitive
+//	verified          true or false
+//	role              role name
+//	status            active, suspended or banned
+//	access_group      access group ID
+//	created_from/to   creation date range, RFC 3339 or YYYY-MM-DD
+//	last_login_from/to
+//	deleted           true to list the deleted users instead
+//	sort              comma-separated fields, "-" prefix for descending,
+//	                  e.g. -last_login,username
+//	fields            comma-separated fields to return
+//
+// Dates given as a day are inclusive: a range ending on a day includes all
+// of it. Invalid parameters are reported keyed by parameter name.
+func Parse(values url.Values) (Query, map[string]string) {
+	var query Query
+	errors := make(map[string]string)
+
+	query.Search = strings.TrimSpace(values.Get("search"))
+
+	if value := values.Get("verified"); value != "" {
+		verified, err := strconv.ParseBool(value)
+		if err != nil {
+			errors["verified"] = "must be true or false"
+		} else {
+			query.Verified = &verified
+		}
+	}
+
+	query.Role = values.Get("role")
+
+	if value := values.Get("status"); value != "" {
+		if value != models.UserActive && value != models.UserSuspended && value != models.UserBanned {
+			errors["status"] = "must be active, suspended or banned"
+		}
+		query.Status = value
+	}
+
+	if value := values.Get("deleted"); value != "" {
+		deleted, err := strconv.ParseBool(value)
+		if err != nil {
+			errors["deleted"] = "must be true or false"
+		}
+		query.Deleted = deleted
+	}
+
+	if value := values.Get("access_group"); value != "" {
+		id, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			errors["access_group"] = "must be an access group ID"
+		}
+		query.AccessGroup = id
+	}
+
+	query.CreatedFrom = parseDate(values, "created_from", false, errors)
+	query.CreatedTo = parseDate(values, "created_to", true, errors)
+	checkRange(query.CreatedFrom, query.CreatedTo, "created_to", errors)
+	query.LastLoginFrom = parseDate(values, "last_login_from", false, errors)
+	query.LastLoginTo = parseDate(values, "last_login_to", true, errors)
+	checkRange(query.LastLoginFrom, query.LastLoginTo, "last_login_to", errors)
+
+	if value := values.Get("sort"); value != "" {
+		seen := make(map[string]bool)
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			descending := strings.HasPrefix(name, "-")
+			field, exists := sortFields[strings.TrimPrefix(name, "-")]
+			if !exists || seen[field] {
+				errors["sort"] = "must be a list of distinct fields among " + strings.Join(keys(sortFields), ", ")
+				break
+			}
+			seen[field] = true
+			if descending {
+				field = "-" + field
+			}
+			query.Sort = append(query.Sort, field)
+		}
+	}
+
+	if value := values.Get("fields"); value != "" {
+		for _, name := range strings.Split(value, ",") {
+			field, exists := projectionFields[strings.TrimSpace(name)]
+			if !exists {
+				errors["fields"] = "must be a list of fields among " + strings.Join(keys(projectionFields), ", ")
+				break
+			}
+			query.Fields = append(query.Fields, field)
+			query.Names = append(query.Names, strings.TrimSpace(name))
+		}
+	}
+
+	if len(errors) > 0 {
+		return query, errors
+	}
+	return query, nil
+}
+
+// Filter returns the Mongo filter of the query, restricted by base. Inside
+// an organization, org is its ID and roles and access groups are those of
+// the users' membership.
+func (q Query) Filter(base bson.M, org primitive.ObjectID) bson.M {
+	filter := bson.M{}
+	for key, value := range base {
+		filter[key] = value
+	}
+	filter["deleted_at"] = bson.M{"$exists": q.Deleted}
+	var and []bson.M
+
+	if q.Search != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q.Search), Options: "i"}
+		and = append(and, bson.M{"$or": []bson.M{{"username": pattern}, {"email": pattern}}})
+	}
+	if q.Verified != nil {
+		filter["verified"] = *q.Verified
+	}
+	switch q.Status {
+	case "":
+	case models.UserActive:
+		filter["status.state"] = bson.M{"$nin": []string{models.UserSuspended, models.UserBanned}}
+	default:
+		filter["status.state"] = q.Status
+	}
+
+	membership := bson.M{}
+	if q.Role != "" {
+		if org.IsZero() {
+			filter["roles"] = q.Role
+		} else {
+			membership["roles"] = q.Role
+		}
+	}
+	if !q.AccessGroup.IsZero() {
+		if org.IsZero() {
+			filter["access_groups"] = q.AccessGroup
+		} else {
+			membership["access_groups"] = q.AccessGroup
+		}
+	}
+	if len(membership) > 0 {
+		membership["org_id"] = org
+		and = append(and, bson.M{"orgs": bson.M{"$elemMatch": membership}})
+	}
+
+	if created := idRange(q.CreatedFrom, q.CreatedTo); created != nil {
+		and = append(and, bson.M{"_id": created})
+	}
+	if lastLogin := timeRange(q.LastLoginFrom, q.LastLoginTo); lastLogin != nil {
+		filter["last_login"] = lastLogin
+	}
+
+	if len(and) > 0 {
+		filter["$and"] = and
+	}
+	return filter
+}
+
+// SortDocument returns the sort order, ending with the ID so that the
+// order is total. Without a sort parameter users are listed by ID.
+func (q Query) SortDocument() bson.D {
+	order := bson.D{}
+	hasID := false
+	for _, field := range q.Sort {
+		direction := 1
+		if strings.HasPrefix(field, "-") {
+			field, direction = field[1:], -1
+		}
+		hasID = hasID || field == "_id"
+		order = append(order, bson.E{Key: field, Value: direction})
+	}
+	if !hasID {
+		order = append(order, bson.E{Key: "_id", Value: 1})
+	}
+	return order
+}
+
+// Projection returns the projection of the selected fields inside org, or
+// nil to return every field. Inside an organization roles and access groups
+// are read from the users' memberships.
+func (q Query) Projection(org primitive.ObjectID) bson.M {
+	if len(q.Fields) == 0 {
+		return nil
+	}
+	projection := bson.M{}
+	for _, field := range q.Fields {
+		projection[field] = 1
+		if !org.IsZero() && (field == "roles" || field == "access_groups") {
+			projection["orgs"] = 1
+		}
+	}
+	return projection
+}
+
+// Live adds to filter the condition that the user was not deleted.
+func Live(filter bson.M) bson.M {
+	live := bson.M{"deleted_at": bson.M{"$exists": false}}
+	for key, value := range filter {
+		live[key] = value
+	}
+	return live
+}
+
+// EnsureIndexes creates the indexes supporting the user listing filters
+// and sort orders, the purge of deleted users, the lifting of expired
+// suspensions and the erasure of accounts.
+func EnsureIndexes(ctx context.Context) error {
+	users := database.MongoClient.Database("mdmdb").Collection("users")
+	_, err := users.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}},
+		{Keys: bson.D{{Key: "username", Value: 1}}},
+		{Keys: bson.D{{Key: "verified", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "last_login", Value: 1}}},
+		{Keys: bson.D{{Key: "roles", Value: 1}}},
+		{Keys: bson.D{{Key: "access_groups", Value: 1}}},
+		{Keys: bson.D{{Key: "orgs.org_id", Value: 1}, {Key: "orgs.roles", Value: 1}}},
+		{Keys: bson.D{{Key: "orgs.org_id", Value: 1}, {Key: "orgs.access_groups", Value: 1}}},
+		{Keys: bson.D{{Key: "deleted_at", Value: 1}}},
+		{Keys: bson.D{{Key: "status.state", Value: 1}, {Key: "status.expires_at", Value: 1}}},
+		{Keys: bson.D{{Key: "deletion_scheduled_at", Value: 1}}},
+	})
+	return err
+}
+
+// parseDate reads the named date parameter. A day given as the end of a
+// range means the end of that day.
+func parseDate(values url.Values, name string, end bool, errors map[string]string) time.Time {
+	value := values.Get(name)
+	if value == "" {
+		return time.Time{}
+	}
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		errors[name] = "must be a date, YYYY-MM-DD or RFC 3339"
+		return time.Time{}
+	}
+	if end {
+		date = date.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return date
+}
+
+func checkRange(from, to time.Time, name string, errors map[string]string) {
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		errors[name] = "must not be before the start of the range"
+	}
+}
+
+func timeRange(from, to time.Time) bson.M {
+	bounds := bson.M{}
+	if !from.IsZero() {
+		bounds["$gte"] = from
+	}
+	if !to.IsZero() {
+		bounds["$lte"] = to
+	}
+	if len(bounds) == 0 {
+		return nil
+	}
+	return bounds
+}
+
+// idRange bounds IDs by the creation time they embed, which has a
+// resolution of a second.
+func idRange(from, to time.Time) bson.M {
+	bounds := bson.M{}
+	if !from.IsZero() {
+		bounds["$gte"] = firstID(from)
+	}
+	if !to.IsZero() {
+		bounds["$lt"] = firstID(to.Add(time.Second))
+	}
+	if len(bounds) == 0 {
+		return nil
+	}
+	return bounds
+}
+
+// firstID is the smallest ID created in the second of t.
+func firstID(t time.Time) primitive.ObjectID {
+	var id primitive.ObjectID
+	binary.BigEndian.PutUint32(id[:4], uint32(t.Unix()))
+	return id
+}
+
+func keys(fields map[string]string) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
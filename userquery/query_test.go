@@ -0,0 +1,144 @@
+package userquery
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParse(t *testing.T) {
+	group := primitive.NewObjectID()
+	verified := true
+
+	tests := []struct {
+		name  string
+		query string
+		want  Query
+		// errors are the parameters expected to be invalid
+		errors []string
+	}{
+		{name: "empty", query: ""},
+		{
+			name:  "filters",
+			query: "search=+bob+&verified=true&role=admin&status=banned&access_group=" + group.Hex() + "&deleted=true",
+			want:  Query{Search: "bob", Verified: &verified, Role: "admin", Status: "banned", AccessGroup: group, Deleted: true},
+		},
+		{
+			name:  "dates",
+			query: "created_from=2024-01-01&created_to=2024-01-31&last_login_from=2024-02-01T10:00:00Z",
+			want: Query{
+				CreatedFrom:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				CreatedTo:     time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond),
+				LastLoginFrom: time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC),
+			},
+		},
+		{name: "same day range", query: "created_from=2024-01-01&created_to=2024-01-01", want: Query{
+			CreatedFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			CreatedTo:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond),
+		}},
+		{name: "sort", query: "sort=-last_login, username,created", want: Query{Sort: []string{"-last_login", "username", "_id"}}},
+		{name: "fields", query: "fields=email, roles", want: Query{Fields: []string{"email", "roles"}, Names: []string{"email", "roles"}}},
+		{name: "invalid flags", query: "verified=maybe&deleted=2", errors: []string{"verified", "deleted"}},
+		{name: "invalid status", query: "status=gone", errors: []string{"status"}},
+		{name: "invalid access group", query: "access_group=ops", errors: []string{"access_group"}},
+		{name: "invalid date", query: "created_from=01/02/2024&last_login_to=yesterday", errors: []string{"created_from", "last_login_to"}},
+		{name: "reversed range", query: "last_login_from=2024-03-01&last_login_to=2024-02-01", errors: []string{"last_login_to"}},
+		{name: "unknown sort field", query: "sort=password", errors: []string{"sort"}},
+		{name: "repeated sort field", query: "sort=email,-email", errors: []string{"sort"}},
+		{name: "unknown field", query: "fields=email,password", errors: []string{"fields"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatalf("url.ParseQuery() error = %v", err)
+			}
+			query, errors := Parse(values)
+			if test.errors != nil {
+				if len(errors) != len(test.errors) {
+					t.Fatalf("Parse() errors = %v, want errors for %v", errors, test.errors)
+				}
+				for _, name := range test.errors {
+					if _, exists := errors[name]; !exists {
+						t.Errorf("Parse() errors = %v, want an error for %s", errors, name)
+					}
+				}
+				return
+			}
+			if errors != nil {
+				t.Fatalf("Parse() errors = %v", errors)
+			}
+			if !reflect.DeepEqual(query, test.want) {
+				t.Errorf("Parse() = %+v, want %+v", query, test.want)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	org := primitive.NewObjectID()
+	base := bson.M{"orgs.org_id": org}
+
+	filter := Query{Role: "admin", Status: "active"}.Filter(base, org)
+	want := bson.M{
+		"orgs.org_id":  org,
+		"deleted_at":   bson.M{"$exists": false},
+		"status.state": bson.M{"$nin": []string{"suspended", "banned"}},
+		"$and":         []bson.M{{"orgs": bson.M{"$elemMatch": bson.M{"roles": "admin", "org_id": org}}}},
+	}
+	if !reflect.DeepEqual(filter, want) {
+		t.Errorf("Filter() inside an organization = %v, want %v", filter, want)
+	}
+	if _, changed := base["deleted_at"]; changed {
+		t.Error("Filter() changed its base")
+	}
+
+	filter = Query{Role: "admin", Deleted: true}.Filter(bson.M{}, primitive.NilObjectID)
+	want = bson.M{"deleted_at": bson.M{"$exists": true}, "roles": "admin"}
+	if !reflect.DeepEqual(filter, want) {
+		t.Errorf("Filter() globally = %v, want %v", filter, want)
+	}
+}
+
+func TestSortDocument(t *testing.T) {
+	tests := []struct {
+		sort []string
+		want bson.D
+	}{
+		{nil, bson.D{{Key: "_id", Value: 1}}},
+		{[]string{"-last_login", "username"}, bson.D{{Key: "last_login", Value: -1}, {Key: "username", Value: 1}, {Key: "_id", Value: 1}}},
+		{[]string{"-_id"}, bson.D{{Key: "_id", Value: -1}}},
+	}
+	for _, test := range tests {
+		if got := (Query{Sort: test.sort}).SortDocument(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SortDocument(%v) = %v, want %v", test.sort, got, test.want)
+		}
+	}
+}
+
+func TestProjection(t *testing.T) {
+	org := primitive.NewObjectID()
+	tests := []struct {
+		name   string
+		fields []string
+		org    primitive.ObjectID
+		want   bson.M
+	}{
+		{name: "every field", want: nil},
+		{name: "global", fields: []string{"email", "roles"}, want: bson.M{"email": 1, "roles": 1}},
+		{name: "membership roles", fields: []string{"email", "roles"}, org: org, want: bson.M{"email": 1, "roles": 1, "orgs": 1}},
+		{name: "no membership fields", fields: []string{"email"}, org: org, want: bson.M{"email": 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := (Query{Fields: test.fields}).Projection(test.org); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Projection() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"log"
 
@@ -18,6 +19,16 @@ func GenerateVerificationCode() string {
 	return base64.StdEncoding.EncodeToString(b)[:6]
 }
 
+// GenerateToken returns a random token, long enough to be unguessable.
+func GenerateToken() string {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
+
 func SendVerificationEmail(to string, code string, smtpHost string, smtpPort int, smtpUser string, smtpPassword string) error {
 	m := gomail.NewMessage()
 	m.SetHeader("From", smtpUser)
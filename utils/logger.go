@@ -31,4 +31,7 @@ func InitLogger() {
 	Logger.SetOutput(writer)
 	Logger.SetFormatter(&logrus.JSONFormatter{})
 	Logger.SetLevel(logrus.InfoLevel)
+	if level, err := logrus.ParseLevel(os.Getenv("LOG_LEVEL")); err == nil {
+		Logger.SetLevel(level)
+	}
 }
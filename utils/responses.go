@@ -17,6 +17,18 @@ type PaginatedResponse struct {
 	TotalPages int         `json:"total_pages"`
 }
 
+// CursorResponse represents the structure of a page reached by cursor.
+// Next and Prev are the cursors of the neighbouring pages, omitted at
+// either end; TotalCount is omitted when not requested.
+type CursorResponse struct {
+	Data       interface{} `json:"data"`
+	Limit      int         `json:"limit"`
+	Next       string      `json:"next,omitempty"`
+	Prev       string      `json:"prev,omitempty"`
+	TotalCount *int64      `json:"total_count,omitempty"`
+	Estimated  bool        `json:"estimated,omitempty"`
+}
+
 // CreateErrorResponse creates an error response.
 func CreateErrorResponse(message string, validationErrors map[string]string) ErrorResponse {
 	return ErrorResponse{
@@ -41,6 +53,18 @@ func CreatePaginatedResponse(data interface{}, page, limit, totalCount int) Pagi
 	}
 }
 
+// CreateCursorResponse creates a cursor-paginated response.
+func CreateCursorResponse(data interface{}, limit int, next, prev string, totalCount *int64, estimated bool) CursorResponse {
+	return CursorResponse{
+		Data:       data,
+		Limit:      limit,
+		Next:       next,
+		Prev:       prev,
+		TotalCount: totalCount,
+		Estimated:  estimated,
+	}
+}
+
 // JSONErrorResponse writes a JSON error response.
 func JSONErrorResponse(c *gin.Context, statusCode int, message string) {
 	c.JSON(statusCode, CreateErrorResponse(message, nil))
@@ -0,0 +1,26 @@
+package worker
+
+import (
+	"context"
+	"time"
+	"unified-go-backend/accessreview"
+	"unified-go-backend/utils"
+)
+
+// CompleteAccessReviews completes access review campaigns once they end,
+// revoking unreviewed grants, every interval until ctx is done.
+func CompleteAccessReviews(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := accessreview.CompleteExpired(ctx, time.Now()); err != nil {
+			utils.Logger.Errorf("Failed to complete access reviews: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
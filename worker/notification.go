@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+	"unified-go-backend/config"
+	"unified-go-backend/database"
+	"unified-go-backend/utils"
+
+	"github.com/go-gomail/gomail"
+	"github.com/go-redis/redis/v8"
+)
+
+const notificationQueue = "notification_queue"
+
+// Notification is a plain text email waiting in the notification queue.
+type Notification struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// EnqueueNotification queues an email for ProcessNotificationJobs.
+func EnqueueNotification(ctx context.Context, to, subject, body string) error {
+	payload, err := json.Marshal(Notification{To: to, Subject: subject, Body: body})
+	if err != nil {
+		return err
+	}
+	return database.RedisClient.LPush(ctx, notificationQueue, payload).Err()
+}
+
+func SendNotification(notification Notification, cfg *config.Config) error {
+	m := gomail.NewMessage()
+	m.SetHeader("From", cfg.SMTPUser)
+	m.SetHeader("To", notification.To)
+	m.SetHeader("Subject", notification.Subject)
+	m.SetBody("text/plain", notification.Body)
+
+	d := gomail.NewDialer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPassword)
+
+	return d.DialAndSend(m)
+}
+
+func ProcessNotificationJobs(ctx context.Context, cfg *config.Config) error {
+	for {
+		result, err := database.RedisClient.BLPop(ctx, 0*time.Second, notificationQueue).Result()
+		if err != nil {
+			if err == redis.Nil {
+				continue
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		var notification Notification
+		if err := json.Unmarshal([]byte(result[1]), &notification); err != nil {
+			utils.Logger.Errorf("Failed to decode notification: %v", err)
+			continue
+		}
+
+		if err := SendNotification(notification, cfg); err != nil {
+			utils.Logger.Errorf("Failed to send notification to %s: %v", notification.To, err)
+			continue
+		}
+
+		utils.Logger.Infof("Notification %q sent to %s", notification.Subject, notification.To)
+	}
+}
@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"context"
+	"time"
+	"unified-go-backend/privacy"
+	"unified-go-backend/utils"
+)
+
+// ProcessPrivacyRequests builds the requested data exports, each
+// downloadable for exportTTL, deletes the expired ones and erases the
+// accounts due for erasure, every interval until ctx is done.
+func ProcessPrivacyRequests(ctx context.Context, interval, exportTTL time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := privacy.BuildExports(ctx, exportTTL); err != nil {
+			utils.Logger.Errorf("Failed to build data exports: %v", err)
+		}
+		if deleted, err := privacy.DeleteExpiredExports(ctx); err != nil {
+			utils.Logger.Errorf("Failed to delete expired data exports: %v", err)
+		} else if deleted > 0 {
+			utils.Logger.Infof("Deleted %d expired data exports", deleted)
+		}
+		if erased, err := privacy.EraseDueAccounts(ctx); err != nil {
+			utils.Logger.Errorf("Failed to erase accounts: %v", err)
+		} else if erased > 0 {
+			utils.Logger.Infof("Erased %d accounts", erased)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"unified-go-backend/authz"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ExpireRoleGrants removes expired temporary role grants from users every
+// interval until ctx is done.
+func ExpireRoleGrants(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := expireRoleGrants(ctx, time.Now()); err != nil {
+			utils.Logger.Errorf("Failed to expire role grants: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func expireRoleGrants(ctx context.Context, now time.Time) error {
+	users := database.MongoClient.Database("mdmdb").Collection("users")
+	requests := database.MongoClient.Database("mdmdb").Collection("role_requests")
+
+	expired := bson.M{"expires_at": bson.M{"$lte": now}}
+	cursor, err := users.Find(ctx, bson.M{"role_grants": bson.M{"$elemMatch": expired}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+
+		_, err := users.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$pull": bson.M{"role_grants": expired}})
+		if err != nil {
+			return err
+		}
+		authz.InvalidateUsers(ctx, user.ID)
+
+		for _, grant := range user.RoleGrants {
+			if grant.ExpiresAt.After(now) {
+				continue
+			}
+
+			if !grant.RequestID.IsZero() {
+				_, err := requests.UpdateOne(ctx,
+					bson.M{"_id": grant.RequestID, "status": models.RoleRequestApproved},
+					bson.M{"$set": bson.M{"status": models.RoleRequestExpired}},
+				)
+				if err != nil {
+					utils.Logger.Errorf("Failed to mark role request %s as expired: %v", grant.RequestID.Hex(), err)
+				}
+			}
+
+			utils.Logger.Infof("Role grant %s expired for %s", grant.Role, user.Email)
+			body := fmt.Sprintf("Your temporary %s role expired at %s.", grant.Role, grant.ExpiresAt.UTC().Format(time.RFC3339))
+			if err := EnqueueNotification(ctx, user.Email, "Role grant expired", body); err != nil {
+				utils.Logger.Errorf("Failed to queue role grant expiry notification for %s: %v", user.Email, err)
+			}
+		}
+	}
+	return cursor.Err()
+}
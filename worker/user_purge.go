@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"context"
+	"time"
+	"unified-go-backend/authz"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PurgeDeletedUsers permanently removes users deleted longer than retention
+// ago, together with their relation tuples, every interval until ctx is
+// done.
+func PurgeDeletedUsers(ctx context.Context, interval, retention time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := purgeDeletedUsers(ctx, time.Now().Add(-retention)); err != nil {
+			utils.Logger.Errorf("Failed to purge deleted users: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func purgeDeletedUsers(ctx context.Context, deletedBefore time.Time) error {
+	users := database.MongoClient.Database("mdmdb").Collection("users")
+
+	expired := bson.M{"deleted_at": bson.M{"$lte": deletedBefore}}
+	cursor, err := users.Find(ctx, expired)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+
+		// A user restored meanwhile is kept
+		result, err := users.DeleteOne(ctx, bson.M{"_id": user.ID, "deleted_at": bson.M{"$lte": deletedBefore}})
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount == 0 {
+			continue
+		}
+		if _, err := authz.DeleteTuplesOf(ctx, "user:"+user.ID.Hex()); err != nil {
+			return err
+		}
+		utils.Logger.Infof("Purged user %s, deleted at %s by %s", user.Email, user.DeletedAt.UTC().Format(time.RFC3339), user.DeletedBy)
+	}
+	return cursor.Err()
+}
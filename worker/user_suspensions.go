@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"context"
+	"time"
+	"unified-go-backend/database"
+	"unified-go-backend/models"
+	"unified-go-backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// LiftExpiredSuspensions reinstates the users whose suspension expired,
+// every interval until ctx is done. Expired suspensions no longer block
+// anyway; this records that the user is active again.
+func LiftExpiredSuspensions(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := liftExpiredSuspensions(ctx, time.Now()); err != nil {
+			utils.Logger.Errorf("Failed to lift expired suspensions: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func liftExpiredSuspensions(ctx context.Context, now time.Time) error {
+	users := database.MongoClient.Database("mdmdb").Collection("users")
+
+	expired := bson.M{
+		"status.state":      models.UserSuspended,
+		"status.expires_at": bson.M{"$lte": now},
+	}
+	cursor, err := users.Find(ctx, expired)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+
+		// A suspension changed meanwhile is left alone
+		status := models.UserStatus{State: models.UserActive, Reason: "Suspension expired", Since: now}
+		filter := bson.M{"_id": user.ID, "status.state": models.UserSuspended, "status.expires_at": user.Status.ExpiresAt}
+		result, err := users.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"status": status}})
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount > 0 {
+			utils.Logger.Infof("Suspension of %s expired", user.Email)
+		}
+	}
+	return cursor.Err()
+}